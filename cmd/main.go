@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/davlin-coder/davlin/internal/config"
 	"github.com/davlin-coder/davlin/internal/model"
 	"github.com/davlin-coder/davlin/internal/resource/container"
+	"github.com/davlin-coder/davlin/internal/service"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -20,12 +23,67 @@ func main() {
 	err = c.Invoke(func(db *gorm.DB) error {
 		return db.AutoMigrate(
 			&model.User{},
+			&model.Conversation{},
+			&model.ChatMessage{},
+			&model.TraceStep{},
+			&model.UsageRecord{},
+			&model.UserQuota{},
+			&model.Prompt{},
+			&model.PromptVersion{},
+			&model.UserInstruction{},
+			&model.ImportJob{},
+			&model.Share{},
+			&model.MessageFeedback{},
+			&model.RecoveryCode{},
+			&model.UserIdentity{},
+			&model.APIKey{},
+			&model.Role{},
+			&model.GatewayModel{},
+			&model.Workspace{},
+			&model.WorkspaceMember{},
+			&model.WorkspaceInvitation{},
+			&model.WorkspaceQuota{},
+			&model.Document{},
 		)
 	})
 	if err != nil {
 		panic(err)
 	}
 
+	// 创建消息全文索引
+	err = c.Invoke(func(searchService service.SearchService) error {
+		return searchService.EnsureIndex()
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// 重启前未完成的导入任务不会继续执行，标记为失败
+	err = c.Invoke(func(importService service.ImportService) error {
+		count, err := importService.FailInterrupted()
+		if count > 0 {
+			log.Printf("%d个导入任务因服务重启被标记为失败", count)
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// 定期删除宽限期已过的账户
+	err = c.Invoke(func(userService service.UserService) {
+		go func() {
+			for ; ; time.Sleep(time.Hour) {
+				if _, err := userService.PurgeDeletedAccounts(); err != nil {
+					log.Printf("清理已注销账户失败: %v", err)
+				}
+			}
+		}()
+	})
+	if err != nil {
+		panic(err)
+	}
+
 	err = c.Invoke(func(conf *config.Config, router *gin.Engine) error {
 		port := fmt.Sprintf(":%d", conf.APP.Port)
 		fmt.Println("Service is starting at " + port + "...")
@@ -8,9 +8,10 @@ import (
 )
 
 type LLMConfig struct {
-	Model   string `mapstructure:"model"`
-	APIKey  string `mapstructure:"api_key"`
-	BaseURL string `mapstructure:"base_url"`
+	Model      string `mapstructure:"model"`
+	APIKey     string `mapstructure:"api_key"`
+	BaseURL    string `mapstructure:"base_url"`
+	TitleModel string `mapstructure:"title_model"` // 生成会话标题使用的低成本模型，为空时使用model
 }
 
 type MySQLConfig struct {
@@ -22,7 +23,10 @@ type MySQLConfig struct {
 }
 
 type APPConfig struct {
-	Port int `mapstructure:"port"`
+	Port   int    `mapstructure:"port"`
+	WebURL string `mapstructure:"web_url"` // 前端地址，用于生成邮件中的链接
+	// 可信的反向代理地址，只有来自这些地址的X-Forwarded-For才会用于识别客户端IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type RedisConfig struct {
@@ -41,10 +45,73 @@ type SMTPConfig struct {
 	From     string `yaml:"from"`     // 发件人邮箱地址
 }
 
+// JWTKey 非对称签名密钥，通过not_before和not_after安排轮换
+type JWTKey struct {
+	ID         string `mapstructure:"id"`          // 密钥ID，写入令牌头的kid
+	Algorithm  string `mapstructure:"algorithm"`   // RS256或EdDSA
+	PrivateKey string `mapstructure:"private_key"` // PEM格式私钥文件路径
+	NotBefore  string `mapstructure:"not_before"`  // 开始用于签名的时间（RFC3339），为空表示立即生效
+	NotAfter   string `mapstructure:"not_after"`   // 停止验证并从JWKS移除的时间（RFC3339），为空表示不过期
+}
+
 // JWTConfig JWT配置
 type JWTConfig struct {
-	SecretKey string        `mapstructure:"secret_key"` // JWT密钥
-	Expire    time.Duration `mapstructure:"expire"`     // 过期时间（小时）
+	SecretKey        string        `mapstructure:"secret_key"`         // HS256密钥，未配置keys时用于签名和验证
+	Expire           time.Duration `mapstructure:"expire"`             // 登录会话即刷新令牌的有效期（小时）
+	AccessExpire     time.Duration `mapstructure:"access_expire"`      // 访问令牌有效期（分钟）
+	Keys             []JWTKey      `mapstructure:"keys"`               // 非对称签名密钥，为空时使用secret_key签名
+	LegacyHS256Until string        `mapstructure:"legacy_hs256_until"` // 配置keys后继续接受迁移前HS256令牌的截止时间（RFC3339），为空表示不接受
+}
+
+// ModelPrice 模型单价，按每百万token计价
+type ModelPrice struct {
+	Model      string  `mapstructure:"model"`      // 模型名称
+	Prompt     float64 `mapstructure:"prompt"`     // 输入token单价
+	Completion float64 `mapstructure:"completion"` // 输出token单价
+}
+
+// UsageConfig 用量计费配置
+type UsageConfig struct {
+	Currency string       `mapstructure:"currency"` // 计价货币
+	Prices   []ModelPrice `mapstructure:"prices"`   // 模型价格表
+}
+
+// QuotaLimits 配额限制，0表示不限制
+type QuotaLimits struct {
+	MessagesPerDay int `mapstructure:"messages_per_day"` // 每日消息数
+	TokensPerMonth int `mapstructure:"tokens_per_month"` // 每月token数
+	ConcurrentJobs int `mapstructure:"concurrent_jobs"`  // 同时进行的生成任务数
+}
+
+// RoleQuota 角色配额，未设置的项沿用默认配额
+type RoleQuota struct {
+	MessagesPerDay *int `mapstructure:"messages_per_day"`
+	TokensPerMonth *int `mapstructure:"tokens_per_month"`
+	ConcurrentJobs *int `mapstructure:"concurrent_jobs"`
+}
+
+// QuotaConfig 配额配置
+type QuotaConfig struct {
+	Default   QuotaLimits          `mapstructure:"default"`   // 默认配额，可被角色配额和用户级配额覆盖
+	Roles     map[string]RoleQuota `mapstructure:"roles"`     // 按角色名覆盖默认配额，用户级配额优先
+	Workspace QuotaLimits          `mapstructure:"workspace"` // 工作区默认配额，可被工作区级配额覆盖，不限制并发任务数
+}
+
+// AdminConfig 管理员配置
+type AdminConfig struct {
+	Users []string `mapstructure:"users"` // 始终拥有全部管理权限的用户名，用于初始化管理员
+}
+
+// OIDCConfig OpenID Connect单点登录配置，issuer为空时不启用
+type OIDCConfig struct {
+	Issuer        string   `mapstructure:"issuer"`         // 身份提供方地址，从{issuer}/.well-known/openid-configuration读取端点
+	ClientID      string   `mapstructure:"client_id"`      // 在身份提供方注册的客户端ID
+	ClientSecret  string   `mapstructure:"client_secret"`  // 客户端密钥，公共客户端可为空
+	RedirectURL   string   `mapstructure:"redirect_url"`   // 回调地址，即本服务的/api/v1/auth/oidc/callback
+	Scopes        []string `mapstructure:"scopes"`         // 申请的scope，必须包含openid
+	UsernameClaim string   `mapstructure:"username_claim"` // 用作用户名的claim
+	EmailClaim    string   `mapstructure:"email_claim"`    // 用作邮箱的claim
+	NameClaim     string   `mapstructure:"name_claim"`     // 用作显示名称的claim
 }
 
 type Config struct {
@@ -54,6 +121,10 @@ type Config struct {
 	Redis RedisConfig `mapstructure:"redis"`
 	Email SMTPConfig  `mapstructure:"email"`
 	JWT   JWTConfig   `mapstructure:"jwt"`
+	Usage UsageConfig `mapstructure:"usage"`
+	Quota QuotaConfig `mapstructure:"quota"`
+	Admin AdminConfig `mapstructure:"admin"`
+	OIDC  OIDCConfig  `mapstructure:"oidc"`
 }
 
 var cfg *Config
@@ -68,6 +139,13 @@ func Init() (*Config, error) {
 	viper.SetEnvPrefix("DAVLIN")
 
 	viper.SetDefault("app.port", 8080)
+	viper.SetDefault("usage.currency", "USD")
+	viper.SetDefault("jwt.expire", 168)
+	viper.SetDefault("jwt.access_expire", 15)
+	viper.SetDefault("oidc.scopes", []string{"openid", "email", "profile"})
+	viper.SetDefault("oidc.username_claim", "preferred_username")
+	viper.SetDefault("oidc.email_claim", "email")
+	viper.SetDefault("oidc.name_claim", "name")
 
 	// 读取环境变量
 	viper.AutomaticEnv()
@@ -0,0 +1,425 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController 定义管理员控制器接口
+type AdminController interface {
+	ListUsers(c *gin.Context)
+	GetUser(c *gin.Context)
+	SetRole(c *gin.Context)
+	DisableUser(c *gin.Context)
+	EnableUser(c *gin.Context)
+	GetQuota(c *gin.Context)
+	SetQuota(c *gin.Context)
+	ResetQuota(c *gin.Context)
+	GetWorkspaceQuota(c *gin.Context)
+	SetWorkspaceQuota(c *gin.Context)
+	ListRoles(c *gin.Context)
+	CreateRole(c *gin.Context)
+	UpdateRole(c *gin.Context)
+	DeleteRole(c *gin.Context)
+	ListModels(c *gin.Context)
+	SetModel(c *gin.Context)
+	DeleteModel(c *gin.Context)
+}
+
+// adminController 实现AdminController接口的结构体
+type adminController struct {
+	adminService service.AdminService
+	roleService  service.RoleService
+	quotaService service.QuotaService
+	modelCatalog service.ModelCatalog
+}
+
+// NewAdminController 创建管理员控制器实例
+func NewAdminController(adminService service.AdminService, roleService service.RoleService, quotaService service.QuotaService, modelCatalog service.ModelCatalog) AdminController {
+	return &adminController{
+		adminService: adminService,
+		roleService:  roleService,
+		quotaService: quotaService,
+		modelCatalog: modelCatalog,
+	}
+}
+
+// ListUsers 分页查询用户，支持按关键词、角色和停用状态过滤
+func (ctrl *adminController) ListUsers(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+	filter := service.UserFilter{Search: c.Query("search"), Role: c.Query("role")}
+	if value := c.Query("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的disabled参数"})
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	users, err := ctrl.adminService.ListUsers(filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser 获取用户资料和生效的权限
+func (ctrl *adminController) GetUser(c *gin.Context) {
+	userID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := ctrl.adminService.GetUser(userID)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	permissions, err := ctrl.roleService.Permissions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "permissions": permissions})
+}
+
+// SetRole 修改用户角色
+func (ctrl *adminController) SetRole(c *gin.Context) {
+	userID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供角色"})
+		return
+	}
+
+	user, err := ctrl.adminService.SetRole(c.Request.Context(), c.GetUint("user_id"), userID, request.Role)
+	if err != nil {
+		if errors.Is(err, service.ErrRoleNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DisableUser 停用账户并撤销其登录会话
+func (ctrl *adminController) DisableUser(c *gin.Context) {
+	ctrl.setDisabled(c, true)
+}
+
+// EnableUser 重新启用账户
+func (ctrl *adminController) EnableUser(c *gin.Context) {
+	ctrl.setDisabled(c, false)
+}
+
+func (ctrl *adminController) setDisabled(c *gin.Context, disabled bool) {
+	userID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := ctrl.adminService.SetDisabled(c.Request.Context(), c.GetUint("user_id"), userID, disabled)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// GetQuota 获取用户生效的配额和用户级配额
+func (ctrl *adminController) GetQuota(c *gin.Context) {
+	userID, ok := ctrl.existingUser(c)
+	if !ok {
+		return
+	}
+
+	limits, err := ctrl.quotaService.GetLimits(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	override, err := ctrl.quotaService.GetOverride(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limits": limits, "override": override})
+}
+
+// SetQuota 设置用户级配额，省略的字段使用默认配额，0表示不限制
+func (ctrl *adminController) SetQuota(c *gin.Context) {
+	userID, ok := ctrl.existingUser(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		MessagesPerDay *int `json:"messages_per_day" binding:"omitempty,min=0"`
+		TokensPerMonth *int `json:"tokens_per_month" binding:"omitempty,min=0"`
+		ConcurrentJobs *int `json:"concurrent_jobs" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的配额参数"})
+		return
+	}
+
+	override := &model.UserQuota{
+		UserID:         userID,
+		MessagesPerDay: request.MessagesPerDay,
+		TokensPerMonth: request.TokensPerMonth,
+		ConcurrentJobs: request.ConcurrentJobs,
+	}
+	if err := ctrl.quotaService.SetOverride(override); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	limits, err := ctrl.quotaService.GetLimits(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limits": limits, "override": override})
+}
+
+// ResetQuota 清零用户当天的消息数和本月的token用量
+func (ctrl *adminController) ResetQuota(c *gin.Context) {
+	userID, ok := ctrl.existingUser(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.quotaService.ResetUsage(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "配额用量已重置"})
+}
+
+// GetWorkspaceQuota 获取工作区生效的配额和工作区级配额
+func (ctrl *adminController) GetWorkspaceQuota(c *gin.Context) {
+	workspaceID, ok := ctrl.existingWorkspace(c)
+	if !ok {
+		return
+	}
+
+	limits, err := ctrl.quotaService.GetWorkspaceLimits(workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	override, err := ctrl.quotaService.GetWorkspaceOverride(workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limits": limits, "override": override})
+}
+
+// SetWorkspaceQuota 设置工作区级配额，省略的字段使用工作区默认配额，0表示不限制
+func (ctrl *adminController) SetWorkspaceQuota(c *gin.Context) {
+	workspaceID, ok := ctrl.existingWorkspace(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		MessagesPerDay *int `json:"messages_per_day" binding:"omitempty,min=0"`
+		TokensPerMonth *int `json:"tokens_per_month" binding:"omitempty,min=0"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的配额参数"})
+		return
+	}
+
+	override := &model.WorkspaceQuota{
+		WorkspaceID:    workspaceID,
+		MessagesPerDay: request.MessagesPerDay,
+		TokensPerMonth: request.TokensPerMonth,
+	}
+	if err := ctrl.quotaService.SetWorkspaceOverride(override); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	limits, err := ctrl.quotaService.GetWorkspaceLimits(workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limits": limits, "override": override})
+}
+
+// existingWorkspace 解析路径中的工作区ID并确认工作区存在
+func (ctrl *adminController) existingWorkspace(c *gin.Context) (uint, bool) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return 0, false
+	}
+	if _, err := ctrl.adminService.GetWorkspace(workspaceID); err != nil {
+		respondAdminError(c, err)
+		return 0, false
+	}
+	return workspaceID, true
+}
+
+// existingUser 解析路径中的用户ID并确认用户存在
+func (ctrl *adminController) existingUser(c *gin.Context) (uint, bool) {
+	userID, ok := paramID(c, "id")
+	if !ok {
+		return 0, false
+	}
+	if _, err := ctrl.adminService.GetUser(userID); err != nil {
+		respondAdminError(c, err)
+		return 0, false
+	}
+	return userID, true
+}
+
+// ListRoles 列出内置角色和自定义角色
+func (ctrl *adminController) ListRoles(c *gin.Context) {
+	roles, err := ctrl.roleService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// roleRequest 创建和修改角色的请求
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// CreateRole 创建自定义角色
+func (ctrl *adminController) CreateRole(c *gin.Context) {
+	var request roleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色参数"})
+		return
+	}
+
+	role, err := ctrl.roleService.CreateRole(request.Name, request.Description, request.Permissions)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole 修改自定义角色的说明和权限
+func (ctrl *adminController) UpdateRole(c *gin.Context) {
+	var request roleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色参数"})
+		return
+	}
+
+	role, err := ctrl.roleService.UpdateRole(c.Param("name"), request.Description, request.Permissions)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole 删除没有用户使用的自定义角色
+func (ctrl *adminController) DeleteRole(c *gin.Context) {
+	if err := ctrl.roleService.DeleteRole(c.Param("name")); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "角色已删除"})
+}
+
+// ListModels 列出网关模型，包括已停用的
+func (ctrl *adminController) ListModels(c *gin.Context) {
+	models, err := ctrl.modelCatalog.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models)
+}
+
+// SetModel 添加模型或启用、停用模型，模型名称可以包含/
+func (ctrl *adminController) SetModel(c *gin.Context) {
+	var request struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供enabled"})
+		return
+	}
+
+	info, err := ctrl.modelCatalog.SetEnabled(modelParam(c), *request.Enabled)
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// DeleteModel 删除管理员添加的模型
+func (ctrl *adminController) DeleteModel(c *gin.Context) {
+	if err := ctrl.modelCatalog.Delete(modelParam(c)); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "模型已删除"})
+}
+
+// modelParam 从通配路径参数中取模型名称
+func modelParam(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("name"), "/")
+}
+
+// respondAdminError 将管理操作的错误转换为响应
+func respondAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrRoleNotFound),
+		errors.Is(err, service.ErrModelNotFound), errors.Is(err, service.ErrWorkspaceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrExceedsActor):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrModifySelf), errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, service.ErrInvalidModel), errors.Is(err, service.ErrBuiltinModel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyController 定义个人API密钥控制器接口
+type APIKeyController interface {
+	CreateKey(c *gin.Context)
+	ListKeys(c *gin.Context)
+	RevokeKey(c *gin.Context)
+}
+
+// apiKeyController 实现APIKeyController接口的结构体
+type apiKeyController struct {
+	apiKeyService service.APIKeyService
+}
+
+// NewAPIKeyController 创建API密钥控制器实例
+func NewAPIKeyController(apiKeyService service.APIKeyService) APIKeyController {
+	return &apiKeyController{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateKey 创建API密钥，明文密钥只在响应中返回一次
+func (ctrl *apiKeyController) CreateKey(c *gin.Context) {
+	var request struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	options := service.APIKeyOptions{Name: request.Name, Scopes: request.Scopes}
+	if request.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		options.ExpiresAt = &expiresAt
+	}
+	key, plaintext, err := ctrl.apiKeyService.Create(c.GetUint("user_id"), options)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     key.Scopes,
+		"expires_at": key.ExpiresAt,
+		"created_at": key.CreatedAt,
+		"key":        plaintext,
+	})
+}
+
+// ListKeys 分页列出当前用户未撤销的API密钥，不包含明文
+func (ctrl *apiKeyController) ListKeys(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	keys, err := ctrl.apiKeyService.List(c.GetUint("user_id"), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeKey 撤销API密钥
+func (ctrl *apiKeyController) RevokeKey(c *gin.Context) {
+	keyID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.apiKeyService.Revoke(c.GetUint("user_id"), keyID); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API密钥已撤销"})
+}
@@ -1,9 +1,15 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
 	"github.com/davlin-coder/davlin/internal/service"
 	"github.com/gin-gonic/gin"
 )
@@ -12,45 +18,385 @@ import (
 type ChatController interface {
 	SendMessage(c *gin.Context)
 	GetChatHistory(c *gin.Context)
+	ListConversations(c *gin.Context)
+	Regenerate(c *gin.Context)
+	EditMessage(c *gin.Context)
+	GetConversationMessages(c *gin.Context)
+	SwitchBranch(c *gin.Context)
+	CancelGeneration(c *gin.Context)
+	RenameConversation(c *gin.Context)
+	Search(c *gin.Context)
 }
 
 // chatController 实现ChatController接口的结构体
 type chatController struct {
-	chatService service.ChatService
+	chatService   service.ChatService
+	searchService service.SearchService
 }
 
 // NewChatController 创建聊天控制器实例
-func NewChatController(chatService service.ChatService) ChatController {
+func NewChatController(chatService service.ChatService, searchService service.SearchService) ChatController {
 	return &chatController{
-		chatService: chatService,
+		chatService:   chatService,
+		searchService: searchService,
 	}
 }
 
 // SendMessage 发送聊天消息
 func (ctrl *chatController) SendMessage(c *gin.Context) {
-	var message model.ChatMessage
-	if err := c.ShouldBindJSON(&message); err != nil {
+	var request struct {
+		ConversationID uint   `json:"conversation_id"`
+		Content        string `json:"content" binding:"required"`
+		PromptID       uint   `json:"prompt_id"`
+		WorkspaceID    uint   `json:"workspace_id"`
+		Stream         bool   `json:"stream"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息格式"})
 		return
 	}
 
-	response, err := ctrl.chatService.SendMessage(&message)
+	message := model.ChatMessage{
+		UserID:         c.GetUint("user_id"),
+		ConversationID: request.ConversationID,
+		Content:        request.Content,
+	}
+	opts := service.SendOptions{
+		PromptID:    request.PromptID,
+		WorkspaceID: request.WorkspaceID,
+		Locale:      requestLocale(c),
+	}
+	respondGeneration(c, request.Stream, opts, func(opts service.SendOptions) (map[string]interface{}, error) {
+		return ctrl.chatService.SendMessage(c.Request.Context(), &message, opts)
+	})
+}
+
+// GetChatHistory 分页获取聊天历史
+func (ctrl *chatController) GetChatHistory(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	history, err := ctrl.chatService.GetHistory(userID, includeTrace(c), page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, history)
 }
 
-// GetChatHistory 获取聊天历史
-func (ctrl *chatController) GetChatHistory(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	history, err := ctrl.chatService.GetHistory(userID)
+// Regenerate 重新生成指定的助手回复
+func (ctrl *chatController) Regenerate(c *gin.Context) {
+	messageID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		PromptID uint `json:"prompt_id"`
+		Stream   bool `json:"stream"`
+	}
+	// 请求体可以为空
+	_ = c.ShouldBindJSON(&request)
+
+	opts := service.SendOptions{
+		PromptID: request.PromptID,
+		Locale:   requestLocale(c),
+	}
+	respondGeneration(c, request.Stream, opts, func(opts service.SendOptions) (map[string]interface{}, error) {
+		return ctrl.chatService.Regenerate(c.Request.Context(), c.GetUint("user_id"), messageID, opts)
+	})
+}
+
+// EditMessage 修改用户消息并从该处分叉出新分支
+func (ctrl *chatController) EditMessage(c *gin.Context) {
+	messageID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Content  string `json:"content" binding:"required"`
+		PromptID uint   `json:"prompt_id"`
+		Stream   bool   `json:"stream"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息格式"})
+		return
+	}
+
+	opts := service.SendOptions{
+		PromptID: request.PromptID,
+		Locale:   requestLocale(c),
+	}
+	respondGeneration(c, request.Stream, opts, func(opts service.SendOptions) (map[string]interface{}, error) {
+		return ctrl.chatService.EditMessage(c.Request.Context(), c.GetUint("user_id"), messageID, request.Content, opts)
+	})
+}
+
+// ListConversations 分页获取当前用户的个人会话，指定workspace_id时获取工作区的会话
+func (ctrl *chatController) ListConversations(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+	workspaceID, ok := queryID(c, "workspace_id")
+	if !ok {
+		return
+	}
+
+	conversations, err := ctrl.chatService.ListConversations(c.GetUint("user_id"), workspaceID, page)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, conversations)
+}
+
+// GetConversationMessages 获取会话当前分支的消息
+func (ctrl *chatController) GetConversationMessages(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	messages, err := ctrl.chatService.GetConversationMessages(c.GetUint("user_id"), conversationID, includeTrace(c))
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// SwitchBranch 切换会话的当前分支
+func (ctrl *chatController) SwitchBranch(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		MessageID uint `json:"message_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	if err := ctrl.chatService.SwitchBranch(c.GetUint("user_id"), conversationID, request.MessageID); err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已切换分支"})
+}
+
+// CancelGeneration 取消会话正在进行的生成
+func (ctrl *chatController) CancelGeneration(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.chatService.CancelGeneration(c.Request.Context(), c.GetUint("user_id"), conversationID); err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已取消"})
+}
+
+// RenameConversation 修改会话标题
+func (ctrl *chatController) RenameConversation(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Title string `json:"title" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	if err := ctrl.chatService.RenameConversation(c.GetUint("user_id"), conversationID, request.Title); err != nil {
+		if errors.Is(err, service.ErrConversationNotFound) {
+			respondChatError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功"})
+}
+
+// Search 全文搜索当前用户的消息
+func (ctrl *chatController) Search(c *gin.Context) {
+	query := service.SearchQuery{
+		UserID: c.GetUint("user_id"),
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+	}
+	if strings.TrimSpace(query.Query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "搜索关键词不能为空"})
+		return
+	}
+	if query.Role != "" && query.Role != "user" && query.Role != "assistant" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色"})
+		return
+	}
+	var ok bool
+	if query.From, query.To, ok = bindDateRange(c); !ok {
+		return
+	}
+	if query.ConversationID, ok = queryID(c, "conversation_id"); !ok {
+		return
+	}
+	if query.Page, ok = bindPage(c); !ok {
+		return
+	}
+
+	result, err := ctrl.searchService.Search(query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, history)
-}
\ No newline at end of file
+	c.JSON(http.StatusOK, result)
+}
+
+// titleWaitTimeout 流式响应结束后等待会话标题的最长时间
+const titleWaitTimeout = 15 * time.Second
+
+// respondGeneration 执行生成并返回结果，stream为true时以SSE推送回复片段，
+// 客户端断开连接会取消请求上下文，从而取消生成
+func respondGeneration(c *gin.Context, stream bool, opts service.SendOptions, generate func(service.SendOptions) (map[string]interface{}, error)) {
+	if !stream {
+		response, err := generate(opts)
+		if err != nil {
+			respondChatError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// 标题事件在后台goroutine中产生，写入需要加锁，请求结束后不再写入
+	var mu sync.Mutex
+	finished := false
+	titleReady := make(chan struct{})
+	var titleOnce sync.Once
+	opts.OnEvent = func(event service.ChatEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if finished {
+			return
+		}
+		if !c.Writer.Written() {
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+		}
+		c.SSEvent(event.Type, event.Data)
+		c.Writer.Flush()
+		if event.Type == "title" {
+			titleOnce.Do(func() { close(titleReady) })
+		}
+	}
+	defer func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+	}()
+
+	response, err := generate(opts)
+	mu.Lock()
+	if err != nil {
+		// 尚未开始推送时仍返回普通的错误响应
+		if !c.Writer.Written() {
+			respondChatError(c, err)
+		} else {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			c.Writer.Flush()
+		}
+		mu.Unlock()
+		return
+	}
+	c.SSEvent("done", response)
+	c.Writer.Flush()
+	mu.Unlock()
+
+	// 首轮对话保持连接直到标题生成完成
+	if pending, _ := response["title_pending"].(bool); pending {
+		select {
+		case <-titleReady:
+		case <-c.Request.Context().Done():
+		case <-time.After(titleWaitTimeout):
+		}
+	}
+}
+
+// respondChatError 将聊天服务的错误转换为对应的HTTP状态码
+func respondChatError(c *gin.Context, err error) {
+	if quotaErr, ok := service.IsQuotaExceeded(err); ok {
+		respondQuotaExceeded(c, quotaErr)
+		return
+	}
+	if errors.Is(err, service.ErrConversationNotFound) || errors.Is(err, service.ErrMessageNotFound) ||
+		errors.Is(err, service.ErrWorkspaceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrWorkspaceForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrGenerationInProgress) || errors.Is(err, service.ErrNoActiveGeneration) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// respondQuotaExceeded 返回429及配额重置时间
+func respondQuotaExceeded(c *gin.Context, err *service.QuotaExceededError) {
+	body := gin.H{"error": err.Error(), "limit": err.Limit}
+	if !err.ResetAt.IsZero() {
+		body["reset_at"] = err.ResetAt
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(err.ResetAt).Seconds())+1))
+	}
+	c.JSON(http.StatusTooManyRequests, body)
+}
+
+// includeTrace 判断请求是否通过include=trace要求返回执行步骤
+func includeTrace(c *gin.Context) bool {
+	for _, include := range strings.Split(c.Query("include"), ",") {
+		if strings.TrimSpace(include) == "trace" {
+			return true
+		}
+	}
+	return false
+}
+
+// bindPage 解析cursor和limit查询参数
+func bindPage(c *gin.Context) (pagination.Page, bool) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	page, err := pagination.NewPage(c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return page, false
+	}
+	return page, true
+}
+
+// requestLocale 从Accept-Language请求头中取首选语言区域
+func requestLocale(c *gin.Context) string {
+	locale := c.GetHeader("Accept-Language")
+	if i := strings.IndexAny(locale, ",;"); i >= 0 {
+		locale = locale[:i]
+	}
+	return strings.TrimSpace(locale)
+}
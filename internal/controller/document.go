@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// documentUploadMaxSize 上传请求的最大字节数，文档内容的限制由服务层校验
+const documentUploadMaxSize = 2 << 20
+
+// DocumentController 定义工作区文档控制器接口
+type DocumentController interface {
+	Upload(c *gin.Context)
+	List(c *gin.Context)
+	Get(c *gin.Context)
+	Delete(c *gin.Context)
+	Search(c *gin.Context)
+}
+
+// documentController 实现DocumentController接口的结构体
+type documentController struct {
+	documentService service.DocumentService
+}
+
+// NewDocumentController 创建工作区文档控制器实例
+func NewDocumentController(documentService service.DocumentService) DocumentController {
+	return &documentController{
+		documentService: documentService,
+	}
+}
+
+// Upload 上传文本文档到工作区知识库，文件通过multipart的file字段上传
+func (ctrl *documentController) Upload(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, documentUploadMaxSize)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传文档"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文档失败"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文档失败"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		name = header.Filename
+	}
+	contentType, _, _ := strings.Cut(header.Header.Get("Content-Type"), ";")
+	document, err := ctrl.documentService.Upload(c.GetUint("user_id"), workspaceID, name, strings.TrimSpace(contentType), data)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, document)
+}
+
+// List 分页列出工作区文档
+func (ctrl *documentController) List(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	documents, err := ctrl.documentService.List(c.GetUint("user_id"), workspaceID, page)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, documents)
+}
+
+// Get 获取文档内容
+func (ctrl *documentController) Get(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	documentID, ok := paramID(c, "document_id")
+	if !ok {
+		return
+	}
+
+	document, err := ctrl.documentService.Get(c.GetUint("user_id"), workspaceID, documentID)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// Delete 删除文档
+func (ctrl *documentController) Delete(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	documentID, ok := paramID(c, "document_id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.documentService.Delete(c.GetUint("user_id"), workspaceID, documentID); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "文档已删除"})
+}
+
+// Search 按关键词检索工作区知识库
+func (ctrl *documentController) Search(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供搜索关键词"})
+		return
+	}
+
+	snippets, err := ctrl.documentService.Search(c.Request.Context(), c.GetUint("user_id"), workspaceID, query)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, snippets)
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportController 定义会话导出控制器接口
+type ExportController interface {
+	ExportConversation(c *gin.Context)
+	ExportAll(c *gin.Context)
+}
+
+// exportController 实现ExportController接口的结构体
+type exportController struct {
+	exportService service.ExportService
+}
+
+// NewExportController 创建会话导出控制器实例
+func NewExportController(exportService service.ExportService) ExportController {
+	return &exportController{
+		exportService: exportService,
+	}
+}
+
+// ExportConversation 按format参数导出单个会话，默认为Markdown
+func (ctrl *exportController) ExportConversation(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	file, err := ctrl.exportService.ExportConversation(c.GetUint("user_id"), conversationID, c.DefaultQuery("format", service.ExportMarkdown))
+	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondChatError(c, err)
+		return
+	}
+
+	setAttachment(c, file.Name)
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
+
+// ExportAll 将全部会话导出并打包为zip
+func (ctrl *exportController) ExportAll(c *gin.Context) {
+	format := c.DefaultQuery("format", service.ExportMarkdown)
+	if format != service.ExportMarkdown && format != service.ExportJSON && format != service.ExportPDF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrUnsupportedFormat.Error()})
+		return
+	}
+
+	setAttachment(c, fmt.Sprintf("conversations-%s.zip", time.Now().Format("20060102")))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := ctrl.exportService.ExportAll(c.GetUint("user_id"), format, c.Writer); err != nil {
+		// 响应已开始写入，只能中断连接
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+// setAttachment 设置下载文件名，兼容非ASCII文件名
+func setAttachment(c *gin.Context, name string) {
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q; filename*=UTF-8''%s", "export"+path.Ext(name), url.PathEscape(name)))
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// FeedbackController 定义消息反馈控制器接口
+type FeedbackController interface {
+	SubmitFeedback(c *gin.Context)
+	DeleteFeedback(c *gin.Context)
+	ExportFeedback(c *gin.Context)
+}
+
+// feedbackController 实现FeedbackController接口的结构体
+type feedbackController struct {
+	feedbackService service.FeedbackService
+}
+
+// NewFeedbackController 创建消息反馈控制器实例
+func NewFeedbackController(feedbackService service.FeedbackService) FeedbackController {
+	return &feedbackController{
+		feedbackService: feedbackService,
+	}
+}
+
+// SubmitFeedback 评价助手回复，重复提交时覆盖之前的评价
+func (ctrl *feedbackController) SubmitFeedback(c *gin.Context) {
+	messageID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Rating  string   `json:"rating" binding:"required"`
+		Reasons []string `json:"reasons"`
+		Comment string   `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	feedback, err := ctrl.feedbackService.Submit(c.GetUint("user_id"), messageID, service.FeedbackInput{
+		Rating:  request.Rating,
+		Reasons: request.Reasons,
+		Comment: request.Comment,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, feedback)
+}
+
+// DeleteFeedback 撤回对助手回复的评价
+func (ctrl *feedbackController) DeleteFeedback(c *gin.Context) {
+	messageID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.feedbackService.Delete(c.GetUint("user_id"), messageID); err != nil {
+		if errors.Is(err, service.ErrFeedbackNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "评价已撤回"})
+}
+
+// ExportFeedback 导出有评价的样本为JSONL，支持按日期、评分、模型和提示词版本筛选
+func (ctrl *feedbackController) ExportFeedback(c *gin.Context) {
+	from, to, ok := bindDateRange(c)
+	if !ok {
+		return
+	}
+	promptVersionID, ok := queryID(c, "prompt_version_id")
+	if !ok {
+		return
+	}
+	rating := c.Query("rating")
+	if rating != "" && rating != model.FeedbackUp && rating != model.FeedbackDown {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "评分只能是up或down"})
+		return
+	}
+
+	setAttachment(c, fmt.Sprintf("feedback-%s.jsonl", time.Now().Format("20060102")))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	err := ctrl.feedbackService.Export(service.FeedbackQuery{
+		From:            from,
+		To:              to,
+		Rating:          rating,
+		Model:           c.Query("model"),
+		PromptVersionID: promptVersionID,
+	}, c.Writer)
+	if err != nil {
+		// 响应已开始写入，只能中断连接
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// importMaxSize 导入文件的最大字节数
+const importMaxSize = 50 << 20
+
+// ImportController 定义会话导入控制器接口
+type ImportController interface {
+	Import(c *gin.Context)
+	GetJob(c *gin.Context)
+}
+
+// importController 实现ImportController接口的结构体
+type importController struct {
+	importService service.ImportService
+}
+
+// NewImportController 创建会话导入控制器实例
+func NewImportController(importService service.ImportService) ImportController {
+	return &importController{
+		importService: importService,
+	}
+}
+
+// Import 上传导入文件并创建后台导入任务，文件通过multipart的file字段上传
+func (ctrl *importController) Import(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importMaxSize)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传导入文件"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取导入文件失败"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取导入文件失败"})
+		return
+	}
+
+	job, err := ctrl.importService.Start(c.GetUint("user_id"), c.PostForm("format"), data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetJob 查询导入任务进度
+func (ctrl *importController) GetJob(c *gin.Context) {
+	jobID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := ctrl.importService.GetJob(c.GetUint("user_id"), jobID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
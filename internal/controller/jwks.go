@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSController 公开令牌验证公钥的控制器接口
+type JWKSController interface {
+	Keys(c *gin.Context)
+}
+
+// jwksController 实现JWKSController接口的结构体
+type jwksController struct {
+	jwtManager *tools.JWTManager
+}
+
+// NewJWKSController 创建JWKS控制器实例
+func NewJWKSController(jwtManager *tools.JWTManager) JWKSController {
+	return &jwksController{jwtManager: jwtManager}
+}
+
+// Keys 返回JWKS，其他服务据此按kid验证Davlin签发的令牌
+func (ctrl *jwksController) Keys(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, ctrl.jwtManager.JWKS())
+}
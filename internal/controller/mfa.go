@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// MFAController 定义两步验证管理控制器接口
+type MFAController interface {
+	Enroll(c *gin.Context)
+	Confirm(c *gin.Context)
+	Disable(c *gin.Context)
+	RegenerateRecoveryCodes(c *gin.Context)
+}
+
+// mfaController 实现MFAController接口的结构体
+type mfaController struct {
+	mfaService service.MFAService
+}
+
+// NewMFAController 创建两步验证控制器实例
+func NewMFAController(mfaService service.MFAService) MFAController {
+	return &mfaController{
+		mfaService: mfaService,
+	}
+}
+
+// Enroll 生成TOTP密钥和otpauth地址，需调用Confirm确认后才生效
+func (ctrl *mfaController) Enroll(c *gin.Context) {
+	enrollment, err := ctrl.mfaService.Enroll(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm 校验认证器生成的口令并开启两步验证，恢复码只在此时返回一次
+func (ctrl *mfaController) Confirm(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供动态口令"})
+		return
+	}
+
+	codes, err := ctrl.mfaService.Confirm(c.Request.Context(), c.GetUint("user_id"), request.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已开启", "recovery_codes": codes})
+}
+
+// Disable 校验密码和口令后关闭两步验证
+func (ctrl *mfaController) Disable(c *gin.Context) {
+	var request struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供当前密码和动态口令"})
+		return
+	}
+
+	if err := ctrl.mfaService.Disable(c.Request.Context(), c.GetUint("user_id"), request.Password, request.Code); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部失效
+func (ctrl *mfaController) RegenerateRecoveryCodes(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供动态口令"})
+		return
+	}
+
+	codes, err := ctrl.mfaService.RegenerateRecoveryCodes(c.Request.Context(), c.GetUint("user_id"), request.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// respondMFAError 将两步验证错误映射为HTTP状态码
+func respondMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFANotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrMFAEnrollmentExpired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondAccountError(c, err)
+	}
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcStateCookie 保存state的cookie，回调时确认登录由同一浏览器发起
+	oidcStateCookie = "davlin_oidc_state"
+	oidcCookiePath  = "/api/v1/auth/oidc"
+	// oidcStateMaxAge cookie有效秒数，与服务端保存state的时间一致
+	oidcStateMaxAge = 600
+)
+
+// OIDCController 定义单点登录控制器接口
+type OIDCController interface {
+	Login(c *gin.Context)
+	Callback(c *gin.Context)
+}
+
+// oidcController 实现OIDCController接口的结构体
+type oidcController struct {
+	oidcService service.OIDCService
+}
+
+// NewOIDCController 创建单点登录控制器实例
+func NewOIDCController(oidcService service.OIDCService) OIDCController {
+	return &oidcController{
+		oidcService: oidcService,
+	}
+}
+
+// Login 跳转到身份提供方的授权页面
+func (ctrl *oidcController) Login(c *gin.Context) {
+	authURL, state, err := ctrl.oidcService.Begin(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrOIDCDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, oidcStateMaxAge, oidcCookiePath, "", secureRequest(c), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 处理身份提供方的回调，登录结果通过URL片段交给前端
+func (ctrl *oidcController) Callback(c *gin.Context) {
+	if !ctrl.oidcService.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrOIDCDisabled.Error()})
+		return
+	}
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", secureRequest(c), true)
+
+	result := url.Values{}
+	state := c.Query("state")
+	switch {
+	case c.Query("error") != "":
+		result.Set("error", "身份提供方拒绝了登录请求")
+	case state == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1:
+		result.Set("error", service.ErrInvalidOIDCState.Error())
+	default:
+		tokens, err := ctrl.oidcService.Complete(c.Request.Context(), state, c.Query("code"))
+		if mfaErr, ok := service.IsMFARequired(err); ok {
+			result.Set("mfa_required", "true")
+			result.Set("mfa_token", mfaErr.Token)
+			result.Set("expires_in", strconv.FormatInt(int64(mfaErr.ExpiresIn.Seconds()), 10))
+		} else if err != nil {
+			log.Printf("单点登录失败: %v", err)
+			result.Set("error", oidcErrorMessage(err))
+		} else {
+			result.Set("access_token", tokens.AccessToken)
+			result.Set("refresh_token", tokens.RefreshToken)
+			result.Set("token_type", tokens.TokenType)
+			result.Set("expires_in", strconv.FormatInt(tokens.ExpiresIn, 10))
+		}
+	}
+
+	c.Redirect(http.StatusFound, ctrl.oidcService.RedirectURL(result))
+}
+
+// oidcErrorMessage 只向前端展示用户可处理的错误，其余错误细节记录在日志中
+func oidcErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrInvalidOIDCState), errors.Is(err, service.ErrOIDCEmailMissing),
+		errors.Is(err, service.ErrOIDCEmailUnverified), errors.Is(err, service.ErrAccountDisabled):
+		return err.Error()
+	default:
+		return "单点登录失败"
+	}
+}
+
+// secureRequest 请求是否经由HTTPS到达，决定cookie是否设置Secure
+func secureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
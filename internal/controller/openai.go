@@ -0,0 +1,472 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAIController 定义OpenAI兼容接口控制器
+type OpenAIController interface {
+	ChatCompletions(c *gin.Context)
+	ListModels(c *gin.Context)
+}
+
+// openAIController 实现OpenAIController接口的结构体
+type openAIController struct {
+	gatewayService service.GatewayService
+}
+
+// NewOpenAIController 创建OpenAI兼容接口控制器实例
+func NewOpenAIController(gatewayService service.GatewayService) OpenAIController {
+	return &openAIController{
+		gatewayService: gatewayService,
+	}
+}
+
+// openAIRequest OpenAI格式的补全请求，只包含网关支持的字段
+type openAIRequest struct {
+	Model         string          `json:"model" binding:"required"`
+	Messages      []openAIMessage `json:"messages" binding:"required,min=1"`
+	Stream        bool            `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	Tools               []openAITool    `json:"tools"`
+	ToolChoice          json.RawMessage `json:"tool_choice"`
+	Temperature         *float32        `json:"temperature"`
+	TopP                *float32        `json:"top_p"`
+	MaxTokens           *int            `json:"max_tokens"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens"`
+	Stop                json.RawMessage `json:"stop"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content,omitempty"` // 字符串或内容片段数组
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL *struct {
+		URL    string `json:"url"`
+		Detail string `json:"detail"`
+	} `json:"image_url"`
+}
+
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+// openAIResponseMessage 响应中的助手消息
+type openAIResponseMessage struct {
+	Role      string           `json:"role,omitempty"`
+	Content   *string          `json:"content,omitempty"`
+	ToolCalls []openAIToolCall `json:"tool_calls,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int                    `json:"index"`
+	Message      *openAIResponseMessage `json:"message,omitempty"`
+	Delta        *openAIResponseMessage `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAIResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+// ChatCompletions OpenAI兼容的对话补全接口，支持流式输出和客户端工具
+func (ctrl *openAIController) ChatCompletions(c *gin.Context) {
+	var request openAIRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "无效的请求参数")
+		return
+	}
+	completion, err := request.toCompletion(c.GetUint("user_id"))
+	if err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	response := openAIResponse{
+		ID:      completionID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   request.Model,
+	}
+	if !request.Stream {
+		message, usage, err := ctrl.gatewayService.Complete(c.Request.Context(), completion)
+		if err != nil {
+			respondGatewayError(c, err)
+			return
+		}
+		finishReason := finishReason(message)
+		response.Choices = []openAIChoice{{
+			Message:      toOpenAIMessage(message),
+			FinishReason: &finishReason,
+		}}
+		response.Usage = toOpenAIUsage(usage)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// 流式输出按OpenAI的SSE格式逐块写入data行
+	response.Object = "chat.completion.chunk"
+	write := func(chunk openAIResponse) error {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+		}
+		if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	var toolCalls bool
+	var finish string
+	first := true
+	usage, err := ctrl.gatewayService.Stream(c.Request.Context(), completion, func(message *schema.Message) error {
+		delta := toOpenAIMessage(message)
+		delta.Role = ""
+		if first {
+			delta.Role = string(schema.Assistant)
+			first = false
+		}
+		if len(message.ToolCalls) > 0 {
+			toolCalls = true
+		}
+		if message.ResponseMeta != nil && message.ResponseMeta.FinishReason != "" {
+			finish = message.ResponseMeta.FinishReason
+		}
+		if delta.Role == "" && delta.Content == nil && len(delta.ToolCalls) == 0 {
+			return nil
+		}
+		chunk := response
+		chunk.Choices = []openAIChoice{{Delta: delta}}
+		return write(chunk)
+	})
+	if err != nil {
+		if !c.Writer.Written() {
+			respondGatewayError(c, err)
+			return
+		}
+		data, _ := json.Marshal(gin.H{"error": gin.H{"message": err.Error(), "type": "server_error"}})
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+		return
+	}
+
+	if finish == "" {
+		finish = "stop"
+		if toolCalls {
+			finish = "tool_calls"
+		}
+	}
+	chunk := response
+	chunk.Choices = []openAIChoice{{Delta: &openAIResponseMessage{}, FinishReason: &finish}}
+	if err := write(chunk); err != nil {
+		return
+	}
+	if request.StreamOptions != nil && request.StreamOptions.IncludeUsage {
+		chunk = response
+		chunk.Choices = []openAIChoice{}
+		chunk.Usage = toOpenAIUsage(usage)
+		if err := write(chunk); err != nil {
+			return
+		}
+	}
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// ListModels 列出网关可用的模型
+func (ctrl *openAIController) ListModels(c *gin.Context) {
+	names, err := ctrl.gatewayService.Models()
+	if err != nil {
+		respondGatewayError(c, err)
+		return
+	}
+	models := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		models = append(models, gin.H{"id": name, "object": "model", "created": 0, "owned_by": "davlin"})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": models})
+}
+
+// toCompletion 将OpenAI格式的请求转换为网关请求
+func (r *openAIRequest) toCompletion(userID uint) (service.CompletionRequest, error) {
+	completion := service.CompletionRequest{UserID: userID, Model: r.Model}
+
+	for _, message := range r.Messages {
+		converted, err := message.toSchema()
+		if err != nil {
+			return completion, err
+		}
+		completion.Messages = append(completion.Messages, converted)
+	}
+
+	for _, tool := range r.Tools {
+		if tool.Type != "function" || tool.Function.Name == "" {
+			return completion, errors.New("仅支持function类型的工具")
+		}
+		info := &schema.ToolInfo{Name: tool.Function.Name, Desc: tool.Function.Description}
+		if len(tool.Function.Parameters) > 0 {
+			params := &openapi3.Schema{}
+			if err := json.Unmarshal(tool.Function.Parameters, params); err != nil {
+				return completion, fmt.Errorf("工具%s的参数定义无效", tool.Function.Name)
+			}
+			info.ParamsOneOf = schema.NewParamsOneOfByOpenAPIV3(params)
+		}
+		completion.Tools = append(completion.Tools, info)
+	}
+	if err := r.applyToolChoice(&completion); err != nil {
+		return completion, err
+	}
+
+	if r.Temperature != nil {
+		completion.Options = append(completion.Options, model.WithTemperature(*r.Temperature))
+	}
+	if r.TopP != nil {
+		completion.Options = append(completion.Options, model.WithTopP(*r.TopP))
+	}
+	if r.MaxCompletionTokens != nil {
+		completion.Options = append(completion.Options, model.WithMaxTokens(*r.MaxCompletionTokens))
+	} else if r.MaxTokens != nil {
+		completion.Options = append(completion.Options, model.WithMaxTokens(*r.MaxTokens))
+	}
+	if len(r.Stop) > 0 && string(r.Stop) != "null" {
+		var stop []string
+		if err := json.Unmarshal(r.Stop, &stop); err != nil {
+			var single string
+			if err := json.Unmarshal(r.Stop, &single); err != nil {
+				return completion, errors.New("无效的stop参数")
+			}
+			stop = []string{single}
+		}
+		completion.Options = append(completion.Options, model.WithStop(stop))
+	}
+	return completion, nil
+}
+
+// applyToolChoice 解析tool_choice，指定函数时只保留该工具并强制调用
+func (r *openAIRequest) applyToolChoice(completion *service.CompletionRequest) error {
+	if len(r.ToolChoice) == 0 || string(r.ToolChoice) == "null" {
+		return nil
+	}
+	var choice schema.ToolChoice
+	var mode string
+	if err := json.Unmarshal(r.ToolChoice, &mode); err == nil {
+		switch mode {
+		case "none":
+			choice = schema.ToolChoiceForbidden
+		case "auto":
+			choice = schema.ToolChoiceAllowed
+		case "required":
+			choice = schema.ToolChoiceForced
+		default:
+			return errors.New("无效的tool_choice参数")
+		}
+		completion.ToolChoice = &choice
+		return nil
+	}
+
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(r.ToolChoice, &named); err != nil || named.Function.Name == "" {
+		return errors.New("无效的tool_choice参数")
+	}
+	for _, tool := range completion.Tools {
+		if tool.Name == named.Function.Name {
+			completion.Tools = []*schema.ToolInfo{tool}
+			choice = schema.ToolChoiceForced
+			completion.ToolChoice = &choice
+			return nil
+		}
+	}
+	return fmt.Errorf("tool_choice指定的工具%s不存在", named.Function.Name)
+}
+
+// toSchema 将OpenAI格式的消息转换为eino消息
+func (m *openAIMessage) toSchema() (*schema.Message, error) {
+	message := &schema.Message{Name: m.Name, ToolCallID: m.ToolCallID}
+	switch m.Role {
+	case "system", "developer":
+		message.Role = schema.System
+	case "user":
+		message.Role = schema.User
+	case "assistant":
+		message.Role = schema.Assistant
+	case "tool":
+		message.Role = schema.Tool
+	default:
+		return nil, fmt.Errorf("不支持的消息角色: %s", m.Role)
+	}
+
+	if len(m.Content) > 0 && string(m.Content) != "null" {
+		if err := json.Unmarshal(m.Content, &message.Content); err != nil {
+			var parts []openAIContentPart
+			if err := json.Unmarshal(m.Content, &parts); err != nil {
+				return nil, errors.New("无效的消息内容")
+			}
+			for _, part := range parts {
+				switch {
+				case part.Type == "text":
+					message.MultiContent = append(message.MultiContent, schema.ChatMessagePart{
+						Type: schema.ChatMessagePartTypeText,
+						Text: part.Text,
+					})
+				case part.Type == "image_url" && part.ImageURL != nil:
+					message.MultiContent = append(message.MultiContent, schema.ChatMessagePart{
+						Type: schema.ChatMessagePartTypeImageURL,
+						ImageURL: &schema.ChatMessageImageURL{
+							URL:    part.ImageURL.URL,
+							Detail: schema.ImageURLDetail(part.ImageURL.Detail),
+						},
+					})
+				default:
+					return nil, fmt.Errorf("不支持的内容类型: %s", part.Type)
+				}
+			}
+		}
+	}
+
+	for _, call := range m.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, schema.ToolCall{
+			ID:   call.ID,
+			Type: "function",
+			Function: schema.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		})
+	}
+	return message, nil
+}
+
+// toOpenAIMessage 将eino消息转换为OpenAI格式，流式片段的工具调用保留index
+func toOpenAIMessage(message *schema.Message) *openAIResponseMessage {
+	converted := &openAIResponseMessage{Role: string(schema.Assistant)}
+	if message.Content != "" || len(message.ToolCalls) == 0 {
+		content := message.Content
+		converted.Content = &content
+	}
+	for i, call := range message.ToolCalls {
+		index := i
+		if call.Index != nil {
+			index = *call.Index
+		}
+		toolCall := openAIToolCall{Index: &index, ID: call.ID}
+		if call.ID != "" {
+			toolCall.Type = "function"
+		}
+		toolCall.Function.Name = call.Function.Name
+		toolCall.Function.Arguments = call.Function.Arguments
+		converted.ToolCalls = append(converted.ToolCalls, toolCall)
+	}
+	return converted
+}
+
+// finishReason 返回模型给出的结束原因，未提供时根据是否调用工具推断
+func finishReason(message *schema.Message) string {
+	if message.ResponseMeta != nil && message.ResponseMeta.FinishReason != "" {
+		return message.ResponseMeta.FinishReason
+	}
+	if len(message.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+func toOpenAIUsage(usage *schema.TokenUsage) *openAIUsage {
+	if usage == nil {
+		return &openAIUsage{}
+	}
+	return &openAIUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
+
+// completionID 生成补全ID
+func completionID() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return "chatcmpl-" + hex.EncodeToString(buf)
+}
+
+// respondGatewayError 将网关错误转换为OpenAI格式的错误响应
+func respondGatewayError(c *gin.Context, err error) {
+	if quotaErr, ok := service.IsQuotaExceeded(err); ok {
+		if !quotaErr.ResetAt.IsZero() {
+			c.Header("Retry-After", fmt.Sprint(int(time.Until(quotaErr.ResetAt).Seconds())+1))
+		}
+		respondOpenAIError(c, http.StatusTooManyRequests, "insufficient_quota", quotaErr.Error())
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrModelNotFound):
+		respondOpenAIError(c, http.StatusNotFound, "invalid_request_error", err.Error())
+	case errors.Is(err, service.ErrAgentCustomTools):
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+	default:
+		respondOpenAIError(c, http.StatusInternalServerError, "server_error", err.Error())
+	}
+}
+
+// respondOpenAIError 输出OpenAI格式的错误
+func respondOpenAIError(c *gin.Context, status int, errorType, message string) {
+	c.JSON(status, gin.H{"error": gin.H{"message": message, "type": errorType}})
+}
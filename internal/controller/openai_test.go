@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGateway 记录收到的请求并返回固定回复
+type fakeGateway struct {
+	request service.CompletionRequest
+	reply   *schema.Message
+}
+
+func (g *fakeGateway) Models() ([]string, error) {
+	return []string{service.GatewayAgentModel, "gpt-4o"}, nil
+}
+
+func (g *fakeGateway) Complete(ctx context.Context, request service.CompletionRequest) (*schema.Message, *schema.TokenUsage, error) {
+	g.request = request
+	return g.reply, &schema.TokenUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}, nil
+}
+
+func (g *fakeGateway) Stream(ctx context.Context, request service.CompletionRequest, onChunk func(*schema.Message) error) (*schema.TokenUsage, error) {
+	g.request = request
+	for _, chunk := range []string{"Hel", "lo"} {
+		if err := onChunk(schema.AssistantMessage(chunk, nil)); err != nil {
+			return nil, err
+		}
+	}
+	return &schema.TokenUsage{TotalTokens: 5}, nil
+}
+
+func setupOpenAI(gateway service.GatewayService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := NewOpenAIController(gateway)
+	r.POST("/v1/chat/completions", ctrl.ChatCompletions)
+	r.GET("/v1/models", ctrl.ListModels)
+	return r
+}
+
+func TestChatCompletions(t *testing.T) {
+	gateway := &fakeGateway{reply: schema.AssistantMessage("", []schema.ToolCall{
+		{ID: "call_1", Function: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}},
+	})}
+	r := setupOpenAI(gateway)
+
+	body := `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": [{"type": "text", "text": "天气如何"}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_0", "type": "function", "function": {"name": "get_weather", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "call_0", "content": "晴"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}}],
+		"tool_choice": {"type": "function", "function": {"name": "get_weather"}},
+		"temperature": 0.2,
+		"stop": "END"
+	}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	request := gateway.request
+	assert.Len(t, request.Messages, 4)
+	assert.Equal(t, schema.System, request.Messages[0].Role)
+	assert.Equal(t, "天气如何", request.Messages[1].MultiContent[0].Text)
+	assert.Equal(t, "call_0", request.Messages[2].ToolCalls[0].ID)
+	assert.Equal(t, "call_0", request.Messages[3].ToolCallID)
+	assert.Len(t, request.Tools, 1)
+	assert.Equal(t, schema.ToolChoiceForced, *request.ToolChoice)
+	assert.Len(t, request.Options, 2)
+
+	var response struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message      openAIResponseMessage `json:"message"`
+			FinishReason string                `json:"finish_reason"`
+		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "chat.completion", response.Object)
+	assert.Equal(t, "tool_calls", response.Choices[0].FinishReason)
+	assert.Equal(t, "get_weather", response.Choices[0].Message.ToolCalls[0].Function.Name)
+	assert.Nil(t, response.Choices[0].Message.Content)
+	assert.Equal(t, 5, response.Usage.TotalTokens)
+
+	// 无效的角色
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "messages": [{"role": "robot", "content": "hi"}]}`))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_request_error")
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	r := setupOpenAI(&fakeGateway{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "hi"}]}`))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	assert.Len(t, events, 5)
+	assert.Contains(t, events[0], `"role":"assistant","content":"Hel"`)
+	assert.Contains(t, events[1], `"content":"lo"`)
+	assert.Contains(t, events[2], `"finish_reason":"stop"`)
+	assert.Contains(t, events[3], `"total_tokens":5`)
+	assert.Equal(t, "data: [DONE]", events[4])
+}
+
+func TestListModels(t *testing.T) {
+	r := setupOpenAI(&fakeGateway{})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/models", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"davlin-agent"`)
+}
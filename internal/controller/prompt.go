@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// PromptController 定义提示词控制器接口
+type PromptController interface {
+	ListPrompts(c *gin.Context)
+	GetPrompt(c *gin.Context)
+	CreatePrompt(c *gin.Context)
+	AddVersion(c *gin.Context)
+	Rollback(c *gin.Context)
+	GetInstruction(c *gin.Context)
+	SetInstruction(c *gin.Context)
+}
+
+// promptController 实现PromptController接口的结构体
+type promptController struct {
+	promptService service.PromptService
+}
+
+// NewPromptController 创建提示词控制器实例
+func NewPromptController(promptService service.PromptService) PromptController {
+	return &promptController{
+		promptService: promptService,
+	}
+}
+
+// ListPrompts 分页获取提示词
+func (ctrl *promptController) ListPrompts(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	prompts, err := ctrl.promptService.ListPrompts(page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prompts)
+}
+
+// GetPrompt 获取提示词及其版本历史
+func (ctrl *promptController) GetPrompt(c *gin.Context) {
+	promptID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	detail, err := ctrl.promptService.GetPrompt(promptID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// CreatePrompt 创建提示词
+func (ctrl *promptController) CreatePrompt(c *gin.Context) {
+	var request struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		Content     string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	prompt := &model.Prompt{Name: request.Name, Description: request.Description}
+	if err := ctrl.promptService.CreatePrompt(prompt, request.Content, c.GetUint("user_id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prompt)
+}
+
+// AddVersion 为提示词新增版本
+func (ctrl *promptController) AddVersion(c *gin.Context) {
+	promptID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	version, err := ctrl.promptService.AddVersion(promptID, request.Content, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// Rollback 回滚提示词到指定版本
+func (ctrl *promptController) Rollback(c *gin.Context) {
+	promptID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Version int `json:"version" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	if err := ctrl.promptService.Rollback(promptID, request.Version); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已回滚"})
+}
+
+// GetInstruction 获取当前用户的自定义指令
+func (ctrl *promptController) GetInstruction(c *gin.Context) {
+	content, err := ctrl.promptService.GetInstruction(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"content": content})
+}
+
+// SetInstruction 设置当前用户的自定义指令，内容为空时清除
+func (ctrl *promptController) SetInstruction(c *gin.Context) {
+	var request struct {
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	if err := ctrl.promptService.SetInstruction(c.GetUint("user_id"), request.Content); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "保存成功"})
+}
+
+// paramID 解析路径中的ID参数，失败时直接返回400
+func paramID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ShareController 定义会话分享控制器接口
+type ShareController interface {
+	CreateShare(c *gin.Context)
+	ListShares(c *gin.Context)
+	RevokeShare(c *gin.Context)
+	GetShare(c *gin.Context)
+}
+
+// shareController 实现ShareController接口的结构体
+type shareController struct {
+	shareService service.ShareService
+}
+
+// NewShareController 创建会话分享控制器实例
+func NewShareController(shareService service.ShareService) ShareController {
+	return &shareController{
+		shareService: shareService,
+	}
+}
+
+// CreateShare 为会话创建只读分享链接
+func (ctrl *shareController) CreateShare(c *gin.Context) {
+	conversationID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		ExpiresInHours int  `json:"expires_in_hours" binding:"min=0"`
+		HideTrace      bool `json:"hide_trace"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	share, err := ctrl.shareService.Create(c.GetUint("user_id"), conversationID, service.ShareOptions{
+		ExpiresIn: time.Duration(request.ExpiresInHours) * time.Hour,
+		HideTrace: request.HideTrace,
+	})
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+// ListShares 分页列出当前用户创建的分享
+func (ctrl *shareController) ListShares(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	shares, err := ctrl.shareService.List(c.GetUint("user_id"), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+// RevokeShare 撤销分享链接
+func (ctrl *shareController) RevokeShare(c *gin.Context) {
+	shareID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.shareService.Revoke(c.GetUint("user_id"), shareID); err != nil {
+		if errors.Is(err, service.ErrShareNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "分享已撤销"})
+}
+
+// GetShare 公开访问分享的会话快照，无需认证
+func (ctrl *shareController) GetShare(c *gin.Context) {
+	shared, err := ctrl.shareService.Get(c.Param("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrShareNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrShareExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, shared)
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// usageDateLayout 用量查询的日期格式
+const usageDateLayout = "2006-01-02"
+
+// UsageController 定义用量统计控制器接口
+type UsageController interface {
+	GetUsage(c *gin.Context)
+	GetAllUsage(c *gin.Context)
+}
+
+// usageController 实现UsageController接口的结构体
+type usageController struct {
+	usageService service.UsageService
+}
+
+// NewUsageController 创建用量统计控制器实例
+func NewUsageController(usageService service.UsageService) UsageController {
+	return &usageController{
+		usageService: usageService,
+	}
+}
+
+// GetUsage 获取当前用户按天聚合的用量
+func (ctrl *usageController) GetUsage(c *gin.Context) {
+	query, ok := bindUsageQuery(c)
+	if !ok {
+		return
+	}
+	query.UserID = c.GetUint("user_id")
+
+	ctrl.respondUsage(c, query)
+}
+
+// GetAllUsage 管理员查看全部用户按天聚合的用量，可按user_id过滤
+func (ctrl *usageController) GetAllUsage(c *gin.Context) {
+	query, ok := bindUsageQuery(c)
+	if !ok {
+		return
+	}
+	if query.UserID, ok = queryID(c, "user_id"); !ok {
+		return
+	}
+
+	ctrl.respondUsage(c, query)
+}
+
+// respondUsage 返回按天聚合的用量和合计
+func (ctrl *usageController) respondUsage(c *gin.Context, query service.UsageQuery) {
+	daily, err := ctrl.usageService.GetDailyUsage(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	total := service.DailyUsage{}
+	for _, day := range daily {
+		total.Calls += day.Calls
+		total.PromptTokens += day.PromptTokens
+		total.CompletionTokens += day.CompletionTokens
+		total.ToolTokens += day.ToolTokens
+		total.TotalTokens += day.TotalTokens
+		total.Cost += day.Cost
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency": ctrl.usageService.Currency(),
+		"daily":    daily,
+		"total":    total,
+	})
+}
+
+// bindUsageQuery 解析from、to、model和conversation_id查询参数，to包含当天
+func bindUsageQuery(c *gin.Context) (service.UsageQuery, bool) {
+	var query service.UsageQuery
+	var ok bool
+	if query.From, query.To, ok = bindDateRange(c); !ok {
+		return query, false
+	}
+	if query.ConversationID, ok = queryID(c, "conversation_id"); !ok {
+		return query, false
+	}
+	query.Model = c.Query("model")
+	return query, true
+}
+
+// bindDateRange 解析from和to查询参数，返回的to为结束日期的次日零点
+func bindDateRange(c *gin.Context) (from, to time.Time, ok bool) {
+	if value := c.Query("from"); value != "" {
+		t, err := time.ParseInLocation(usageDateLayout, value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的起始日期"})
+			return from, to, false
+		}
+		from = t
+	}
+	if value := c.Query("to"); value != "" {
+		t, err := time.ParseInLocation(usageDateLayout, value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束日期"})
+			return from, to, false
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	return from, to, true
+}
+
+// queryID 解析可选的ID查询参数，未提供时返回0
+func queryID(c *gin.Context, name string) (uint, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
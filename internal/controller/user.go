@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
 	"github.com/davlin-coder/davlin/internal/service"
 	"github.com/gin-gonic/gin"
 )
@@ -12,20 +15,35 @@ import (
 type UserController interface {
 	Register(c *gin.Context)
 	Login(c *gin.Context)
+	LoginMFA(c *gin.Context)
 	SendVerificationCode(c *gin.Context)
+	Refresh(c *gin.Context)
+	Logout(c *gin.Context)
+	ForgotPassword(c *gin.Context)
+	ResetPassword(c *gin.Context)
+	GetProfile(c *gin.Context)
+	UpdateProfile(c *gin.Context)
+	ChangePassword(c *gin.Context)
+	RequestEmailChange(c *gin.Context)
+	ConfirmEmailChange(c *gin.Context)
+	DeleteAccount(c *gin.Context)
 }
 
 // userController implements UserController interface
 type userController struct {
 	userService         service.UserService
 	verificationService service.VerificationService
+	tokenService        service.TokenService
+	passwordService     service.PasswordService
 }
 
 // NewUserController creates a new user controller instance
-func NewUserController(userService service.UserService, verificationService service.VerificationService) UserController {
+func NewUserController(userService service.UserService, verificationService service.VerificationService, tokenService service.TokenService, passwordService service.PasswordService) UserController {
 	return &userController{
 		userService:         userService,
 		verificationService: verificationService,
+		tokenService:        tokenService,
+		passwordService:     passwordService,
 	}
 }
 
@@ -82,13 +100,305 @@ func (ctrl *userController) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := ctrl.userService.Login(loginInfo.Email, loginInfo.Password, loginInfo.Code)
+	tokens, err := ctrl.userService.Login(loginInfo.Email, loginInfo.Password, loginInfo.Code, c.ClientIP())
 	if err != nil {
+		if mfaErr, ok := service.IsMFARequired(err); ok {
+			c.JSON(http.StatusOK, gin.H{
+				"mfa_required": true,
+				"mfa_token":    mfaErr.Token,
+				"expires_in":   int64(mfaErr.ExpiresIn.Seconds()),
+			})
+			return
+		}
+		if attemptsErr, ok := service.IsTooManyAttempts(err); ok {
+			respondTooManyAttempts(c, attemptsErr)
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+// LoginMFA completes a two-factor login with a TOTP or recovery code
+func (ctrl *userController) LoginMFA(c *gin.Context) {
+	var request struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供两步验证令牌和动态口令"})
+		return
+	}
+
+	tokens, err := ctrl.userService.CompleteMFALogin(request.MFAToken, request.Code, c.ClientIP())
+	if err != nil {
+		if attemptsErr, ok := service.IsTooManyAttempts(err); ok {
+			respondTooManyAttempts(c, attemptsErr)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrInvalidMFAChallenge) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (ctrl *userController) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供刷新令牌"})
+		return
+	}
+
+	tokens, err := ctrl.tokenService.Refresh(c.Request.Context(), request.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+// Logout revokes the current access token and its refresh token family
+func (ctrl *userController) Logout(c *gin.Context) {
+	claims, ok := c.MustGet("claims").(*tools.JWTClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌"})
+		return
+	}
+
+	if err := ctrl.tokenService.Logout(c.Request.Context(), claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// ForgotPassword emails a reset link; the response is the same whether or not the email is registered
+func (ctrl *userController) ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邮箱地址"})
+		return
+	}
+
+	ctrl.passwordService.RequestReset(request.Email)
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已注册，重置链接已发送"})
+}
+
+// ResetPassword sets a new password with a reset token and signs out all sessions
+func (ctrl *userController) ResetPassword(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供重置令牌和至少8位的新密码"})
+		return
+	}
+
+	if err := ctrl.passwordService.Reset(c.Request.Context(), request.Token, request.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请重新登录"})
+}
+
+// GetProfile returns the current user's profile
+func (ctrl *userController) GetProfile(c *gin.Context) {
+	user, err := ctrl.userService.GetProfile(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateProfile updates the fields present in the request body
+func (ctrl *userController) UpdateProfile(c *gin.Context) {
+	var request struct {
+		Username    *string `json:"username"`
+		DisplayName *string `json:"display_name"`
+		AvatarURL   *string `json:"avatar_url"`
+		Locale      *string `json:"locale"`
+		Timezone    *string `json:"timezone"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	user, err := ctrl.userService.UpdateProfile(c.GetUint("user_id"), service.ProfileUpdate{
+		Username:    request.Username,
+		DisplayName: request.DisplayName,
+		AvatarURL:   request.AvatarURL,
+		Locale:      request.Locale,
+		Timezone:    request.Timezone,
+	})
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword changes the password and returns fresh tokens for the current device
+func (ctrl *userController) ChangePassword(c *gin.Context) {
+	var request struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=8"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供当前密码和至少8位的新密码"})
+		return
+	}
+
+	tokens, err := ctrl.userService.ChangePassword(c.GetUint("user_id"), request.CurrentPassword, request.NewPassword)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(tokens))
+}
+
+// RequestEmailChange sends a verification code to the new address
+func (ctrl *userController) RequestEmailChange(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邮箱地址"})
+		return
+	}
+
+	if err := ctrl.userService.RequestEmailChange(c.GetUint("user_id"), request.Email, c.ClientIP()); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "验证码已发送到新邮箱"})
+}
+
+// ConfirmEmailChange applies the new address once its code is verified
+func (ctrl *userController) ConfirmEmailChange(c *gin.Context) {
+	var request struct {
+		Email    string `json:"email" binding:"required,email"`
+		Code     string `json:"code" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供新邮箱、验证码和当前密码"})
+		return
+	}
+
+	user, err := ctrl.userService.ConfirmEmailChange(c.GetUint("user_id"), request.Email, request.Code, request.Password)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteAccount schedules the account for deletion after the grace period
+func (ctrl *userController) DeleteAccount(c *gin.Context) {
+	var request struct {
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供当前密码"})
+		return
+	}
+
+	deleteAt, err := ctrl.userService.ScheduleDeletion(c.GetUint("user_id"), request.Password)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "账户将在宽限期后删除，期间重新登录即可撤销",
+		"deletion_scheduled_at": deleteAt,
+	})
+}
+
+// respondAccountError maps account management errors to status codes
+func respondAccountError(c *gin.Context, err error) {
+	if attemptsErr, ok := service.IsTooManyAttempts(err); ok {
+		respondTooManyAttempts(c, attemptsErr)
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWrongPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUsernameTaken), errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidProfile), errors.Is(err, service.ErrVerificationCodeExpired),
+		errors.Is(err, service.ErrVerificationCodeMismatch), errors.Is(err, service.ErrVerificationCodeExhausted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// respondTooManyAttempts tells the client how long to wait before retrying
+func respondTooManyAttempts(c *gin.Context, err *service.TooManyAttemptsError) {
+	c.Header("Retry-After", strconv.Itoa(int(err.RetryAfter.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+}
+
+// tokenResponse keeps the legacy token field for clients that predate refresh tokens
+func tokenResponse(tokens *service.TokenPair) gin.H {
+	return gin.H{
+		"token":         tokens.AccessToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+	}
 }
 
 // SendVerificationCode sends verification code to user's email
@@ -102,7 +412,11 @@ func (ctrl *userController) SendVerificationCode(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.verificationService.SendVerificationCode(request.Email); err != nil {
+	if err := ctrl.verificationService.SendVerificationCode(request.Email, c.ClientIP()); err != nil {
+		if attemptsErr, ok := service.IsTooManyAttempts(err); ok {
+			respondTooManyAttempts(c, attemptsErr)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,457 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// wsPingInterval 服务端发送心跳的间隔
+	wsPingInterval = 30 * time.Second
+	// wsAuthInterval 重新校验连接凭证的间隔，令牌注销或过期后连接会被关闭
+	wsAuthInterval = time.Minute
+	// wsReadTimeout 超过该时间未收到客户端任何消息则断开连接
+	wsReadTimeout = 75 * time.Second
+	// wsWriteTimeout 单次写入的超时时间
+	wsWriteTimeout = 10 * time.Second
+	// wsMaxMessageSize 客户端单条消息的最大字节数
+	wsMaxMessageSize = 1 << 20
+	// wsBufferSize 每个会话保留用于断线重放的事件数
+	wsBufferSize = 2000
+	// wsQueueSize 单个连接待发送事件的上限，超过时认为客户端过慢并断开，客户端可重连后重放
+	wsQueueSize = 2 * wsBufferSize
+	// wsSessionTTL 断开后会话保留的时间，期间可以带着last_seq重连
+	wsSessionTTL = 5 * time.Minute
+	// wsMaxSessions 每个用户同时保留的会话数
+	wsMaxSessions = 5
+)
+
+var errTooManySessions = errors.New("连接数已达上限，请关闭其他窗口后重试")
+
+// WebSocketController 定义WebSocket聊天控制器接口
+type WebSocketController interface {
+	Connect(c *gin.Context)
+}
+
+// webSocketController 实现WebSocketController接口的结构体
+type webSocketController struct {
+	chatService service.ChatService
+	// mu 保护sessions以及会话的connections和detachedAt，持有期间不获取会话的锁
+	mu       sync.Mutex
+	sessions map[string]*wsSession
+}
+
+// NewWebSocketController 创建WebSocket聊天控制器实例
+func NewWebSocketController(chatService service.ChatService) WebSocketController {
+	return &webSocketController{
+		chatService: chatService,
+		sessions:    make(map[string]*wsSession),
+	}
+}
+
+// wsRequest 客户端发送的消息，id由客户端生成，用于关联该请求产生的事件
+type wsRequest struct {
+	Type           string `json:"type"` // send、regenerate、edit、cancel或ping
+	ID             string `json:"id"`
+	ConversationID uint   `json:"conversation_id"`
+	MessageID      uint   `json:"message_id"`
+	Content        string `json:"content"`
+	PromptID       uint   `json:"prompt_id"`
+	WorkspaceID    uint   `json:"workspace_id"` // 新会话所属的工作区
+}
+
+// wsEvent 推送给客户端的事件，seq在会话内递增，心跳等控制消息没有seq且不会重放
+type wsEvent struct {
+	Seq       uint64      `json:"seq,omitempty"`
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// wsSession 跨连接保留的事件流，断线期间生成继续进行，重连后按seq重放
+type wsSession struct {
+	id     string
+	userID uint
+	// ctx 会话内生成使用的上下文，会话过期、被淘汰或凭证失效时取消
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// 以下字段由控制器的锁保护
+	connections int
+	detachedAt  time.Time
+
+	mu     sync.Mutex
+	conn   *wsConn
+	seq    uint64
+	buffer []wsEvent
+}
+
+// wsConn 一个WebSocket连接及其发送队列，由单独的goroutine写入网络，入队时不做网络IO
+type wsConn struct {
+	ws       *websocket.Conn
+	mu       sync.Mutex
+	queue    []wsEvent
+	draining bool // 发送完队列中的事件后关闭连接
+	wake     chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// Connect 建立WebSocket连接，通过session和last_seq查询参数恢复之前的会话
+func (ctrl *webSocketController) Connect(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	locale := requestLocale(c)
+	lastSeq, _ := strconv.ParseUint(c.Query("last_seq"), 10, 64)
+	// 认证中间件提供的凭证复查函数，连接期间定期调用
+	reauthenticate, _ := c.Value("reauthenticate").(func(context.Context) error)
+
+	session, err := ctrl.session(userID, c.Query("session"))
+	if err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	defer ctrl.release(session)
+
+	server := websocket.Server{
+		// 已通过令牌认证，不校验Origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = wsMaxMessageSize
+			conn := newWSConn(ws)
+			defer conn.close()
+			session.attach(conn, lastSeq)
+			defer session.detach(conn)
+			ctrl.serve(conn, session, locale, reauthenticate)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// session 返回用户可恢复的会话并占用一个连接名额，不存在或已过期时新建。
+// 用户的会话数达到上限时淘汰最早断开的会话，全部在线时返回错误
+func (ctrl *webSocketController) session(userID uint, id string) (*wsSession, error) {
+	var removed []*wsSession
+	defer func() {
+		for _, session := range removed {
+			session.cancel()
+		}
+	}()
+
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+
+	// 清理断开时间过长的会话
+	for key, session := range ctrl.sessions {
+		if session.connections == 0 && time.Since(session.detachedAt) > wsSessionTTL {
+			delete(ctrl.sessions, key)
+			removed = append(removed, session)
+		}
+	}
+
+	if session, ok := ctrl.sessions[id]; ok && session.userID == userID {
+		session.connections++
+		return session, nil
+	}
+
+	var count int
+	var oldest *wsSession
+	for _, session := range ctrl.sessions {
+		if session.userID != userID {
+			continue
+		}
+		count++
+		if session.connections == 0 && (oldest == nil || session.detachedAt.Before(oldest.detachedAt)) {
+			oldest = session
+		}
+	}
+	if count >= wsMaxSessions {
+		if oldest == nil {
+			return nil, errTooManySessions
+		}
+		delete(ctrl.sessions, oldest.id)
+		removed = append(removed, oldest)
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &wsSession{id: hex.EncodeToString(buf), userID: userID, ctx: ctx, cancel: cancel, connections: 1}
+	ctrl.sessions[session.id] = session
+	return session, nil
+}
+
+// release 归还session占用的连接名额，最后一个连接断开时开始计算会话保留时间
+func (ctrl *webSocketController) release(session *wsSession) {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	session.connections--
+	if session.connections == 0 {
+		session.detachedAt = time.Now()
+	}
+}
+
+// remove 立即删除会话并取消其中的生成
+func (ctrl *webSocketController) remove(session *wsSession) {
+	ctrl.mu.Lock()
+	if ctrl.sessions[session.id] == session {
+		delete(ctrl.sessions, session.id)
+	}
+	ctrl.mu.Unlock()
+	session.cancel()
+}
+
+// serve 读取客户端消息直到连接断开，同时定时发送心跳并复查凭证
+func (ctrl *webSocketController) serve(conn *wsConn, session *wsSession, locale string, reauthenticate func(context.Context) error) {
+	// verify 凭证失效时通知客户端，关闭连接并结束会话
+	verify := func() bool {
+		if reauthenticate == nil {
+			return true
+		}
+		if err := reauthenticate(session.ctx); err != nil {
+			conn.closeWith(wsEvent{Type: "error", Data: gin.H{"error": err.Error()}})
+			ctrl.remove(session)
+			// 等待错误事件发出，避免退出读取循环时提前关闭连接
+			select {
+			case <-conn.closed:
+			case <-time.After(wsWriteTimeout):
+			}
+			return false
+		}
+		return true
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		auth := time.NewTicker(wsAuthInterval)
+		defer auth.Stop()
+		for {
+			select {
+			case <-ping.C:
+				conn.send(wsEvent{Type: "ping"})
+			case <-auth.C:
+				if !verify() {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		_ = conn.ws.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		var data []byte
+		if err := websocket.Message.Receive(conn.ws, &data); err != nil {
+			return
+		}
+		var request wsRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			conn.send(wsEvent{Type: "error", Data: gin.H{"error": "无效的消息格式"}})
+			continue
+		}
+		// 发起生成和取消前复查凭证，心跳不需要
+		if request.Type != "ping" && !verify() {
+			return
+		}
+		ctrl.handle(conn, session, request, locale)
+	}
+}
+
+// handle 处理一条客户端消息，生成在后台进行，不因连接断开而中止，会话结束时取消
+func (ctrl *webSocketController) handle(conn *wsConn, session *wsSession, request wsRequest, locale string) {
+	fail := func(err error) {
+		session.emit(wsEvent{Type: "error", RequestID: request.ID, Data: gin.H{"error": err.Error()}})
+	}
+	opts := service.SendOptions{
+		PromptID:    request.PromptID,
+		WorkspaceID: request.WorkspaceID,
+		Locale:      locale,
+		OnEvent: func(event service.ChatEvent) {
+			session.emit(wsEvent{Type: event.Type, RequestID: request.ID, Data: event.Data})
+		},
+	}
+	generate := func(run func() (map[string]interface{}, error)) {
+		go func() {
+			response, err := run()
+			if err != nil {
+				fail(err)
+				return
+			}
+			session.emit(wsEvent{Type: "done", RequestID: request.ID, Data: response})
+		}()
+	}
+
+	ctx := session.ctx
+	switch request.Type {
+	case "ping":
+		conn.send(wsEvent{Type: "pong", RequestID: request.ID})
+	case "send":
+		if request.Content == "" {
+			conn.send(wsEvent{Type: "error", RequestID: request.ID, Data: gin.H{"error": "消息内容不能为空"}})
+			return
+		}
+		message := &model.ChatMessage{UserID: session.userID, ConversationID: request.ConversationID, Content: request.Content}
+		generate(func() (map[string]interface{}, error) {
+			return ctrl.chatService.SendMessage(ctx, message, opts)
+		})
+	case "regenerate":
+		generate(func() (map[string]interface{}, error) {
+			return ctrl.chatService.Regenerate(ctx, session.userID, request.MessageID, opts)
+		})
+	case "edit":
+		if request.Content == "" {
+			conn.send(wsEvent{Type: "error", RequestID: request.ID, Data: gin.H{"error": "消息内容不能为空"}})
+			return
+		}
+		generate(func() (map[string]interface{}, error) {
+			return ctrl.chatService.EditMessage(ctx, session.userID, request.MessageID, request.Content, opts)
+		})
+	case "cancel":
+		if err := ctrl.chatService.CancelGeneration(ctx, session.userID, request.ConversationID); err != nil {
+			fail(err)
+			return
+		}
+		session.emit(wsEvent{Type: "cancelled", RequestID: request.ID, Data: gin.H{"conversation_id": request.ConversationID}})
+	default:
+		conn.send(wsEvent{Type: "error", RequestID: request.ID, Data: gin.H{"error": "不支持的消息类型"}})
+	}
+}
+
+// attach 将连接绑定到会话，先发送会话信息再重放last_seq之后的事件，旧连接被关闭
+func (s *wsSession) attach(conn *wsConn, lastSeq uint64) {
+	s.mu.Lock()
+	previous := s.conn
+	s.conn = conn
+
+	// first_seq之前的事件已丢弃，客户端发现缺失时应重新拉取会话消息
+	firstSeq := s.seq + 1
+	if len(s.buffer) > 0 {
+		firstSeq = s.buffer[0].Seq
+	}
+	events := []wsEvent{{Type: "session", Data: gin.H{"session_id": s.id, "last_seq": s.seq, "first_seq": firstSeq}}}
+	for _, event := range s.buffer {
+		if event.Seq > lastSeq {
+			events = append(events, event)
+		}
+	}
+	conn.send(events...)
+	s.mu.Unlock()
+
+	if previous != nil {
+		previous.close()
+	}
+}
+
+// detach 连接断开后保留会话，等待客户端重连
+func (s *wsSession) detach(conn *wsConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn = nil
+	}
+}
+
+// emit 为事件分配序号并缓存，连接存在时加入其发送队列
+func (s *wsSession) emit(event wsEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	event.Seq = s.seq
+	s.buffer = append(s.buffer, event)
+	if len(s.buffer) > wsBufferSize {
+		s.buffer = s.buffer[len(s.buffer)-wsBufferSize:]
+	}
+	if s.conn != nil {
+		s.conn.send(event)
+	}
+}
+
+// newWSConn 包装连接并启动写入goroutine
+func newWSConn(ws *websocket.Conn) *wsConn {
+	conn := &wsConn{ws: ws, wake: make(chan struct{}, 1), closed: make(chan struct{})}
+	go conn.writeLoop()
+	return conn
+}
+
+// send 将事件加入发送队列，队列积压超过wsQueueSize时断开连接
+func (c *wsConn) send(events ...wsEvent) {
+	c.mu.Lock()
+	if c.draining {
+		c.mu.Unlock()
+		return
+	}
+	if len(c.queue)+len(events) > wsQueueSize {
+		c.mu.Unlock()
+		c.close()
+		return
+	}
+	c.queue = append(c.queue, events...)
+	c.mu.Unlock()
+	c.notify()
+}
+
+// closeWith 发送最后一个事件后关闭连接
+func (c *wsConn) closeWith(event wsEvent) {
+	c.send(event)
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+	c.notify()
+}
+
+func (c *wsConn) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop 依次写出队列中的事件，写入失败或连接关闭时退出
+func (c *wsConn) writeLoop() {
+	for {
+		select {
+		case <-c.wake:
+		case <-c.closed:
+			return
+		}
+		c.mu.Lock()
+		events, draining := c.queue, c.draining
+		c.queue = nil
+		c.mu.Unlock()
+
+		for _, event := range events {
+			_ = c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := websocket.JSON.Send(c.ws, event); err != nil {
+				c.close()
+				return
+			}
+		}
+		if draining {
+			c.close()
+			return
+		}
+	}
+}
+
+// close 关闭连接，读取循环随之退出
+func (c *wsConn) close() {
+	c.once.Do(func() {
+		close(c.closed)
+		c.ws.Close()
+	})
+}
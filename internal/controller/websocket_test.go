@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// fakeChatService 只实现WebSocket用到的方法，逐个推送回复片段
+type fakeChatService struct {
+	service.ChatService
+}
+
+func (s *fakeChatService) SendMessage(ctx context.Context, message *model.ChatMessage, opts service.SendOptions) (map[string]interface{}, error) {
+	for _, delta := range []string{"你", "好"} {
+		opts.OnEvent(service.ChatEvent{Type: "delta", Data: delta})
+	}
+	return map[string]interface{}{"status": "success", "conversation_id": 1}, nil
+}
+
+func setupWebSocket(t *testing.T, reauthenticate func(context.Context) error) string {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", func(c *gin.Context) {
+		c.Set("user_id", uint(1))
+		if reauthenticate != nil {
+			c.Set("reauthenticate", reauthenticate)
+		}
+	}, NewWebSocketController(&fakeChatService{}).Connect)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func receiveEvent(t *testing.T, conn *websocket.Conn) wsEvent {
+	var event wsEvent
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	assert.NoError(t, websocket.JSON.Receive(conn, &event))
+	return event
+}
+
+func TestWebSocketChat(t *testing.T) {
+	url := setupWebSocket(t, nil)
+
+	conn, err := websocket.Dial(url, "", "http://localhost/")
+	assert.NoError(t, err)
+	session := receiveEvent(t, conn)
+	assert.Equal(t, "session", session.Type)
+	sessionID := session.Data.(map[string]interface{})["session_id"].(string)
+
+	assert.NoError(t, websocket.JSON.Send(conn, wsRequest{Type: "ping", ID: "p1"}))
+	assert.Equal(t, wsEvent{Type: "pong", RequestID: "p1"}, receiveEvent(t, conn))
+
+	assert.NoError(t, websocket.JSON.Send(conn, wsRequest{Type: "send", ID: "r1", Content: "hi"}))
+	var events []wsEvent
+	for len(events) < 3 {
+		events = append(events, receiveEvent(t, conn))
+	}
+	assert.Equal(t, "delta", events[0].Type)
+	assert.Equal(t, "r1", events[0].RequestID)
+	assert.Equal(t, uint64(1), events[0].Seq)
+	assert.Equal(t, "done", events[2].Type)
+	assert.Equal(t, uint64(3), events[2].Seq)
+	conn.Close()
+
+	// 重连后重放last_seq之后的事件
+	conn, err = websocket.Dial(url+"?session="+sessionID+"&last_seq=1", "", "http://localhost/")
+	assert.NoError(t, err)
+	defer conn.Close()
+	session = receiveEvent(t, conn)
+	assert.Equal(t, sessionID, session.Data.(map[string]interface{})["session_id"])
+	assert.Equal(t, float64(3), session.Data.(map[string]interface{})["last_seq"])
+	replayed := receiveEvent(t, conn)
+	assert.Equal(t, uint64(2), replayed.Seq)
+	assert.Equal(t, "好", replayed.Data)
+	assert.Equal(t, uint64(3), receiveEvent(t, conn).Seq)
+
+	assert.NoError(t, websocket.Message.Send(conn, "not json"))
+	assert.Equal(t, "error", receiveEvent(t, conn).Type)
+}
+
+func TestWebSocketSessionLimit(t *testing.T) {
+	url := setupWebSocket(t, nil)
+
+	var conns []*websocket.Conn
+	for i := 0; i < wsMaxSessions; i++ {
+		conn, err := websocket.Dial(url, "", "http://localhost/")
+		assert.NoError(t, err)
+		assert.Equal(t, "session", receiveEvent(t, conn).Type)
+		conns = append(conns, conn)
+	}
+	// 会话全部在线时拒绝新连接
+	_, err := websocket.Dial(url, "", "http://localhost/")
+	assert.Error(t, err)
+
+	// 断开一个后，新连接淘汰已断开的会话
+	conns[0].Close()
+	assert.Eventually(t, func() bool {
+		conn, err := websocket.Dial(url, "", "http://localhost/")
+		if err != nil {
+			return false
+		}
+		conns[0] = conn
+		return true
+	}, 3*time.Second, 20*time.Millisecond)
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func TestWebSocketRevokedCredentials(t *testing.T) {
+	var revoked atomic.Bool
+	url := setupWebSocket(t, func(context.Context) error {
+		if revoked.Load() {
+			return errors.New("令牌已注销")
+		}
+		return nil
+	})
+
+	conn, err := websocket.Dial(url, "", "http://localhost/")
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "session", receiveEvent(t, conn).Type)
+
+	// 凭证失效后下一条请求收到错误，连接随之关闭
+	revoked.Store(true)
+	assert.NoError(t, websocket.JSON.Send(conn, wsRequest{Type: "send", ID: "r1", Content: "hi"}))
+	event := receiveEvent(t, conn)
+	assert.Equal(t, "error", event.Type)
+	assert.Equal(t, "令牌已注销", event.Data.(map[string]interface{})["error"])
+	var next wsEvent
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	assert.Error(t, websocket.JSON.Receive(conn, &next))
+}
@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/davlin-coder/davlin/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// WorkspaceController 定义工作区控制器接口
+type WorkspaceController interface {
+	Create(c *gin.Context)
+	List(c *gin.Context)
+	Get(c *gin.Context)
+	Rename(c *gin.Context)
+	Delete(c *gin.Context)
+	ListMembers(c *gin.Context)
+	UpdateMember(c *gin.Context)
+	RemoveMember(c *gin.Context)
+	Invite(c *gin.Context)
+	ListInvitations(c *gin.Context)
+	RevokeInvitation(c *gin.Context)
+	AcceptInvitation(c *gin.Context)
+}
+
+// workspaceController 实现WorkspaceController接口的结构体
+type workspaceController struct {
+	workspaceService service.WorkspaceService
+}
+
+// NewWorkspaceController 创建工作区控制器实例
+func NewWorkspaceController(workspaceService service.WorkspaceService) WorkspaceController {
+	return &workspaceController{
+		workspaceService: workspaceService,
+	}
+}
+
+// workspaceRequest 创建和重命名工作区的请求
+type workspaceRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// Create 创建工作区，当前用户成为所有者
+func (ctrl *workspaceController) Create(c *gin.Context) {
+	var request workspaceRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供工作区名称"})
+		return
+	}
+
+	workspace, err := ctrl.workspaceService.Create(c.GetUint("user_id"), request.Name)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, workspace)
+}
+
+// List 分页列出当前用户加入的工作区
+func (ctrl *workspaceController) List(c *gin.Context) {
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	workspaces, err := ctrl.workspaceService.List(c.GetUint("user_id"), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaces)
+}
+
+// Get 获取工作区及当前用户的角色
+func (ctrl *workspaceController) Get(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	workspace, err := ctrl.workspaceService.Get(c.GetUint("user_id"), workspaceID)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// Rename 修改工作区名称
+func (ctrl *workspaceController) Rename(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request workspaceRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供工作区名称"})
+		return
+	}
+
+	workspace, err := ctrl.workspaceService.Rename(c.GetUint("user_id"), workspaceID, request.Name)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// Delete 删除工作区
+func (ctrl *workspaceController) Delete(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.workspaceService.Delete(c.GetUint("user_id"), workspaceID); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "工作区已删除"})
+}
+
+// ListMembers 分页列出工作区成员
+func (ctrl *workspaceController) ListMembers(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	members, err := ctrl.workspaceService.ListMembers(c.GetUint("user_id"), workspaceID, page)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// UpdateMember 修改成员角色
+func (ctrl *workspaceController) UpdateMember(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	memberID, ok := paramID(c, "user_id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供角色"})
+		return
+	}
+
+	member, err := ctrl.workspaceService.UpdateMember(c.GetUint("user_id"), workspaceID, memberID, request.Role)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember 移除成员，成员也可以通过该接口退出工作区
+func (ctrl *workspaceController) RemoveMember(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	memberID, ok := paramID(c, "user_id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.workspaceService.RemoveMember(c.GetUint("user_id"), workspaceID, memberID); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
+
+// Invite 通过邮件邀请成员加入工作区
+func (ctrl *workspaceController) Invite(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供有效的邮箱和角色"})
+		return
+	}
+
+	invitation, err := ctrl.workspaceService.Invite(c.GetUint("user_id"), workspaceID, request.Email, request.Role)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// ListInvitations 分页列出尚未接受的邀请
+func (ctrl *workspaceController) ListInvitations(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	invitations, err := ctrl.workspaceService.ListInvitations(c.GetUint("user_id"), workspaceID, page)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation 撤销尚未接受的邀请
+func (ctrl *workspaceController) RevokeInvitation(c *gin.Context) {
+	workspaceID, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	invitationID, ok := paramID(c, "invitation_id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.workspaceService.RevokeInvitation(c.GetUint("user_id"), workspaceID, invitationID); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "邀请已撤销"})
+}
+
+// AcceptInvitation 使用邀请邮件中的令牌加入工作区
+func (ctrl *workspaceController) AcceptInvitation(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供邀请令牌"})
+		return
+	}
+
+	workspace, err := ctrl.workspaceService.AcceptInvitation(c.GetUint("user_id"), request.Token)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// respondWorkspaceError 将工作区和文档操作的错误转换为响应
+func respondWorkspaceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrWorkspaceNotFound), errors.Is(err, service.ErrMemberNotFound),
+		errors.Is(err, service.ErrInvitationNotFound), errors.Is(err, service.ErrDocumentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAlreadyMember), errors.Is(err, service.ErrLastOwner):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidWorkspace), errors.Is(err, service.ErrInvalidInvitation),
+		errors.Is(err, service.ErrInvalidDocument), errors.Is(err, service.ErrModifySelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
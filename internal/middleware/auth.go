@@ -1,15 +1,34 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/davlin-coder/davlin/internal/model"
 	"github.com/davlin-coder/davlin/internal/resource/tools"
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware JWT认证中间件
-func Auth(jwtManager *tools.JWTManager) gin.HandlerFunc {
+// TokenRevocation 查询访问令牌是否已被注销
+type TokenRevocation interface {
+	IsRevoked(ctx context.Context, claims *tools.JWTClaims) (bool, error)
+}
+
+// APIKeyAuthenticator 校验个人API密钥，密钥无效时返回nil
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, error)
+}
+
+// apiKeyPrefix 以该前缀开头的Bearer令牌按API密钥校验
+const apiKeyPrefix = "dvl_"
+
+// AuthMiddleware JWT认证中间件，已注销的令牌会被拒绝
+// 同时接受个人API密钥，密钥只能访问scopes中列出的范围，未指定scopes的接口只允许登录会话访问。
+// 认证通过后在上下文的reauthenticate中保存复查凭证的函数，供WebSocket等长连接定期调用
+func Auth(jwtManager *tools.JWTManager, revocation TokenRevocation, apiKeys APIKeyAuthenticator, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从请求头获取token
 		authorization := c.GetHeader("Authorization")
@@ -27,6 +46,11 @@ func Auth(jwtManager *tools.JWTManager) gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(parts[1], apiKeyPrefix) {
+			authenticateAPIKey(c, apiKeys, parts[1], scopes)
+			return
+		}
+
 		// 验证token
 		claims, err := jwtManager.ParseToken(parts[1])
 		if err != nil {
@@ -35,9 +59,128 @@ func Auth(jwtManager *tools.JWTManager) gin.HandlerFunc {
 			return
 		}
 
+		userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌"})
+			c.Abort()
+			return
+		}
+
+		// 无法确认令牌状态时拒绝请求，避免注销失效
+		revoked, err := revocation.IsRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "无法验证令牌状态"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "令牌已注销"})
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存储在上下文中
 		c.Set("username", claims.Username)
-		c.Set("user_id", claims.Subject)
+		c.Set("user_id", uint(userID))
+		c.Set("claims", claims)
+		token := parts[1]
+		c.Set("reauthenticate", func(ctx context.Context) error {
+			if _, err := jwtManager.ParseToken(token); err != nil {
+				return errors.New("令牌已过期")
+			}
+			revoked, err := revocation.IsRevoked(ctx, claims)
+			if err != nil {
+				return errors.New("无法验证令牌状态")
+			}
+			if revoked {
+				return errors.New("令牌已注销")
+			}
+			return nil
+		})
+
+		c.Next()
+	}
+}
+
+// authenticateAPIKey 校验API密钥及其授权范围
+func authenticateAPIKey(c *gin.Context, apiKeys APIKeyAuthenticator, key string, scopes []string) {
+	apiKey, err := apiKeys.AuthenticateAPIKey(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "无法验证API密钥"})
+		c.Abort()
+		return
+	}
+	if apiKey == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的API密钥"})
+		c.Abort()
+		return
+	}
+
+	allowed := false
+	for _, scope := range scopes {
+		if apiKey.HasScope(scope) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API密钥无权访问该接口"})
+		c.Abort()
+		return
+	}
+
+	c.Set("username", apiKey.User.Username)
+	c.Set("user_id", apiKey.UserID)
+	c.Set("api_key_id", apiKey.ID)
+	c.Set("reauthenticate", func(ctx context.Context) error {
+		apiKey, err := apiKeys.AuthenticateAPIKey(ctx, key)
+		if err != nil {
+			return errors.New("无法验证API密钥")
+		}
+		if apiKey == nil {
+			return errors.New("API密钥已失效")
+		}
+		return nil
+	})
+
+	c.Next()
+}
+
+// PermissionChecker 查询用户是否拥有权限
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, userID uint, permission string) (bool, error)
+}
+
+// RequirePermission 权限中间件，需在Auth之后使用
+func RequirePermission(checker PermissionChecker, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := checker.HasPermission(c.Request.Context(), c.GetUint("user_id"), permission)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "无法验证权限"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问该接口"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// QueryToken 浏览器的WebSocket无法设置请求头，允许通过token查询参数传递令牌，需在Auth之前使用
+func QueryToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query("token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		// 令牌不再随URL向后传递
+		if query := c.Request.URL.Query(); query.Has("token") {
+			query.Del("token")
+			c.Request.URL.RawQuery = query.Encode()
+		}
 
 		c.Next()
 	}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,7 +11,7 @@ import (
 func Cors() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if c.Request.Method == "OPTIONS" {
@@ -42,4 +43,33 @@ func Logger() gin.HandlerFunc {
 			"path":    path,
 		})
 	}
-}
\ No newline at end of file
+}
+
+// accessLogPathKey 访问日志记录的路径
+const accessLogPathKey = "access_log_path"
+
+// AccessLog 访问日志中间件，格式与gin默认日志相同，但记录路由模式而不是实际路径，不记录查询参数，
+// 避免分享链接和WebSocket的token、单点登录的授权码等敏感参数写入日志
+func AccessLog() gin.HandlerFunc {
+	logger := gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		path, _ := param.Keys[accessLogPathKey].(string)
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			path,
+			param.ErrorMessage,
+		)
+	})
+	return func(c *gin.Context) {
+		// 未匹配路由时没有路由模式，记录不含查询参数的路径
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		c.Set(accessLogPathKey, path)
+		logger(c)
+	}
+}
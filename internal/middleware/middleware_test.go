@@ -1,11 +1,17 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -31,7 +37,7 @@ func TestCors(t *testing.T) {
 	// 验证OPTIONS请求的响应
 	assert.Equal(t, 204, w.Code)
 	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
-	assert.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "GET, POST, PUT, PATCH, DELETE, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
 	assert.Equal(t, "Content-Type, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
 
 	// 测试正常GET请求
@@ -66,4 +72,194 @@ func TestLogger(t *testing.T) {
 	// 验证响应
 	assert.Equal(t, 200, w.Code)
 	assert.Equal(t, "test", w.Body.String())
-}
\ No newline at end of file
+}
+
+// staticPermissions 按用户ID配置的权限
+type staticPermissions map[uint][]string
+
+func (p staticPermissions) HasPermission(_ context.Context, userID uint, permission string) (bool, error) {
+	for _, granted := range p[userID] {
+		if granted == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 64)
+		c.Set("user_id", uint(id))
+	})
+	checker := staticPermissions{1: {model.PermissionUsersRead}, 2: {model.PermissionUsageRead}}
+	r.GET("/admin/users", RequirePermission(checker, model.PermissionUsersRead), func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+
+	for userID, code := range map[string]int{"1": 200, "2": 403, "": 403} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin/users", nil)
+		req.Header.Set("X-User-ID", userID)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, userID)
+	}
+}
+
+func TestPromptManagementRequiresPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 64)
+		c.Set("user_id", uint(id))
+	})
+	// 提示词管理与评估数据导出使用同一权限校验，拥有其一不能操作另一个
+	checker := staticPermissions{1: {model.PermissionPromptsManage}, 2: {model.PermissionFeedbackRead}}
+	ok := func(c *gin.Context) { c.String(200, "ok") }
+	r.POST("/admin/prompts", RequirePermission(checker, model.PermissionPromptsManage), ok)
+	r.POST("/admin/prompts/:id/versions", RequirePermission(checker, model.PermissionPromptsManage), ok)
+	r.POST("/admin/prompts/:id/rollback", RequirePermission(checker, model.PermissionPromptsManage), ok)
+	r.GET("/admin/feedback/export", RequirePermission(checker, model.PermissionFeedbackRead), ok)
+
+	for _, route := range []struct{ method, path, userID string }{
+		{"POST", "/admin/prompts", "2"},
+		{"POST", "/admin/prompts/1/versions", "2"},
+		{"POST", "/admin/prompts/1/rollback", "3"},
+		{"GET", "/admin/feedback/export", "1"},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(route.method, route.path, nil)
+		req.Header.Set("X-User-ID", route.userID)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code, route.path)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/prompts/1/rollback", nil)
+	req.Header.Set("X-User-ID", "1")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+type revokedTokens map[string]bool
+
+func (r revokedTokens) IsRevoked(_ context.Context, claims *tools.JWTClaims) (bool, error) {
+	return r[claims.ID], nil
+}
+
+// staticAPIKeys 按明文查找的API密钥
+type staticAPIKeys map[string]*model.APIKey
+
+func (k staticAPIKeys) AuthenticateAPIKey(_ context.Context, key string) (*model.APIKey, error) {
+	return k[key], nil
+}
+
+func TestAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtManager, err := tools.NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", AccessExpire: 15}})
+	assert.NoError(t, err)
+	active, _ := jwtManager.GenerateToken(1, "alice", "session")
+	revoked, _ := jwtManager.GenerateToken(1, "alice", "session")
+	claims, _ := jwtManager.ParseToken(revoked)
+
+	r := gin.New()
+	apiKeys := staticAPIKeys{
+		"dvl_chat": {ID: 1, UserID: 1, Scopes: []string{model.APIKeyScopeChat}, User: model.User{ID: 1, Username: "alice"}},
+	}
+	handler := func(c *gin.Context) {
+		c.String(200, c.GetString("username"))
+	}
+	r.GET("/me", Auth(jwtManager, revokedTokens{claims.ID: true}, apiKeys), handler)
+	r.GET("/chat", Auth(jwtManager, revokedTokens{claims.ID: true}, apiKeys, model.APIKeyScopeChat), handler)
+	r.GET("/usage", Auth(jwtManager, revokedTokens{claims.ID: true}, apiKeys, model.APIKeyScopeUsage), handler)
+
+	for _, tc := range []struct {
+		path   string
+		header string
+		code   int
+	}{
+		{"/me", "Bearer " + active, 200},
+		{"/me", "Bearer " + revoked, 401},
+		{"/me", "Bearer invalid", 401},
+		{"/me", "", 401},
+		// API密钥只能访问授予的范围，未指定范围的接口只允许登录会话
+		{"/chat", "Bearer dvl_chat", 200},
+		{"/chat", "Bearer dvl_unknown", 401},
+		{"/usage", "Bearer dvl_chat", 403},
+		{"/me", "Bearer dvl_chat", 403},
+		{"/usage", "Bearer " + active, 200},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		req.Header.Set("Authorization", tc.header)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, tc.path+" "+tc.header)
+		if tc.code == 200 {
+			assert.Equal(t, "alice", w.Body.String())
+		}
+	}
+}
+
+func TestAuthReauthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtManager, err := tools.NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", AccessExpire: 15}})
+	assert.NoError(t, err)
+	token, _ := jwtManager.GenerateToken(1, "alice", "session")
+	claims, _ := jwtManager.ParseToken(token)
+	revoked := revokedTokens{}
+	apiKeys := staticAPIKeys{
+		"dvl_chat": {ID: 1, UserID: 1, Scopes: []string{model.APIKeyScopeChat}, User: model.User{ID: 1, Username: "alice"}},
+	}
+
+	// 长连接保存认证时的复查函数，令牌注销或密钥失效后复查失败
+	var checks []func(context.Context) error
+	r := gin.New()
+	r.GET("/ws", QueryToken(), Auth(jwtManager, revoked, apiKeys, model.APIKeyScopeChat), func(c *gin.Context) {
+		assert.Empty(t, c.Request.URL.Query().Get("token"))
+		checks = append(checks, c.Value("reauthenticate").(func(context.Context) error))
+	})
+	for _, credential := range []string{token, "dvl_chat"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ws?session=s&token="+credential, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+	}
+	assert.Len(t, checks, 2)
+	for _, check := range checks {
+		assert.NoError(t, check(context.Background()))
+	}
+
+	revoked[claims.ID] = true
+	delete(apiKeys, "dvl_chat")
+	for _, check := range checks {
+		assert.Error(t, check(context.Background()))
+	}
+}
+
+func TestAccessLogOmitsTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	writer := gin.DefaultWriter
+	gin.DefaultWriter = &buf
+	defer func() { gin.DefaultWriter = writer }()
+
+	r := gin.New()
+	r.Use(AccessLog())
+	r.GET("/ws", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/share/:token", func(c *gin.Context) { c.String(200, "ok") })
+	for _, path := range []string{"/ws?token=secret-token", "/share/secret-token", "/missing?token=secret-token"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+	}
+
+	// 记录路由模式，路径中的分享令牌和查询参数不写入日志
+	assert.Contains(t, buf.String(), `"/ws"`)
+	assert.Contains(t, buf.String(), `"/share/:token"`)
+	assert.Contains(t, buf.String(), `"/missing"`)
+	assert.NotContains(t, buf.String(), "secret-token")
+}
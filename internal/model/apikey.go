@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// API密钥的授权范围
+const (
+	APIKeyScopeChat    = "chat"    // 聊天、WebSocket和OpenAI兼容接口
+	APIKeyScopePrompts = "prompts" // 提示词和自定义指令
+	APIKeyScopeUsage   = "usage"   // 用量统计
+)
+
+// APIKeyScopes 全部可授予的范围，账户管理和管理员接口不允许使用API密钥访问
+var APIKeyScopes = []string{APIKeyScopeChat, APIKeyScopePrompts, APIKeyScopeUsage}
+
+// APIKey 用户创建的个人API密钥，只保存哈希，通过明文前缀查找
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null;uniqueIndex" json:"prefix"` // 密钥开头的明文部分，用于查找和在列表中辨认
+	KeyHash    string     `gorm:"size:64;not null" json:"-"`
+	Scopes     []string   `gorm:"type:text;serializer:json" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"` // 为空时永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// HasScope 密钥是否被授予该范围
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+)
+
+// Conversation 会话模型，一个会话包含多条聊天消息
+type Conversation struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"not null;index" json:"user_id"`
+	WorkspaceID      *uint     `gorm:"index" json:"workspace_id,omitempty"` // 所属工作区，为空时为个人会话
+	Title            string    `gorm:"size:200" json:"title"`
+	PromptID         *uint     `json:"prompt_id"`          // 会话使用的系统提示词，为空时使用默认人设
+	CurrentMessageID *uint     `json:"current_message_id"` // 当前分支末端的消息
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
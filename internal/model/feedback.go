@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// 反馈评分
+const (
+	FeedbackUp   = "up"
+	FeedbackDown = "down"
+)
+
+// MessageFeedback 用户对助手回复的评价，记录生成该回复的模型和提示词版本用于离线评估
+type MessageFeedback struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"not null;uniqueIndex:idx_feedback_user_message" json:"user_id"`
+	MessageID       uint      `gorm:"not null;uniqueIndex:idx_feedback_user_message;index" json:"message_id"`
+	ConversationID  uint      `gorm:"not null;index" json:"conversation_id"`
+	Rating          string    `gorm:"size:10;not null;index" json:"rating"` // up或down
+	Reasons         []string  `gorm:"type:text;serializer:json" json:"reasons"`
+	Comment         string    `gorm:"type:text" json:"comment"`
+	Model           string    `gorm:"size:100" json:"model"`
+	PromptVersionID uint      `json:"prompt_version_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// GatewayModel 管理员在网关中添加或停用的模型，配置文件中的模型没有记录时默认可用
+type GatewayModel struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null;uniqueIndex" json:"name"`
+	Enabled   bool      `gorm:"not null" json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 导入任务状态
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportJob 后台导入任务，记录进度和结果
+type ImportJob struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Format    string    `gorm:"size:20;not null" json:"format"` // chatgpt或jsonl
+	Status    string    `gorm:"size:20;not null" json:"status"`
+	Total     int       `json:"total"`     // 待导入的会话数
+	Processed int       `json:"processed"` // 已处理的会话数
+	Imported  int       `json:"imported"`  // 成功导入的会话数
+	Messages  int       `json:"messages"`  // 成功导入的消息数
+	Error     string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
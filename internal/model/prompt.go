@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// Prompt 管理员定义的系统提示词，内容按版本保存
+type Prompt struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `gorm:"size:100;not null;unique" json:"name"`
+	Description   string    `gorm:"size:500" json:"description"`
+	ActiveVersion int       `gorm:"not null;default:1" json:"active_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// PromptVersion 提示词版本，内容为text/template模板
+type PromptVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	PromptID  uint      `gorm:"not null;uniqueIndex:idx_prompt_version" json:"prompt_id"`
+	Version   int       `gorm:"not null;uniqueIndex:idx_prompt_version" json:"version"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserInstruction 用户自定义指令，附加在系统提示词之后
+type UserInstruction struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// UserQuota 用户级配额，字段为空时使用默认配额
+type UserQuota struct {
+	UserID         uint      `gorm:"primaryKey" json:"user_id"`
+	MessagesPerDay *int      `json:"messages_per_day"`
+	TokensPerMonth *int      `json:"tokens_per_month"`
+	ConcurrentJobs *int      `json:"concurrent_jobs"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
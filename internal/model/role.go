@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// 权限，管理员接口按权限授权
+const (
+	PermissionUsersRead     = "users:read"     // 查看和搜索用户
+	PermissionUsersManage   = "users:manage"   // 修改用户角色、停用和启用账户
+	PermissionQuotasManage  = "quotas:manage"  // 修改和重置用户配额
+	PermissionUsageRead     = "usage:read"     // 查看全部用户的用量
+	PermissionPromptsManage = "prompts:manage" // 管理全局提示词
+	PermissionModelsManage  = "models:manage"  // 管理网关可用的模型
+	PermissionFeedbackRead  = "feedback:read"  // 导出消息反馈
+	PermissionRolesManage   = "roles:manage"   // 管理自定义角色
+)
+
+// Permissions 全部可授予的权限
+var Permissions = []string{
+	PermissionUsersRead, PermissionUsersManage, PermissionQuotasManage, PermissionUsageRead,
+	PermissionPromptsManage, PermissionModelsManage, PermissionFeedbackRead, PermissionRolesManage,
+}
+
+// 内置角色，不保存在数据库中
+const (
+	RoleUser  = "user"  // 普通用户，没有管理权限
+	RoleAdmin = "admin" // 管理员，拥有全部权限
+)
+
+// Role 管理员创建的自定义角色
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:50;not null;uniqueIndex" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	Permissions []string  `gorm:"type:text;serializer:json" json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Share 会话的公开分享，保存创建时的会话快照，之后的新消息不会出现在分享中。只保存令牌哈希
+type Share struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	ConversationID uint       `gorm:"not null;index" json:"conversation_id"`
+	Prefix         string     `gorm:"size:8;not null" json:"prefix"` // 令牌开头的明文部分，用于在列表中辨认
+	TokenHash      string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Title          string     `gorm:"size:200" json:"title"`
+	HideTrace      bool       `gorm:"not null;default:false" json:"hide_trace"` // 快照中不包含工具调用等执行步骤
+	Snapshot       string     `gorm:"type:longtext" json:"-"`                   // 消息快照JSON
+	ExpiresAt      *time.Time `json:"expires_at"`                               // 为空时永不过期
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	URL            string     `gorm:"-" json:"url,omitempty"` // 公开访问路径，仅创建时返回
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// 执行步骤类型
+const (
+	TraceStepReasoning = "reasoning" // 调用工具前模型输出的中间推理
+	TraceStepToolCall  = "tool_call" // 一次工具调用及其结果
+)
+
+// TraceStep 智能体生成回复过程中的一个步骤，关联到最终的助手消息
+type TraceStep struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"index;not null" json:"message_id"`
+	Seq       int       `gorm:"not null" json:"seq"` // 步骤在本次生成中的顺序
+	Type      string    `gorm:"size:20;not null" json:"type"`
+	Content   string    `gorm:"type:text" json:"content,omitempty"` // 中间推理内容
+	ToolName  string    `gorm:"size:100" json:"tool_name,omitempty"`
+	Arguments string    `gorm:"type:text" json:"arguments,omitempty"` // 工具参数JSON
+	Result    string    `gorm:"type:text" json:"result,omitempty"`
+	Error     string    `gorm:"type:text" json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
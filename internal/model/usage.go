@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// UsageRecord 单次模型调用的token用量记录
+type UsageRecord struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"not null;index:idx_usage_user_created" json:"user_id"`
+	ConversationID   uint      `gorm:"index" json:"conversation_id"`
+	Model            string    `gorm:"size:100;not null" json:"model"`
+	PromptTokens     int       `gorm:"not null;default:0" json:"prompt_tokens"`
+	CompletionTokens int       `gorm:"not null;default:0" json:"completion_tokens"`
+	ToolTokens       int       `gorm:"not null;default:0" json:"tool_tokens"` // 用于生成工具调用的输出token
+	TotalTokens      int       `gorm:"not null;default:0" json:"total_tokens"`
+	Cost             float64   `gorm:"not null;default:0" json:"cost"`
+	CreatedAt        time.Time `gorm:"index:idx_usage_user_created" json:"created_at"`
+}
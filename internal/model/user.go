@@ -6,19 +6,59 @@ import (
 
 // User 用户模型
 type User struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	Username            string     `gorm:"size:50;not null;unique" json:"username"`
+	Password            string     `gorm:"size:100;not null" json:"-"`
+	Email               string     `gorm:"size:100;unique" json:"email"`
+	DisplayName         string     `gorm:"size:100" json:"display_name"`
+	AvatarURL           string     `gorm:"size:500" json:"avatar_url"`
+	Locale              string     `gorm:"size:20" json:"locale"`                           // 界面语言，如zh-CN
+	Timezone            string     `gorm:"size:50" json:"timezone"`                         // IANA时区，如Asia/Shanghai
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletion_scheduled_at,omitempty"`    // 账户将在该时间后被删除，期间登录可撤销
+	TOTPSecret          string     `gorm:"size:64" json:"-"`                                // 两步验证密钥，Base32编码
+	TOTPEnabled         bool       `gorm:"not null;default:false" json:"totp_enabled"`      // 是否已开启两步验证
+	Role                string     `gorm:"size:50;not null;default:user;index" json:"role"` // 角色，内置user和admin，其余为自定义角色
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`                           // 账户被管理员停用的时间，停用后无法登录
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode 两步验证的恢复码，只保存哈希，每个只能使用一次
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserIdentity 用户在外部身份提供方的账户，通过单点登录关联，同一身份提供方的subject唯一
+type UserIdentity struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"size:50;not null;unique" json:"username"`
-	Password  string    `gorm:"size:100;not null" json:"-"`
-	Email     string    `gorm:"size:100;unique" json:"email"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Issuer    string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email     string    `gorm:"size:100" json:"email"` // 关联时身份提供方返回的邮箱
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// 消息状态
+const (
+	MessageStatusCompleted = "completed"
+	MessageStatusCancelled = "cancelled" // 生成被取消，内容为已生成的部分
+)
+
 // ChatMessage 聊天消息模型
 type ChatMessage struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"not null" json:"user_id"`
-	Content   string    `gorm:"type:text;not null" json:"content"`
-	Role      string    `gorm:"size:20;not null" json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-}
\ No newline at end of file
+	ID              uint        `gorm:"primaryKey" json:"id"`
+	UserID          uint        `gorm:"not null" json:"user_id"`
+	ConversationID  uint        `gorm:"index" json:"conversation_id"`
+	ParentID        *uint       `gorm:"index" json:"parent_id"` // 父消息，同一父消息下的多条消息构成分支
+	Content         string      `gorm:"type:text;not null" json:"content"`
+	Role            string      `gorm:"size:20;not null" json:"role"`
+	PromptVersionID uint        `json:"prompt_version_id,omitempty"`     // 生成该回复时使用的提示词版本
+	Model           string      `gorm:"size:100" json:"model,omitempty"` // 生成该回复的模型
+	Status          string      `gorm:"size:20;not null;default:completed" json:"status"`
+	CreatedAt       time.Time   `json:"created_at"`
+	Trace           []TraceStep `gorm:"foreignKey:MessageID" json:"trace,omitempty"` // 生成该回复的执行步骤，仅在请求时加载
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// 工作区成员角色
+const (
+	WorkspaceRoleOwner  = "owner"  // 管理成员、邀请和工作区设置
+	WorkspaceRoleEditor = "editor" // 上传文档、在工作区会话中发送消息
+	WorkspaceRoleViewer = "viewer" // 查看工作区的文档和会话
+)
+
+// WorkspaceRoles 全部成员角色，按权限从高到低排列
+var WorkspaceRoles = []string{WorkspaceRoleOwner, WorkspaceRoleEditor, WorkspaceRoleViewer}
+
+// Workspace 团队工作区，成员共享文档和会话
+type Workspace struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	CreatedBy uint      `gorm:"not null" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WorkspaceMember 工作区成员，同一用户在一个工作区中只有一个角色
+type WorkspaceMember struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint      `gorm:"not null;uniqueIndex:idx_workspace_member" json:"workspace_id"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_workspace_member;index" json:"user_id"`
+	Role        string    `gorm:"size:20;not null" json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+	User        User      `gorm:"foreignKey:UserID" json:"user"`
+}
+
+// WorkspaceInvitation 发往邮箱的工作区邀请，只保存令牌哈希，接受后失效
+type WorkspaceInvitation struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint       `gorm:"not null;index" json:"workspace_id"`
+	Email       string     `gorm:"size:100;not null" json:"email"`
+	Role        string     `gorm:"size:20;not null" json:"role"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	InvitedBy   uint       `gorm:"not null" json:"invited_by"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// WorkspaceQuota 工作区级配额，字段为空时使用工作区默认配额，工作区会话中的消息同时计入成员和工作区的配额
+type WorkspaceQuota struct {
+	WorkspaceID    uint      `gorm:"primaryKey" json:"workspace_id"`
+	MessagesPerDay *int      `json:"messages_per_day"`
+	TokensPerMonth *int      `json:"tokens_per_month"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Document 工作区知识库中的文档，保存纯文本内容供成员查看和智能体检索
+type Document struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint      `gorm:"not null;index" json:"workspace_id"`
+	UploadedBy  uint      `gorm:"not null" json:"uploaded_by"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	ContentType string    `gorm:"size:100" json:"content_type"`
+	Size        int       `json:"size"` // 内容字节数
+	Content     string    `gorm:"type:longtext;not null" json:"content,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
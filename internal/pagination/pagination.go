@@ -0,0 +1,110 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultLimit 未指定limit时每页返回的条数
+	DefaultLimit = 20
+	// MaxLimit 每页最多返回的条数
+	MaxLimit = 100
+)
+
+var ErrInvalidCursor = errors.New("无效的游标")
+
+// Cursor 游标指向上一页最后一条记录，按created_at和id倒序翻页
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// cursorPayload 游标的编码格式，对客户端不透明
+type cursorPayload struct {
+	T  int64 `json:"t"`
+	ID uint  `json:"id"`
+}
+
+// Encode 将游标编码为URL安全的字符串
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(cursorPayload{T: c.CreatedAt.UnixNano(), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode 解析游标字符串
+func Decode(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.Unix(0, payload.T), ID: payload.ID}, nil
+}
+
+// Page 分页参数，Cursor为空时从第一页开始
+type Page struct {
+	Cursor *Cursor
+	Limit  int
+}
+
+// NewPage 解析游标并将limit限制在[1, MaxLimit]之间
+func NewPage(cursor string, limit int) (Page, error) {
+	page := Page{Limit: limit}
+	if page.Limit <= 0 {
+		page.Limit = DefaultLimit
+	}
+	if page.Limit > MaxLimit {
+		page.Limit = MaxLimit
+	}
+	if cursor != "" {
+		c, err := Decode(cursor)
+		if err != nil {
+			return page, err
+		}
+		page.Cursor = c
+	}
+	return page, nil
+}
+
+// Apply 为查询添加游标条件和排序，多取一条用于判断是否还有下一页
+func (p Page) Apply(db *gorm.DB, table string) *gorm.DB {
+	if p.Limit <= 0 {
+		p.Limit = DefaultLimit
+	}
+	if p.Cursor != nil {
+		db = db.Where("("+table+".created_at < ? OR ("+table+".created_at = ? AND "+table+".id < ?))",
+			p.Cursor.CreatedAt, p.Cursor.CreatedAt, p.Cursor.ID)
+	}
+	return db.Order(table + ".created_at DESC").Order(table + ".id DESC").Limit(p.Limit + 1)
+}
+
+// Result 一页数据，NextCursor为空表示没有更多数据
+type Result[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// NewResult 根据Apply多取的一条记录生成下一页游标，key返回记录的游标
+func NewResult[T any](items []T, page Page, key func(T) Cursor) *Result[T] {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	result := &Result[T]{Items: items}
+	if result.Items == nil {
+		result.Items = []T{}
+	}
+	if len(items) > limit {
+		result.Items = items[:limit]
+		result.NextCursor = key(items[limit-1]).Encode()
+	}
+	return result
+}
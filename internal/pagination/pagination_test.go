@@ -0,0 +1,67 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type item struct {
+	ID        uint
+	CreatedAt time.Time
+}
+
+func itemCursor(i item) Cursor {
+	return Cursor{CreatedAt: i.CreatedAt, ID: i.ID}
+}
+
+func TestCursorEncoding(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2025, 3, 1, 8, 0, 0, 123, time.UTC), ID: 42}
+	decoded, err := Decode(cursor.Encode())
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, uint(42), decoded.ID)
+
+	_, err = Decode("not-a-cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	page, err := NewPage("", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxLimit, page.Limit)
+	page, err = NewPage("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultLimit, page.Limit)
+}
+
+func TestPaginate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&item{}))
+
+	// 部分记录创建时间相同，依靠id区分顺序
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		db.Create(&item{CreatedAt: now.Add(time.Duration(i/2) * time.Second)})
+	}
+
+	var ids []uint
+	cursor := ""
+	for {
+		page, err := NewPage(cursor, 2)
+		assert.NoError(t, err)
+		var items []item
+		assert.NoError(t, page.Apply(db.Model(&item{}), "items").Find(&items).Error)
+		result := NewResult(items, page, itemCursor)
+		for _, i := range result.Items {
+			ids = append(ids, i.ID)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	assert.Equal(t, []uint{5, 4, 3, 2, 1}, ids)
+}
@@ -6,17 +6,48 @@ import (
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent"
 	"github.com/cloudwego/eino/flow/agent/react"
+	"github.com/cloudwego/eino/schema"
 )
 
-func NewAgent(ctx context.Context, chatModel model.ChatModel, tools []tool.BaseTool) (agent *react.Agent, err error) {
+// DefaultPersona 未指定系统提示词时使用的默认人设
+const DefaultPersona = "You are a helpful assistant"
+
+type systemPromptKey struct{}
+
+// Agent 定义对话智能体接口，便于在服务层替换实现
+type Agent interface {
+	Generate(ctx context.Context, input []*schema.Message, opts ...agent.AgentOption) (*schema.Message, error)
+	Stream(ctx context.Context, input []*schema.Message, opts ...agent.AgentOption) (*schema.StreamReader[*schema.Message], error)
+}
+
+func NewAgent(ctx context.Context, chatModel model.ChatModel, tools []tool.BaseTool) (Agent, error) {
 	return react.NewAgent(
 		ctx,
 		&react.AgentConfig{
 			Model:           chatModel,
 			ToolsConfig:     compose.ToolsNodeConfig{Tools: tools},
-			MessageModifier: react.NewPersonaModifier("You are a helpful assistant"),
+			MessageModifier: systemPromptModifier,
 		},
 	)
 
 }
+
+// WithSystemPrompt 设置本次调用使用的系统提示词
+func WithSystemPrompt(ctx context.Context, prompt string) context.Context {
+	return context.WithValue(ctx, systemPromptKey{}, prompt)
+}
+
+// systemPromptModifier 在调用模型前添加系统提示词，未设置时使用默认人设
+func systemPromptModifier(ctx context.Context, input []*schema.Message) []*schema.Message {
+	prompt, _ := ctx.Value(systemPromptKey{}).(string)
+	if prompt == "" {
+		prompt = DefaultPersona
+	}
+
+	res := make([]*schema.Message, 0, len(input)+1)
+	res = append(res, schema.SystemMessage(prompt))
+	res = append(res, input...)
+	return res
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/davlin-coder/davlin/internal/resource/email"
 	"github.com/davlin-coder/davlin/internal/resource/llm"
 	"github.com/davlin-coder/davlin/internal/resource/mysql"
+	"github.com/davlin-coder/davlin/internal/resource/oidc"
 	"github.com/davlin-coder/davlin/internal/resource/redis"
 	"github.com/davlin-coder/davlin/internal/resource/template"
 	"github.com/davlin-coder/davlin/internal/resource/tools"
@@ -38,21 +39,61 @@ func NewContainer() (*Container, error) {
 		// Resource层依赖
 		mysql.Init,
 		llm.NewModel,
+		llm.NewTitleModel,
+		llm.NewModelFactory,
 		tools.NewTools,
 		agent.NewAgent,
 		template.NewTemplateManager,
 		redis.NewRedisClient,
 		email.NewEmailSender,
 		tools.NewJWTManager,
+		oidc.NewProvider,
 
 		// Service层依赖
 		service.NewUserService,
+		service.NewTokenService,
+		service.NewPasswordService,
 		service.NewChatService,
 		service.NewVerificationService,
+		service.NewAttemptGuard,
+		service.NewMFAService,
+		service.NewOIDCService,
+		service.NewAPIKeyService,
+		service.NewRoleService,
+		service.NewAdminService,
+		service.NewModelCatalog,
+		service.NewWorkspaceService,
+		service.NewDocumentService,
+		service.NewDocumentSearcher,
+		service.NewUsageService,
+		service.NewQuotaService,
+		service.NewPromptService,
+		service.NewGenerationRegistry,
+		service.NewTitleService,
+		service.NewSearchService,
+		service.NewExportService,
+		service.NewImportService,
+		service.NewShareService,
+		service.NewFeedbackService,
+		service.NewGatewayService,
 
 		// Controller层依赖
 		controller.NewUserController,
+		controller.NewMFAController,
+		controller.NewOIDCController,
+		controller.NewAPIKeyController,
+		controller.NewAdminController,
+		controller.NewWorkspaceController,
+		controller.NewDocumentController,
 		controller.NewChatController,
+		controller.NewUsageController,
+		controller.NewPromptController,
+		controller.NewExportController,
+		controller.NewImportController,
+		controller.NewShareController,
+		controller.NewFeedbackController,
+		controller.NewOpenAIController,
+		controller.NewWebSocketController,
 
 		// Router依赖
 		router.NewRouter,
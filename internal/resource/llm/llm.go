@@ -4,13 +4,44 @@ import (
 	"context"
 
 	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
 	"github.com/davlin-coder/davlin/internal/config"
 )
 
-func NewModel(ctx context.Context, cfg *config.Config) (*openai.ChatModel, error) {
+// TitleModel 生成会话标题等辅助任务使用的低成本模型
+type TitleModel model.ChatModel
+
+func NewModel(ctx context.Context, cfg *config.Config) (model.ChatModel, error) {
 	return openai.NewChatModel(ctx, &openai.ChatModelConfig{
 		Model:   cfg.LLM.Model,
 		APIKey:  cfg.LLM.APIKey,
 		BaseURL: cfg.LLM.BaseURL,
 	})
 }
+
+// NewTitleModel 创建标题生成模型，未配置title_model时使用主模型
+func NewTitleModel(ctx context.Context, cfg *config.Config) (TitleModel, error) {
+	modelName := cfg.LLM.TitleModel
+	if modelName == "" {
+		modelName = cfg.LLM.Model
+	}
+	return openai.NewChatModel(ctx, &openai.ChatModelConfig{
+		Model:   modelName,
+		APIKey:  cfg.LLM.APIKey,
+		BaseURL: cfg.LLM.BaseURL,
+	})
+}
+
+// ModelFactory 按模型名称创建使用同一服务商配置的模型，每次返回新实例，可以安全地绑定工具
+type ModelFactory func(ctx context.Context, name string) (model.ChatModel, error)
+
+// NewModelFactory 创建模型工厂
+func NewModelFactory(cfg *config.Config) ModelFactory {
+	return func(ctx context.Context, name string) (model.ChatModel, error) {
+		return openai.NewChatModel(ctx, &openai.ChatModelConfig{
+			Model:   name,
+			APIKey:  cfg.LLM.APIKey,
+			BaseURL: cfg.LLM.BaseURL,
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keysRefreshInterval 遇到未知kid时重新拉取JWKS的最小间隔，避免伪造kid触发大量请求
+const keysRefreshInterval = time.Minute
+
+var ErrNotConfigured = errors.New("未配置单点登录")
+
+// Metadata 身份提供方发现文档中使用到的字段
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider OpenID Connect身份提供方客户端，使用授权码+PKCE流程
+type Provider interface {
+	// Enabled 是否配置了身份提供方
+	Enabled() bool
+	// AuthCodeURL 生成跳转到身份提供方的授权地址
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange 使用授权码和PKCE verifier换取ID令牌
+	Exchange(ctx context.Context, code, verifier string) (string, error)
+	// VerifyIDToken 校验ID令牌的签名、签发者、受众、有效期和nonce，返回全部claim
+	VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (map[string]interface{}, error)
+}
+
+type provider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// NewProvider 创建身份提供方客户端，发现文档在首次使用时读取
+func NewProvider(cfg *config.Config) Provider {
+	return &provider{
+		cfg:    cfg.OIDC,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// PKCEChallenge 计算S256方式的code_challenge
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *provider) Enabled() bool {
+	return p.cfg.Issuer != "" && p.cfg.ClientID != ""
+}
+
+func (p *provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.scopes(), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", PKCEChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (p *provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return "", fmt.Errorf("换取令牌失败: %v", err)
+	}
+	if status != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("换取令牌失败: %d %s %s", status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("换取令牌失败: 响应中没有id_token")
+	}
+	return token.IDToken, nil
+}
+
+func (p *provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (map[string]interface{}, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, metadata, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID令牌无效: %v", err)
+	}
+
+	// 存在多个受众时，azp必须是本客户端
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, errors.New("ID令牌无效: azp与客户端不匹配")
+		}
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("ID令牌无效: nonce不匹配")
+	}
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, errors.New("ID令牌无效: 缺少sub")
+	}
+	return claims, nil
+}
+
+func (p *provider) scopes() []string {
+	for _, scope := range p.cfg.Scopes {
+		if scope == "openid" {
+			return p.cfg.Scopes
+		}
+	}
+	return append([]string{"openid"}, p.cfg.Scopes...)
+}
+
+// discover 读取并缓存发现文档，签发者必须与配置一致
+func (p *provider) discover(ctx context.Context) (*Metadata, error) {
+	if !p.Enabled() {
+		return nil, ErrNotConfigured
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	status, err := p.doJSON(req, &metadata)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("读取身份提供方配置失败: %d %v", status, err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("身份提供方issuer不匹配: %s", metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("身份提供方配置缺少必要的端点")
+	}
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// key 按kid查找验证公钥，未找到时重新拉取JWKS以支持身份提供方轮换密钥
+func (p *provider) key(ctx context.Context, metadata *Metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keysRefreshInterval {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("读取身份提供方公钥失败: %d %v", status, err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+}
+
+// lookup 令牌未指定kid时，只在身份提供方仅有一个密钥的情况下使用该密钥
+func (p *provider) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *provider) doJSON(req *http.Request, out interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+// jsonWebKey JWKS中的公钥
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("无效的Ed25519公钥")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,164 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A4页面尺寸及边距，单位为point
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+	margin     = 50.0
+)
+
+// Document 纯Go实现的简单PDF文档，只支持逐段输出文本。
+// 文字使用阅读器内置的STSong-Light字体(Adobe-GB1)，无需嵌入字体即可显示中文
+type Document struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+// New 创建空白文档
+func New() *Document {
+	d := &Document{}
+	d.addPage()
+	return d
+}
+
+// Heading 输出标题
+func (d *Document) Heading(text string) {
+	d.write(text, 16, 0)
+	d.Space(4)
+}
+
+// Paragraph 输出正文，按页面宽度自动换行
+func (d *Document) Paragraph(text string) {
+	d.write(text, 10.5, 0)
+}
+
+// Note 输出灰色小字，用于时间、工具调用等附注
+func (d *Document) Note(text string) {
+	d.write(text, 8.5, 0.45)
+}
+
+// Space 输出空白
+func (d *Document) Space(height float64) {
+	d.y -= height
+}
+
+// write 按段落和页面宽度拆分文本逐行输出，gray为0时使用黑色
+func (d *Document) write(text string, size, gray float64) {
+	leading := size * 1.5
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		for _, line := range wrap(paragraph, (pageWidth-2*margin)/size) {
+			if d.y-leading < margin {
+				d.addPage()
+			}
+			d.y -= leading
+			fmt.Fprintf(d.pages[len(d.pages)-1], "BT %.2f g /F1 %.1f Tf %.2f %.2f Td <%s> Tj ET\n",
+				gray, size, margin, d.y, encode(line))
+		}
+	}
+}
+
+func (d *Document) addPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+// wrap 按宽度拆分一行文本，宽度以字号为单位，英文字符计半宽，优先在空格处断行
+func wrap(text string, width float64) []string {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	start, lastSpace := 0, -1
+	current := 0.0
+	for i := 0; i < len(runes); i++ {
+		w := runeWidth(runes[i])
+		if current+w > width && i > start {
+			end := i
+			if lastSpace > start {
+				end = lastSpace + 1
+			}
+			lines = append(lines, strings.TrimRight(string(runes[start:end]), " "))
+			start, lastSpace = end, -1
+			current = 0
+			for _, r := range runes[start:i] {
+				current += runeWidth(r)
+			}
+		}
+		if runes[i] == ' ' {
+			lastSpace = i
+		}
+		current += w
+	}
+	return append(lines, string(runes[start:]))
+}
+
+// runeWidth 字符宽度，与字体的W数组一致
+func runeWidth(r rune) float64 {
+	if r < 0x80 {
+		return 0.5
+	}
+	return 1
+}
+
+// encode 将文本编码为UCS-2大端十六进制串，不支持的字符替换为问号
+func encode(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			r = ' '
+		case r < 0x20 || r > 0xFFFF || r == utf8.RuneError:
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// Bytes 生成PDF文件内容
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	// 1-5号对象为目录、页面树和字体，之后每页占用页面和内容流两个对象
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+i*2)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> " +
+		"/FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>")
+	object("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 7+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
@@ -13,6 +13,10 @@ type RedisClient interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
 	Del(ctx context.Context, key string) error
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	IncrBy(ctx context.Context, key string, value int64) (int64, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
 }
 
 type redisClient struct {
@@ -51,3 +55,19 @@ func (r *redisClient) Get(ctx context.Context, key string) (string, error) {
 func (r *redisClient) Del(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
+
+func (r *redisClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (r *redisClient) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
+	return r.client.IncrBy(ctx, key, value).Result()
+}
+
+func (r *redisClient) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return r.client.Expire(ctx, key, expiration).Err()
+}
+
+func (r *redisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return r.client.TTL(ctx, key).Result()
+}
@@ -4,8 +4,8 @@ import (
 	"embed"
 )
 
-//go:embed templates/verification_email.html
-var verificationEmailTemplate embed.FS
+//go:embed templates/verification_email.html templates/password_reset_email.html templates/workspace_invitation_email.html
+var emailTemplates embed.FS
 
 // VerificationEmailData 验证码邮件模板数据
 type VerificationEmailData struct {
@@ -13,11 +13,32 @@ type VerificationEmailData struct {
 	ExpireMinutes int
 }
 
+// PasswordResetEmailData 重置密码邮件模板数据
+type PasswordResetEmailData struct {
+	Username      string
+	Link          string
+	ExpireMinutes int
+}
+
+// WorkspaceInvitationEmailData 工作区邀请邮件模板数据
+type WorkspaceInvitationEmailData struct {
+	Inviter    string
+	Workspace  string
+	Role       string
+	Link       string
+	ExpireDays int
+}
+
 // InitDefaultTemplates 初始化默认模板
 func (tm *templateManager) InitDefaultTemplates() error {
-	templateContent, err := verificationEmailTemplate.ReadFile("templates/verification_email.html")
-	if err != nil {
-		return err
+	for _, name := range []string{"verification_email", "password_reset_email", "workspace_invitation_email"} {
+		templateContent, err := emailTemplates.ReadFile("templates/" + name + ".html")
+		if err != nil {
+			return err
+		}
+		if err := tm.AddTemplate(name, string(templateContent)); err != nil {
+			return err
+		}
 	}
-	return tm.AddTemplate("verification_email", string(templateContent))
+	return nil
 }
@@ -0,0 +1,10 @@
+package template
+
+import (
+	_ "embed"
+)
+
+// ConversationMarkdown 会话导出为Markdown的文本模板，配合RenderText使用
+//
+//go:embed templates/conversation_export.md
+var ConversationMarkdown string
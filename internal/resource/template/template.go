@@ -3,6 +3,7 @@ package template
 import (
 	"bytes"
 	"html/template"
+	texttemplate "text/template"
 )
 
 // TemplateManager 定义模板管理接口
@@ -11,6 +12,8 @@ type TemplateManager interface {
 	ExecuteTemplate(name string, data interface{}) (string, error)
 	// AddTemplate 添加新模板
 	AddTemplate(name, content string) error
+	// RenderText 以纯文本模板渲染内容，不做HTML转义
+	RenderText(content string, data interface{}) (string, error)
 }
 
 // templateManager 实现模板管理接口
@@ -44,3 +47,16 @@ func (tm *templateManager) AddTemplate(name, content string) error {
 	_, err := tm.templates.New(name).Parse(content)
 	return err
 }
+
+// RenderText 以纯文本模板渲染内容
+func (tm *templateManager) RenderText(content string, data interface{}) (string, error) {
+	tmpl, err := texttemplate.New("").Option("missingkey=zero").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
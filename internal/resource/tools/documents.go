@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// searchDocumentsLimit 每次检索返回的最大片段数
+const searchDocumentsLimit = 5
+
+type workspaceKey struct{}
+
+// DocumentSnippet 检索命中的文档片段
+type DocumentSnippet struct {
+	DocumentID uint   `json:"document_id"`
+	Name       string `json:"name"`
+	Snippet    string `json:"snippet"`
+}
+
+// DocumentSearcher 在工作区知识库中检索文档，由服务层实现
+type DocumentSearcher interface {
+	SearchDocuments(ctx context.Context, workspaceID uint, query string, limit int) ([]DocumentSnippet, error)
+}
+
+// WithWorkspace 设置本次调用所属的工作区，知识库检索只在该工作区内进行
+func WithWorkspace(ctx context.Context, workspaceID uint) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, workspaceID)
+}
+
+// WorkspaceFromContext 返回本次调用所属的工作区，个人会话返回0
+func WorkspaceFromContext(ctx context.Context) uint {
+	workspaceID, _ := ctx.Value(workspaceKey{}).(uint)
+	return workspaceID
+}
+
+// searchDocumentsTool 供智能体检索当前会话所属工作区的知识库
+type searchDocumentsTool struct {
+	searcher DocumentSearcher
+}
+
+// NewSearchDocumentsTool 创建知识库检索工具
+func NewSearchDocumentsTool(searcher DocumentSearcher) tool.InvokableTool {
+	return &searchDocumentsTool{searcher: searcher}
+}
+
+func (t *searchDocumentsTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: "search_documents",
+		Desc: "Search the team knowledge base shared in the current workspace. Use it when the question may be answered by the team's documents.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"query": {
+				Type:     schema.String,
+				Desc:     "Keywords to search for, separated by spaces.",
+				Required: true,
+			},
+		}),
+	}, nil
+}
+
+func (t *searchDocumentsTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	workspaceID := WorkspaceFromContext(ctx)
+	if workspaceID == 0 {
+		return "This conversation does not belong to a workspace, so there is no knowledge base to search.", nil
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "The query is empty.", nil
+	}
+
+	snippets, err := t.searcher.SearchDocuments(ctx, workspaceID, args.Query, searchDocumentsLimit)
+	if err != nil {
+		return "", err
+	}
+	if len(snippets) == 0 {
+		return "No matching documents found.", nil
+	}
+	result, err := json.Marshal(snippets)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
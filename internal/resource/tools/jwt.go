@@ -1,7 +1,16 @@
 package tools
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"math/big"
+	"os"
+	"sort"
 	"time"
 
 	"github.com/davlin-coder/davlin/internal/config"
@@ -10,35 +19,163 @@ import (
 
 // JWTClaims 定义JWT的payload结构
 type JWTClaims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"` // 登录会话ID，即刷新令牌家族ID
 	jwt.RegisteredClaims
 }
 
+// tokenIssuer 令牌签发者，验证时同样校验
+const tokenIssuer = "davlin-auth"
+
+// signingKey 已加载的非对称密钥
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	notBefore time.Time
+	notAfter  time.Time // 零值表示不过期
+}
+
+// active 密钥在该时间点是否可用于签名
+func (k *signingKey) active(now time.Time) bool {
+	return !now.Before(k.notBefore) && k.valid(now)
+}
+
+// valid 密钥在该时间点是否可用于验证和公开，未到签名时间的密钥也会提前公开
+func (k *signingKey) valid(now time.Time) bool {
+	return k.notAfter.IsZero() || now.Before(k.notAfter)
+}
+
+// JWK JSON Web Key中的公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
 // JWTManager JWT管理器
 type JWTManager struct {
-	config *config.JWTConfig
+	config      *config.JWTConfig
+	keys        []*signingKey // 按not_before升序
+	legacyUntil time.Time     // 配置keys后接受HS256令牌的截止时间，零值表示不接受
+}
+
+// NewJWTManager 创建JWT管理器实例，配置了非对称密钥时从文件加载
+func NewJWTManager(cfg *config.Config) (*JWTManager, error) {
+	m := &JWTManager{config: &cfg.JWT}
+	for _, keyConfig := range cfg.JWT.Keys {
+		key, err := loadSigningKey(keyConfig)
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+	}
+	sort.SliceStable(m.keys, func(i, j int) bool {
+		return m.keys[i].notBefore.Before(m.keys[j].notBefore)
+	})
+	if cfg.JWT.LegacyHS256Until != "" {
+		var err error
+		if m.legacyUntil, err = time.Parse(time.RFC3339, cfg.JWT.LegacyHS256Until); err != nil {
+			return nil, fmt.Errorf("JWT配置legacy_hs256_until格式错误: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// loadSigningKey 读取PEM私钥并解析轮换时间
+func loadSigningKey(cfg config.JWTKey) (*signingKey, error) {
+	if cfg.ID == "" {
+		return nil, fmt.Errorf("JWT密钥缺少id")
+	}
+	data, err := os.ReadFile(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("读取JWT密钥%s失败: %v", cfg.ID, err)
+	}
+
+	key := &signingKey{id: cfg.ID}
+	switch cfg.Algorithm {
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		key.private, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		var private crypto.PrivateKey
+		private, err = jwt.ParseEdPrivateKeyFromPEM(data)
+		if err == nil {
+			key.private = private.(ed25519.PrivateKey)
+		}
+	default:
+		return nil, fmt.Errorf("JWT密钥%s的算法不受支持: %s", cfg.ID, cfg.Algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析JWT密钥%s失败: %v", cfg.ID, err)
+	}
+
+	if cfg.NotBefore != "" {
+		if key.notBefore, err = time.Parse(time.RFC3339, cfg.NotBefore); err != nil {
+			return nil, fmt.Errorf("JWT密钥%s的not_before格式错误: %v", cfg.ID, err)
+		}
+	}
+	if cfg.NotAfter != "" {
+		if key.notAfter, err = time.Parse(time.RFC3339, cfg.NotAfter); err != nil {
+			return nil, fmt.Errorf("JWT密钥%s的not_after格式错误: %v", cfg.ID, err)
+		}
+	}
+	return key, nil
 }
 
-// NewJWTManager 创建JWT管理器实例
-func NewJWTManager(cfg *config.Config) *JWTManager {
-	return &JWTManager{config: &cfg.JWT}
+// AccessTTL 访问令牌有效期
+func (m *JWTManager) AccessTTL() time.Duration {
+	return m.config.AccessExpire * time.Minute
 }
 
-// GenerateToken 生成JWT令牌
-func (m *JWTManager) GenerateToken(userID uint, username string) (string, error) {
+// RefreshTTL 刷新令牌有效期，即一次登录会话的最长时间
+func (m *JWTManager) RefreshTTL() time.Duration {
+	return m.config.Expire * time.Hour
+}
+
+// GenerateToken 生成短期访问令牌，每个令牌带有唯一的jti用于注销
+func (m *JWTManager) GenerateToken(userID uint, username, sessionID string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("生成token失败: %v", err)
+	}
+
 	claims := JWTClaims{
-		Username: username,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
 			Subject:   fmt.Sprintf("%d", userID),
-			Issuer:    "davlin-auth",
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.config.Expire * time.Hour)),
+			Issuer:    tokenIssuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.AccessTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(m.config.SecretKey))
+	var tokenString string
+	var err error
+	if key := m.signingKey(time.Now()); key != nil {
+		token := jwt.NewWithClaims(key.method, claims)
+		token.Header["kid"] = key.id
+		tokenString, err = token.SignedString(key.private)
+	} else if len(m.keys) > 0 {
+		err = fmt.Errorf("没有处于签名期的JWT密钥")
+	} else {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		tokenString, err = token.SignedString([]byte(m.config.SecretKey))
+	}
 	if err != nil {
 		return "", fmt.Errorf("生成token失败: %v", err)
 	}
@@ -46,11 +183,38 @@ func (m *JWTManager) GenerateToken(userID uint, username string) (string, error)
 	return tokenString, nil
 }
 
-// ParseToken 解析JWT令牌
+// signingKey 返回当前用于签名的密钥，即已生效密钥中最新的一个，未配置密钥时返回nil
+func (m *JWTManager) signingKey(now time.Time) *signingKey {
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if m.keys[i].active(now) {
+			return m.keys[i]
+		}
+	}
+	return nil
+}
+
+// ParseToken 解析JWT令牌，按kid选择验证密钥。没有kid的HS256令牌仅在未配置keys，
+// 或迁移期legacy_hs256_until之前使用secret_key验证
 func (m *JWTManager) ParseToken(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(m.config.SecretKey), nil
-	})
+		now := time.Now()
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if !m.acceptsHS256(now) || token.Method != jwt.SigningMethodHS256 {
+				return nil, fmt.Errorf("缺少kid")
+			}
+			return []byte(m.config.SecretKey), nil
+		}
+		for _, key := range m.keys {
+			if key.id == kid && key.valid(now) {
+				if token.Method != key.method {
+					return nil, fmt.Errorf("签名算法与密钥不匹配")
+				}
+				return key.private.Public(), nil
+			}
+		}
+		return nil, fmt.Errorf("未知的kid: %s", kid)
+	}, jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}), jwt.WithIssuer(tokenIssuer))
 
 	if err != nil {
 		return nil, fmt.Errorf("解析token失败: %v", err)
@@ -62,3 +226,35 @@ func (m *JWTManager) ParseToken(tokenString string) (*JWTClaims, error) {
 
 	return nil, fmt.Errorf("无效的token")
 }
+
+// acceptsHS256 是否接受secret_key签名的令牌
+func (m *JWTManager) acceptsHS256(now time.Time) bool {
+	if m.config.SecretKey == "" {
+		return false
+	}
+	return len(m.keys) == 0 || now.Before(m.legacyUntil)
+}
+
+// JWKS 返回当前可用于验证的公钥，包括尚未开始签名的密钥，便于其他服务提前缓存
+func (m *JWTManager) JWKS() JWKS {
+	now := time.Now()
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range m.keys {
+		if !key.valid(now) {
+			continue
+		}
+		jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeKey 生成私钥并写入临时PEM文件
+func writeKey(t *testing.T, algorithm string) string {
+	var private interface{}
+	switch algorithm {
+	case "RS256":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		private = key
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+		private = key
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), algorithm+".pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	return path
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	now := time.Now().UTC()
+	legacy, err := NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", AccessExpire: 15}})
+	assert.NoError(t, err)
+	legacyToken, err := legacy.GenerateToken(1, "alice", "")
+	assert.NoError(t, err)
+
+	cfg := &config.Config{JWT: config.JWTConfig{SecretKey: "secret", AccessExpire: 15, LegacyHS256Until: now.Add(time.Hour).Format(time.RFC3339), Keys: []config.JWTKey{
+		{ID: "old", Algorithm: "RS256", PrivateKey: writeKey(t, "RS256"), NotAfter: now.Add(time.Hour).Format(time.RFC3339)},
+		{ID: "current", Algorithm: "EdDSA", PrivateKey: writeKey(t, "EdDSA"), NotBefore: now.Add(-time.Minute).Format(time.RFC3339)},
+		{ID: "next", Algorithm: "RS256", PrivateKey: writeKey(t, "RS256"), NotBefore: now.Add(time.Hour).Format(time.RFC3339)},
+		{ID: "retired", Algorithm: "EdDSA", PrivateKey: writeKey(t, "EdDSA"), NotAfter: now.Add(-time.Minute).Format(time.RFC3339)},
+	}}}
+	manager, err := NewJWTManager(cfg)
+	assert.NoError(t, err)
+
+	// 使用已生效密钥中最新的一个签名
+	token, err := manager.GenerateToken(1, "alice", "session")
+	assert.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &JWTClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "current", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+	claims, err := manager.ParseToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", claims.Username)
+
+	// 重叠期内旧密钥签发的令牌仍可验证，迁移期内HS256令牌也可验证
+	old := manager.keys[0]
+	assert.Equal(t, "old", old.id)
+	oldToken := jwt.NewWithClaims(old.method, JWTClaims{Username: "bob", RegisteredClaims: jwt.RegisteredClaims{Issuer: tokenIssuer}})
+	oldToken.Header["kid"] = old.id
+	signed, err := oldToken.SignedString(old.private)
+	assert.NoError(t, err)
+	_, err = manager.ParseToken(signed)
+	assert.NoError(t, err)
+	_, err = manager.ParseToken(legacyToken)
+	assert.NoError(t, err)
+
+	// 已过期的密钥不再验证
+	var retired *signingKey
+	for _, key := range manager.keys {
+		if key.id == "retired" {
+			retired = key
+		}
+	}
+	retiredToken := jwt.NewWithClaims(retired.method, JWTClaims{RegisteredClaims: jwt.RegisteredClaims{Issuer: tokenIssuer}})
+	retiredToken.Header["kid"] = retired.id
+	signed, err = retiredToken.SignedString(retired.private)
+	assert.NoError(t, err)
+	_, err = manager.ParseToken(signed)
+	assert.Error(t, err)
+
+	// JWKS提前公开下一个密钥，不包含已过期的密钥
+	var kids []string
+	for _, key := range manager.JWKS().Keys {
+		kids = append(kids, key.Kid)
+		switch key.Alg {
+		case "RS256":
+			assert.Equal(t, "RSA", key.Kty)
+			assert.Equal(t, "AQAB", key.E)
+		case "EdDSA":
+			assert.Equal(t, "OKP", key.Kty)
+			assert.Equal(t, "Ed25519", key.Crv)
+		}
+	}
+	assert.ElementsMatch(t, []string{"old", "current", "next"}, kids)
+}
+
+func TestJWTRejectsAlgorithmConfusion(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{AccessExpire: 15, Keys: []config.JWTKey{
+		{ID: "rsa", Algorithm: "RS256", PrivateKey: writeKey(t, "RS256")},
+	}}}
+	manager, err := NewJWTManager(cfg)
+	assert.NoError(t, err)
+
+	// 未配置secret_key时不接受HS256令牌
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{RegisteredClaims: jwt.RegisteredClaims{Issuer: tokenIssuer}})
+	signed, err := forged.SignedString([]byte(""))
+	assert.NoError(t, err)
+	_, err = manager.ParseToken(signed)
+	assert.Error(t, err)
+
+	// kid对应的密钥算法必须与令牌一致
+	forged.Header["kid"] = "rsa"
+	signed, err = forged.SignedString([]byte("anything"))
+	assert.NoError(t, err)
+	_, err = manager.ParseToken(signed)
+	assert.Error(t, err)
+
+	_, err = NewJWTManager(&config.Config{JWT: config.JWTConfig{Keys: []config.JWTKey{{ID: "bad", Algorithm: "HS512", PrivateKey: writeKey(t, "EdDSA")}}}})
+	assert.Error(t, err)
+}
+
+func TestJWTLegacyHS256Window(t *testing.T) {
+	legacy, err := NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", AccessExpire: 15}})
+	assert.NoError(t, err)
+	token, err := legacy.GenerateToken(1, "alice", "")
+	assert.NoError(t, err)
+	keys := []config.JWTKey{{ID: "current", Algorithm: "EdDSA", PrivateKey: writeKey(t, "EdDSA")}}
+
+	// 配置keys后即使保留secret_key，未设置迁移期也不接受HS256令牌
+	manager, err := NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", AccessExpire: 15, Keys: keys}})
+	assert.NoError(t, err)
+	_, err = manager.ParseToken(token)
+	assert.Error(t, err)
+
+	// 迁移期结束后不再接受
+	expired := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	manager, err = NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", AccessExpire: 15, Keys: keys, LegacyHS256Until: expired}})
+	assert.NoError(t, err)
+	_, err = manager.ParseToken(token)
+	assert.Error(t, err)
+
+	_, err = NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", Keys: keys, LegacyHS256Until: "tomorrow"}})
+	assert.Error(t, err)
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/cloudwego/eino/components/tool"
 )
 
-func NewTools(ctx context.Context) (tools []tool.BaseTool, err error) {
+func NewTools(ctx context.Context, searcher DocumentSearcher) (tools []tool.BaseTool, err error) {
 	config := &duckduckgo.Config{
 		MaxResults: 5, // Limit to return 3 results
 		Region:     ddgsearch.RegionCN,
@@ -25,5 +25,6 @@ func NewTools(ctx context.Context) (tools []tool.BaseTool, err error) {
 	}
 	return []tool.BaseTool{
 		duckduckTools,
+		NewSearchDocumentsTool(searcher),
 	}, nil
 }
\ No newline at end of file
@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238附录B的SHA1测试向量，取后6位
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range cases {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+	now := time.Now()
+
+	code, err := TOTPCode(secret, TOTPStep(now))
+	assert.NoError(t, err)
+	step, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, TOTPStep(now), step)
+
+	// 容忍前后一个时间步的时钟偏差
+	_, ok = ValidateTOTP(secret, code, now.Add(TOTPPeriod))
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(secret, code, now.Add(3*TOTPPeriod))
+	assert.False(t, ok)
+	_, ok = ValidateTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Davlin", "alice@example.com", "ABCDEF"))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Davlin:alice@example.com", uri.Path)
+	assert.Equal(t, "ABCDEF", uri.Query().Get("secret"))
+	assert.Equal(t, "Davlin", uri.Query().Get("issuer"))
+}
@@ -1,33 +1,91 @@
 package router
 
 import (
+	"log"
+
+	"github.com/davlin-coder/davlin/internal/config"
 	"github.com/davlin-coder/davlin/internal/controller"
 	"github.com/davlin-coder/davlin/internal/middleware"
+	"github.com/davlin-coder/davlin/internal/model"
 	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/davlin-coder/davlin/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
 type Router struct {
-	userController   controller.UserController
-	chatController   controller.ChatController
-	healthController controller.HealthController
-	jwtManager       *tools.JWTManager
+	userController      controller.UserController
+	mfaController       controller.MFAController
+	oidcController      controller.OIDCController
+	apiKeyController    controller.APIKeyController
+	adminController     controller.AdminController
+	workspaceController controller.WorkspaceController
+	documentController  controller.DocumentController
+	chatController      controller.ChatController
+	usageController     controller.UsageController
+	promptController    controller.PromptController
+	exportController    controller.ExportController
+	importController    controller.ImportController
+	shareController     controller.ShareController
+	feedbackController  controller.FeedbackController
+	openAIController    controller.OpenAIController
+	wsController        controller.WebSocketController
+	healthController    controller.HealthController
+	jwksController      controller.JWKSController
+	jwtManager          *tools.JWTManager
+	tokenService        service.TokenService
+	apiKeyService       service.APIKeyService
+	roleService         service.RoleService
+	cfg                 *config.Config
 }
 
-func NewRouter(userController controller.UserController, chatController controller.ChatController, jwtManager *tools.JWTManager) *gin.Engine {
+func NewRouter(userController controller.UserController, mfaController controller.MFAController, oidcController controller.OIDCController, apiKeyController controller.APIKeyController, adminController controller.AdminController, workspaceController controller.WorkspaceController, documentController controller.DocumentController, chatController controller.ChatController, usageController controller.UsageController, promptController controller.PromptController, exportController controller.ExportController, importController controller.ImportController, shareController controller.ShareController, feedbackController controller.FeedbackController, openAIController controller.OpenAIController, wsController controller.WebSocketController, jwtManager *tools.JWTManager, tokenService service.TokenService, apiKeyService service.APIKeyService, roleService service.RoleService, cfg *config.Config) *gin.Engine {
 	healthController := controller.NewHealthController()
+	jwksController := controller.NewJWKSController(jwtManager)
 	router := &Router{
-		userController:   userController,
-		chatController:   chatController,
-		healthController: healthController,
-		jwtManager:       jwtManager,
+		userController:      userController,
+		mfaController:       mfaController,
+		oidcController:      oidcController,
+		apiKeyController:    apiKeyController,
+		adminController:     adminController,
+		workspaceController: workspaceController,
+		documentController:  documentController,
+		chatController:      chatController,
+		usageController:     usageController,
+		promptController:    promptController,
+		exportController:    exportController,
+		importController:    importController,
+		shareController:     shareController,
+		feedbackController:  feedbackController,
+		openAIController:    openAIController,
+		wsController:        wsController,
+		healthController:    healthController,
+		jwksController:      jwksController,
+		jwtManager:          jwtManager,
+		tokenService:        tokenService,
+		apiKeyService:       apiKeyService,
+		roleService:         roleService,
+		cfg:                 cfg,
 	}
 	return router.InitRouter()
 }
 
 func (r *Router) InitRouter() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
+	router := gin.New()
+	router.Use(middleware.AccessLog(), gin.Recovery())
+	// 未配置可信代理时不信任X-Forwarded-For，避免伪造IP绕过登录限流
+	if err := router.SetTrustedProxies(r.cfg.APP.TrustedProxies); err != nil {
+		log.Printf("可信代理配置无效: %v", err)
+	}
+
+	// auth 认证中间件，scopes为允许API密钥访问的范围，为空时只允许登录会话访问
+	auth := func(scopes ...string) gin.HandlerFunc {
+		return middleware.Auth(r.jwtManager, r.tokenService, r.apiKeyService, scopes...)
+	}
+	// can 权限中间件，需在auth之后使用
+	can := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(r.roleService, permission)
+	}
 
 	// 添加全局中间件
 	router.Use(middleware.Cors())
@@ -36,6 +94,19 @@ func (r *Router) InitRouter() *gin.Engine {
 	// 健康检查路由
 	router.GET("/health", r.healthController.Check)
 
+	// 令牌验证公钥，供其他服务验证Davlin签发的令牌
+	router.GET("/.well-known/jwks.json", r.jwksController.Keys)
+
+	// 公开的会话分享，无需认证
+	router.GET("/share/:token", r.shareController.GetShare)
+
+	// OpenAI兼容接口，供OpenAI SDK和IDE插件使用
+	openAIGroup := router.Group("/v1", auth(model.APIKeyScopeChat))
+	{
+		openAIGroup.POST("/chat/completions", r.openAIController.ChatCompletions)
+		openAIGroup.GET("/models", r.openAIController.ListModels)
+	}
+
 	// API 版本分组
 	v1 := router.Group("/api/v1")
 	{
@@ -44,17 +115,130 @@ func (r *Router) InitRouter() *gin.Engine {
 		{
 			userGroup.POST("/register", r.userController.Register)
 			userGroup.POST("/login", r.userController.Login)
+			userGroup.POST("/login/mfa", r.userController.LoginMFA)
 			userGroup.POST("/verify-code", r.userController.SendVerificationCode)
+			userGroup.POST("/refresh", r.userController.Refresh)
+			userGroup.POST("/logout", auth(), r.userController.Logout)
+			userGroup.POST("/password/forgot", r.userController.ForgotPassword)
+			userGroup.POST("/password/reset", r.userController.ResetPassword)
 		}
 
-		// 需要认证的路由组
-		authGroup := v1.Group("", middleware.Auth(r.jwtManager))
+		// OpenID Connect单点登录
+		oidcGroup := v1.Group("/auth/oidc")
+		{
+			oidcGroup.GET("/login", r.oidcController.Login)
+			oidcGroup.GET("/callback", r.oidcController.Callback)
+		}
+
+		// WebSocket聊天，浏览器可通过token查询参数认证
+		v1.GET("/ws", middleware.QueryToken(), auth(model.APIKeyScopeChat), r.wsController.Connect)
+
+		// 需要认证的路由组，各分组分别指定API密钥可访问的范围
+		authGroup := v1.Group("")
 		{
 			// 聊天相关路由
-			chatGroup := authGroup.Group("/chat")
+			chatGroup := authGroup.Group("/chat", auth(model.APIKeyScopeChat))
 			{
 				chatGroup.POST("/message", r.chatController.SendMessage)
 				chatGroup.GET("/history", r.chatController.GetChatHistory)
+				chatGroup.GET("/search", r.chatController.Search)
+				chatGroup.POST("/messages/:id/regenerate", r.chatController.Regenerate)
+				chatGroup.POST("/messages/:id/edit", r.chatController.EditMessage)
+				chatGroup.PUT("/messages/:id/feedback", r.feedbackController.SubmitFeedback)
+				chatGroup.DELETE("/messages/:id/feedback", r.feedbackController.DeleteFeedback)
+				chatGroup.GET("/conversations", r.chatController.ListConversations)
+				chatGroup.GET("/conversations/export", r.exportController.ExportAll)
+				chatGroup.GET("/conversations/:id/export", r.exportController.ExportConversation)
+				chatGroup.POST("/import", r.importController.Import)
+				chatGroup.GET("/import/:id", r.importController.GetJob)
+				chatGroup.GET("/conversations/:id/messages", r.chatController.GetConversationMessages)
+				chatGroup.PUT("/conversations/:id/branch", r.chatController.SwitchBranch)
+				chatGroup.POST("/conversations/:id/cancel", r.chatController.CancelGeneration)
+				chatGroup.PUT("/conversations/:id/title", r.chatController.RenameConversation)
+				chatGroup.POST("/conversations/:id/share", r.shareController.CreateShare)
+				chatGroup.GET("/shares", r.shareController.ListShares)
+				chatGroup.DELETE("/shares/:id", r.shareController.RevokeShare)
+			}
+
+			// 当前用户的账户管理
+			meGroup := authGroup.Group("/me", auth())
+			{
+				meGroup.GET("", r.userController.GetProfile)
+				meGroup.PATCH("", r.userController.UpdateProfile)
+				meGroup.DELETE("", r.userController.DeleteAccount)
+				meGroup.POST("/password", r.userController.ChangePassword)
+				meGroup.POST("/email", r.userController.RequestEmailChange)
+				meGroup.POST("/email/verify", r.userController.ConfirmEmailChange)
+				meGroup.POST("/mfa/totp", r.mfaController.Enroll)
+				meGroup.POST("/mfa/totp/confirm", r.mfaController.Confirm)
+				meGroup.DELETE("/mfa/totp", r.mfaController.Disable)
+				meGroup.POST("/mfa/recovery-codes", r.mfaController.RegenerateRecoveryCodes)
+				meGroup.GET("/api-keys", r.apiKeyController.ListKeys)
+				meGroup.POST("/api-keys", r.apiKeyController.CreateKey)
+				meGroup.DELETE("/api-keys/:id", r.apiKeyController.RevokeKey)
+			}
+
+			// 用量统计路由
+			authGroup.GET("/usage", auth(model.APIKeyScopeUsage), r.usageController.GetUsage)
+
+			// 提示词相关路由，修改全局提示词需通过管理员路由
+			promptGroup := authGroup.Group("/prompts", auth(model.APIKeyScopePrompts))
+			{
+				promptGroup.GET("", r.promptController.ListPrompts)
+				promptGroup.GET("/:id", r.promptController.GetPrompt)
+			}
+
+			// 用户自定义指令
+			authGroup.GET("/instructions", auth(model.APIKeyScopePrompts), r.promptController.GetInstruction)
+			authGroup.PUT("/instructions", auth(model.APIKeyScopePrompts), r.promptController.SetInstruction)
+
+			// 团队工作区，成员共享知识库和会话，只允许登录会话访问
+			workspaceGroup := authGroup.Group("/workspaces", auth())
+			{
+				workspaceGroup.GET("", r.workspaceController.List)
+				workspaceGroup.POST("", r.workspaceController.Create)
+				workspaceGroup.POST("/invitations/accept", r.workspaceController.AcceptInvitation)
+				workspaceGroup.GET("/:id", r.workspaceController.Get)
+				workspaceGroup.PATCH("/:id", r.workspaceController.Rename)
+				workspaceGroup.DELETE("/:id", r.workspaceController.Delete)
+				workspaceGroup.GET("/:id/members", r.workspaceController.ListMembers)
+				workspaceGroup.PUT("/:id/members/:user_id", r.workspaceController.UpdateMember)
+				workspaceGroup.DELETE("/:id/members/:user_id", r.workspaceController.RemoveMember)
+				workspaceGroup.GET("/:id/invitations", r.workspaceController.ListInvitations)
+				workspaceGroup.POST("/:id/invitations", r.workspaceController.Invite)
+				workspaceGroup.DELETE("/:id/invitations/:invitation_id", r.workspaceController.RevokeInvitation)
+				workspaceGroup.GET("/:id/documents", r.documentController.List)
+				workspaceGroup.POST("/:id/documents", r.documentController.Upload)
+				workspaceGroup.GET("/:id/documents/search", r.documentController.Search)
+				workspaceGroup.GET("/:id/documents/:document_id", r.documentController.Get)
+				workspaceGroup.DELETE("/:id/documents/:document_id", r.documentController.Delete)
+			}
+
+			// 管理员路由，按权限授权，只允许登录会话访问
+			adminGroup := authGroup.Group("/admin", auth())
+			{
+				adminGroup.GET("/users", can(model.PermissionUsersRead), r.adminController.ListUsers)
+				adminGroup.GET("/users/:id", can(model.PermissionUsersRead), r.adminController.GetUser)
+				adminGroup.PUT("/users/:id/role", can(model.PermissionUsersManage), r.adminController.SetRole)
+				adminGroup.POST("/users/:id/disable", can(model.PermissionUsersManage), r.adminController.DisableUser)
+				adminGroup.POST("/users/:id/enable", can(model.PermissionUsersManage), r.adminController.EnableUser)
+				adminGroup.GET("/users/:id/quota", can(model.PermissionQuotasManage), r.adminController.GetQuota)
+				adminGroup.PUT("/users/:id/quota", can(model.PermissionQuotasManage), r.adminController.SetQuota)
+				adminGroup.POST("/users/:id/quota/reset", can(model.PermissionQuotasManage), r.adminController.ResetQuota)
+				adminGroup.GET("/workspaces/:id/quota", can(model.PermissionQuotasManage), r.adminController.GetWorkspaceQuota)
+				adminGroup.PUT("/workspaces/:id/quota", can(model.PermissionQuotasManage), r.adminController.SetWorkspaceQuota)
+				adminGroup.GET("/usage", can(model.PermissionUsageRead), r.usageController.GetAllUsage)
+				adminGroup.GET("/roles", can(model.PermissionRolesManage), r.adminController.ListRoles)
+				adminGroup.POST("/roles", can(model.PermissionRolesManage), r.adminController.CreateRole)
+				adminGroup.PUT("/roles/:name", can(model.PermissionRolesManage), r.adminController.UpdateRole)
+				adminGroup.DELETE("/roles/:name", can(model.PermissionRolesManage), r.adminController.DeleteRole)
+				adminGroup.POST("/prompts", can(model.PermissionPromptsManage), r.promptController.CreatePrompt)
+				adminGroup.POST("/prompts/:id/versions", can(model.PermissionPromptsManage), r.promptController.AddVersion)
+				adminGroup.POST("/prompts/:id/rollback", can(model.PermissionPromptsManage), r.promptController.Rollback)
+				adminGroup.GET("/models", can(model.PermissionModelsManage), r.adminController.ListModels)
+				adminGroup.PUT("/models/*name", can(model.PermissionModelsManage), r.adminController.SetModel)
+				adminGroup.DELETE("/models/*name", can(model.PermissionModelsManage), r.adminController.DeleteModel)
+				adminGroup.GET("/feedback/export", can(model.PermissionFeedbackRead), r.feedbackController.ExportFeedback)
 			}
 		}
 	}
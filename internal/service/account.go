@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// accountDeletionGrace 申请删除账户后数据保留的时间
+const accountDeletionGrace = 30 * 24 * time.Hour
+
+var (
+	ErrUserNotFound   = errors.New("用户不存在")
+	ErrWrongPassword  = errors.New("密码错误")
+	ErrUsernameTaken  = errors.New("用户名已被使用")
+	ErrEmailTaken     = errors.New("邮箱已被使用")
+	ErrInvalidProfile = errors.New("无效的用户资料")
+)
+
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ProfileUpdate 用户资料的修改，为nil的字段保持不变
+type ProfileUpdate struct {
+	Username    *string
+	DisplayName *string
+	AvatarURL   *string
+	Locale      *string
+	Timezone    *string
+}
+
+func (s *userService) GetProfile(userID uint) (*model.User, error) {
+	var user model.User
+	if result := s.db.First(&user, userID); result.Error != nil {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *userService) UpdateProfile(userID uint, update ProfileUpdate) (*model.User, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Username != nil {
+		username := strings.TrimSpace(*update.Username)
+		if username == "" || utf8.RuneCountInString(username) > 50 {
+			return nil, fmt.Errorf("%w: 用户名长度应为1到50个字符", ErrInvalidProfile)
+		}
+		var count int64
+		s.db.Model(&model.User{}).Where("username = ? AND id <> ?", username, userID).Count(&count)
+		if count > 0 {
+			return nil, ErrUsernameTaken
+		}
+		updates["username"] = username
+	}
+	if update.DisplayName != nil {
+		displayName := strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(displayName) > 100 {
+			return nil, fmt.Errorf("%w: 显示名称不能超过100个字符", ErrInvalidProfile)
+		}
+		updates["display_name"] = displayName
+	}
+	if update.AvatarURL != nil {
+		avatar := strings.TrimSpace(*update.AvatarURL)
+		if avatar != "" {
+			parsed, err := url.Parse(avatar)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(avatar) > 500 {
+				return nil, fmt.Errorf("%w: 头像必须是http或https地址", ErrInvalidProfile)
+			}
+		}
+		updates["avatar_url"] = avatar
+	}
+	if update.Locale != nil {
+		if *update.Locale != "" && (!localePattern.MatchString(*update.Locale) || len(*update.Locale) > 20) {
+			return nil, fmt.Errorf("%w: 无效的语言", ErrInvalidProfile)
+		}
+		updates["locale"] = *update.Locale
+	}
+	if update.Timezone != nil {
+		if *update.Timezone != "" {
+			if _, err := time.LoadLocation(*update.Timezone); err != nil || len(*update.Timezone) > 50 {
+				return nil, fmt.Errorf("%w: 无效的时区", ErrInvalidProfile)
+			}
+		}
+		updates["timezone"] = *update.Timezone
+	}
+	if len(updates) == 0 {
+		return user, nil
+	}
+
+	updates["updated_at"] = time.Now()
+	if result := s.db.Model(user).Updates(updates); result.Error != nil {
+		return nil, result.Error
+	}
+	return s.GetProfile(userID)
+}
+
+func (s *userService) ChangePassword(userID uint, currentPassword, newPassword string) (*TokenPair, error) {
+	user, err := s.checkPassword(userID, currentPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	result := s.db.Model(user).Updates(map[string]interface{}{"password": string(hashedPassword), "updated_at": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// 其他设备需要使用新密码重新登录，当前设备换发新令牌
+	ctx := context.Background()
+	if err := s.tokens.RevokeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.tokens.Issue(ctx, user.ID, user.Username)
+}
+
+func (s *userService) RequestEmailChange(userID uint, newEmail, ip string) error {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return fmt.Errorf("%w: 新邮箱与当前邮箱相同", ErrInvalidProfile)
+	}
+	if err := s.checkEmailAvailable(userID, newEmail); err != nil {
+		return err
+	}
+	return s.verificationService.SendVerificationCode(newEmail, ip)
+}
+
+func (s *userService) ConfirmEmailChange(userID uint, newEmail, code, password string) (*model.User, error) {
+	// 验证码可通过公开接口获取，需再次校验密码，防止被盗的会话修改邮箱
+	user, err := s.checkPassword(userID, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkEmailAvailable(userID, newEmail); err != nil {
+		return nil, err
+	}
+	if err := s.verificationService.VerifyCode(newEmail, code); err != nil {
+		return nil, err
+	}
+
+	result := s.db.Model(user).Updates(map[string]interface{}{"email": newEmail, "updated_at": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return s.GetProfile(userID)
+}
+
+func (s *userService) ScheduleDeletion(userID uint, password string) (time.Time, error) {
+	user, err := s.checkPassword(userID, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	deleteAt := time.Now().Add(accountDeletionGrace)
+	if result := s.db.Model(user).Update("deletion_scheduled_at", deleteAt); result.Error != nil {
+		return time.Time{}, result.Error
+	}
+	// 退出全部设备，重新登录即撤销删除
+	if err := s.tokens.RevokeUser(context.Background(), userID); err != nil {
+		return time.Time{}, err
+	}
+	return deleteAt, nil
+}
+
+func (s *userService) PurgeDeletedAccounts() (int, error) {
+	var users []model.User
+	if result := s.db.Where("deletion_scheduled_at <= ?", time.Now()).Find(&users); result.Error != nil {
+		return 0, result.Error
+	}
+
+	for i, user := range users {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			// 工作区会话属于工作区，只删除个人会话中的消息
+			conversationIDs := tx.Model(&model.Conversation{}).Select("id").Where("user_id = ? AND workspace_id IS NULL", user.ID)
+			messageIDs := tx.Model(&model.ChatMessage{}).Select("id").Where("conversation_id IN (?)", conversationIDs)
+			steps := []struct {
+				model interface{}
+				query string
+				arg   interface{}
+			}{
+				{&model.TraceStep{}, "message_id IN (?)", messageIDs},
+				{&model.MessageFeedback{}, "user_id = ?", user.ID},
+				{&model.MessageFeedback{}, "message_id IN (?)", messageIDs},
+				{&model.ChatMessage{}, "conversation_id IN (?)", conversationIDs},
+				{&model.Conversation{}, "user_id = ? AND workspace_id IS NULL", user.ID},
+				{&model.Share{}, "user_id = ?", user.ID},
+				{&model.ImportJob{}, "user_id = ?", user.ID},
+				{&model.UsageRecord{}, "user_id = ?", user.ID},
+				{&model.UserQuota{}, "user_id = ?", user.ID},
+				{&model.UserInstruction{}, "user_id = ?", user.ID},
+				{&model.RecoveryCode{}, "user_id = ?", user.ID},
+				{&model.UserIdentity{}, "user_id = ?", user.ID},
+				{&model.APIKey{}, "user_id = ?", user.ID},
+				{&model.User{}, "id = ?", user.ID},
+			}
+			if err := leaveWorkspaces(tx, user.ID); err != nil {
+				return err
+			}
+			for _, step := range steps {
+				if err := tx.Where(step.query, step.arg).Delete(step.model).Error; err != nil {
+					return err
+				}
+			}
+			// 工作区会话中的消息保留给其他成员，不再关联已删除的用户
+			return tx.Model(&model.ChatMessage{}).Where("user_id = ?", user.ID).Update("user_id", 0).Error
+		})
+		if err != nil {
+			return i, fmt.Errorf("删除账户%d失败: %v", user.ID, err)
+		}
+	}
+	return len(users), nil
+}
+
+// checkPassword 校验用户当前密码
+func (s *userService) checkPassword(userID uint, password string) (*model.User, error) {
+	user, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return nil, ErrWrongPassword
+	}
+	return user, nil
+}
+
+func (s *userService) checkEmailAvailable(userID uint, email string) error {
+	var count int64
+	s.db.Model(&model.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count)
+	if count > 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
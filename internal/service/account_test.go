@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var verificationCodePattern = regexp.MustCompile(`class="code">(\d{6})<`)
+
+func setupAccountService(t *testing.T) (*userService, *gorm.DB, capturedEmail) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.User{}, &model.Conversation{}, &model.ChatMessage{}, &model.TraceStep{},
+		&model.MessageFeedback{}, &model.Share{}, &model.ImportJob{}, &model.UsageRecord{}, &model.UserQuota{}, &model.UserInstruction{}, &model.RecoveryCode{}, &model.UserIdentity{}, &model.APIKey{}, &model.Role{},
+		&model.Workspace{}, &model.WorkspaceMember{}, &model.WorkspaceInvitation{}, &model.WorkspaceQuota{}, &model.Document{}))
+
+	tm, err := template.NewTemplateManager()
+	assert.NoError(t, err)
+	jwt, _ := tools.NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", Expire: 1, AccessExpire: 15}})
+	emails := make(capturedEmail, 1)
+	redisClient := newMemoryRedis()
+	guard := NewAttemptGuard(redisClient)
+	verification := NewVerificationService(redisClient, emails, tm, guard)
+	users := NewUserService(db, NewTokenService(redisClient, jwt), verification, guard, NewMFAService(db, redisClient, guard)).(*userService)
+
+	assert.NoError(t, users.Register(&model.User{Username: "alice", Email: "alice@example.com", Password: "password1"}))
+	assert.NoError(t, users.Register(&model.User{Username: "bob", Email: "bob@example.com", Password: "password2"}))
+	return users, db, emails
+}
+
+func TestUpdateProfile(t *testing.T) {
+	users, _, _ := setupAccountService(t)
+	str := func(s string) *string { return &s }
+
+	user, err := users.UpdateProfile(1, ProfileUpdate{
+		DisplayName: str("Alice"),
+		AvatarURL:   str("https://example.com/a.png"),
+		Locale:      str("zh-CN"),
+		Timezone:    str("Asia/Shanghai"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "Alice", user.DisplayName)
+	assert.Equal(t, "Asia/Shanghai", user.Timezone)
+
+	_, err = users.UpdateProfile(1, ProfileUpdate{Username: str("bob")})
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+	_, err = users.UpdateProfile(1, ProfileUpdate{Timezone: str("Mars/Olympus")})
+	assert.ErrorIs(t, err, ErrInvalidProfile)
+	_, err = users.UpdateProfile(1, ProfileUpdate{AvatarURL: str("javascript:alert(1)")})
+	assert.ErrorIs(t, err, ErrInvalidProfile)
+	_, err = users.UpdateProfile(1, ProfileUpdate{Locale: str("not a locale")})
+	assert.ErrorIs(t, err, ErrInvalidProfile)
+
+	// 未提供的字段保持不变
+	user, err = users.UpdateProfile(1, ProfileUpdate{Username: str(" alice2 ")})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice2", user.Username)
+	assert.Equal(t, "zh-CN", user.Locale)
+}
+
+func TestChangePassword(t *testing.T) {
+	users, _, _ := setupAccountService(t)
+	ctx := context.Background()
+
+	old, err := users.Login("alice@example.com", "password1", "", "")
+	assert.NoError(t, err)
+
+	_, err = users.ChangePassword(1, "wrong", "new-password")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+
+	fresh, err := users.ChangePassword(1, "password1", "new-password")
+	assert.NoError(t, err)
+	_, err = users.tokens.Refresh(ctx, old.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = users.tokens.Refresh(ctx, fresh.RefreshToken)
+	assert.NoError(t, err)
+
+	_, err = users.Login("alice@example.com", "password1", "", "")
+	assert.Error(t, err)
+	_, err = users.Login("alice@example.com", "new-password", "", "")
+	assert.NoError(t, err)
+}
+
+func TestChangeEmail(t *testing.T) {
+	users, _, emails := setupAccountService(t)
+
+	assert.ErrorIs(t, users.RequestEmailChange(1, "bob@example.com", ""), ErrEmailTaken)
+	assert.NoError(t, users.RequestEmailChange(1, "alice@new.example.com", ""))
+	match := verificationCodePattern.FindStringSubmatch(<-emails)
+	assert.Len(t, match, 2)
+
+	_, err := users.ConfirmEmailChange(1, "alice@new.example.com", match[1], "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	_, err = users.ConfirmEmailChange(1, "alice@new.example.com", "000000x", "password1")
+	assert.ErrorIs(t, err, ErrVerificationCodeMismatch)
+
+	user, err := users.ConfirmEmailChange(1, "alice@new.example.com", match[1], "password1")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@new.example.com", user.Email)
+}
+
+func TestAccountDeletion(t *testing.T) {
+	users, db, _ := setupAccountService(t)
+
+	_, err := users.ScheduleDeletion(1, "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	deleteAt, err := users.ScheduleDeletion(1, "password1")
+	assert.NoError(t, err)
+	assert.True(t, deleteAt.After(time.Now().Add(29*24*time.Hour)))
+
+	// 宽限期内登录撤销删除
+	_, err = users.Login("alice@example.com", "password1", "", "")
+	assert.NoError(t, err)
+	user, _ := users.GetProfile(1)
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	conversation := &model.Conversation{UserID: 1, Title: "hello"}
+	assert.NoError(t, db.Create(conversation).Error)
+	message := &model.ChatMessage{UserID: 1, ConversationID: conversation.ID, Role: "user", Content: "hi"}
+	assert.NoError(t, db.Create(message).Error)
+	assert.NoError(t, db.Create(&model.TraceStep{MessageID: message.ID, Type: "tool_call"}).Error)
+	assert.NoError(t, db.Create(&model.ChatMessage{UserID: 2, Role: "user", Content: "keep"}).Error)
+
+	_, err = users.ScheduleDeletion(1, "password1")
+	assert.NoError(t, err)
+	purged, err := users.PurgeDeletedAccounts()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+
+	db.Model(&model.User{}).Where("id = ?", 1).Update("deletion_scheduled_at", time.Now().Add(-time.Minute))
+	purged, err = users.PurgeDeletedAccounts()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var count int64
+	db.Model(&model.User{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	db.Model(&model.ChatMessage{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	db.Model(&model.TraceStep{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+	db.Model(&model.Conversation{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
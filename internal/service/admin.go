@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAccountDisabled = errors.New("账户已被停用")
+	ErrModifySelf      = errors.New("不能修改自己的角色或停用自己的账户")
+	ErrExceedsActor    = errors.New("不能授予或管理超出自己权限的角色和用户")
+)
+
+// UserFilter 管理员查询用户的条件，为空的条件不参与过滤
+type UserFilter struct {
+	Search   string // 按用户名、邮箱或昵称模糊匹配
+	Role     string
+	Disabled *bool
+}
+
+type AdminService interface {
+	// ListUsers 按注册时间倒序分页查询用户
+	ListUsers(filter UserFilter, page pagination.Page) (*pagination.Result[model.User], error)
+	// GetUser 获取用户
+	GetUser(userID uint) (*model.User, error)
+	// SetRole 修改用户角色，管理员不能修改自己的角色。没有roles:manage权限时只能授予自己拥有的权限，
+	// 且不能修改拥有自己所没有权限的用户
+	SetRole(ctx context.Context, actorID, userID uint, role string) (*model.User, error)
+	// SetDisabled 停用或启用账户，停用时撤销该用户的全部登录会话，不能停用或启用拥有自己所没有权限的用户
+	SetDisabled(ctx context.Context, actorID, userID uint, disabled bool) (*model.User, error)
+	// GetWorkspace 获取工作区，管理员不需要是工作区成员
+	GetWorkspace(workspaceID uint) (*model.Workspace, error)
+}
+
+type adminService struct {
+	db     *gorm.DB
+	roles  RoleService
+	tokens TokenService
+}
+
+// NewAdminService 创建用户管理服务实例
+func NewAdminService(db *gorm.DB, roles RoleService, tokens TokenService) AdminService {
+	return &adminService{db: db, roles: roles, tokens: tokens}
+}
+
+func (s *adminService) ListUsers(filter UserFilter, page pagination.Page) (*pagination.Result[model.User], error) {
+	db := s.db.Model(&model.User{})
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		pattern := "%" + escapeLikeBang(search) + "%"
+		db = db.Where("users.username LIKE ? ESCAPE '!' OR users.email LIKE ? ESCAPE '!' OR users.display_name LIKE ? ESCAPE '!'",
+			pattern, pattern, pattern)
+	}
+	if filter.Role != "" {
+		db = db.Where("users.role = ?", filter.Role)
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			db = db.Where("users.disabled_at IS NOT NULL")
+		} else {
+			db = db.Where("users.disabled_at IS NULL")
+		}
+	}
+
+	var users []model.User
+	if err := page.Apply(db, "users").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return pagination.NewResult(users, page, func(user model.User) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+	}), nil
+}
+
+func (s *adminService) GetUser(userID uint) (*model.User, error) {
+	var user model.User
+	err := s.db.First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *adminService) SetRole(ctx context.Context, actorID, userID uint, role string) (*model.User, error) {
+	if actorID == userID {
+		return nil, ErrModifySelf
+	}
+	info, err := s.roles.GetRole(role)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := s.roles.Permissions(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTarget(actor, user); err != nil {
+		return nil, err
+	}
+	// 能管理角色的用户本就可以修改角色权限，其他用户只能授予自己拥有的权限
+	if !containsAll(actor, []string{model.PermissionRolesManage}) && !containsAll(actor, info.Permissions) {
+		return nil, ErrExceedsActor
+	}
+	if err := s.db.Model(user).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *adminService) SetDisabled(ctx context.Context, actorID, userID uint, disabled bool) (*model.User, error) {
+	if actorID == userID {
+		return nil, ErrModifySelf
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := s.roles.Permissions(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTarget(actor, user); err != nil {
+		return nil, err
+	}
+	if disabled == (user.DisabledAt != nil) {
+		return user, nil
+	}
+
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now()
+		disabledAt = &now
+	}
+	if err := s.db.Model(user).Update("disabled_at", disabledAt).Error; err != nil {
+		return nil, err
+	}
+	user.DisabledAt = disabledAt
+	// 停用后已签发的令牌立即失效，API密钥在校验时检查账户状态
+	if disabled {
+		if err := s.tokens.RevokeUser(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *adminService) GetWorkspace(workspaceID uint) (*model.Workspace, error) {
+	var workspace model.Workspace
+	err := s.db.First(&workspace, workspaceID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// checkTarget 操作者必须拥有目标用户角色的全部权限，避免降级或停用权限更高的用户。
+// 按角色而不是当前状态判断，已停用的管理员也不能被权限更低的用户重新启用
+func (s *adminService) checkTarget(actor []string, target *model.User) error {
+	permissions, err := s.roles.UserPermissions(target)
+	if err != nil {
+		return err
+	}
+	if !containsAll(actor, permissions) {
+		return ErrExceedsActor
+	}
+	return nil
+}
+
+// containsAll 判断granted是否包含required中的全部权限
+func containsAll(granted, required []string) bool {
+	set := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		set[permission] = true
+	}
+	for _, permission := range required {
+		if !set[permission] {
+			return false
+		}
+	}
+	return true
+}
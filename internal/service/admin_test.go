@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAdminService(t *testing.T) (AdminService, RoleService, *userService) {
+	users, db, _ := setupAccountService(t)
+	roles := NewRoleService(db, &config.Config{Admin: config.AdminConfig{Users: []string{"root"}}})
+	return NewAdminService(db, roles, users.tokens), roles, users
+}
+
+func TestRolePermissions(t *testing.T) {
+	_, roles, users := setupAdminService(t)
+	ctx := context.Background()
+
+	// 新用户默认为普通用户，没有管理权限
+	allowed, err := roles.HasPermission(ctx, 1, model.PermissionUsersRead)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	_, err = roles.CreateRole("support", "客服", []string{model.PermissionUsersRead, model.PermissionUsersRead})
+	assert.NoError(t, err)
+	_, err = roles.CreateRole("admin", "", nil)
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	_, err = roles.CreateRole("Support!", "", nil)
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	_, err = roles.CreateRole("auditor", "", []string{"users:delete"})
+	assert.ErrorIs(t, err, ErrInvalidRole)
+
+	assert.NoError(t, users.db.Model(&model.User{}).Where("id = ?", 1).Update("role", "support").Error)
+	permissions, err := roles.Permissions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{model.PermissionUsersRead}, permissions)
+
+	role, err := roles.UpdateRole("support", "客服", []string{model.PermissionUsageRead})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{model.PermissionUsageRead}, role.Permissions)
+	allowed, err = roles.HasPermission(ctx, 1, model.PermissionUsersRead)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	// 仍有用户使用的角色不能删除
+	assert.ErrorIs(t, roles.DeleteRole("support"), ErrRoleInUse)
+	assert.ErrorIs(t, roles.DeleteRole("user"), ErrInvalidRole)
+	list, err := roles.ListRoles()
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+
+	// 配置文件中的管理员拥有全部权限
+	assert.NoError(t, users.Register(&model.User{Username: "root", Email: "root@example.com", Password: "password3"}))
+	permissions, err = roles.Permissions(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Permissions, permissions)
+}
+
+func TestAdminManageUsers(t *testing.T) {
+	admin, roles, users := setupAdminService(t)
+	ctx := context.Background()
+	assert.NoError(t, users.db.Model(&model.User{}).Where("id = ?", 1).Update("role", model.RoleAdmin).Error)
+
+	result, err := admin.ListUsers(UserFilter{Search: "BOB@"}, pagination.Page{})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Items, 1) {
+		assert.Equal(t, "bob", result.Items[0].Username)
+	}
+	result, err = admin.ListUsers(UserFilter{Search: "%"}, pagination.Page{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Items)
+
+	// 不能修改自己，角色必须存在
+	_, err = admin.SetRole(ctx, 1, 1, model.RoleUser)
+	assert.ErrorIs(t, err, ErrModifySelf)
+	_, err = admin.SetRole(ctx, 1, 2, "ghost")
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+	user, err := admin.SetRole(ctx, 1, 2, model.RoleAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, user.Role)
+	allowed, err := roles.HasPermission(ctx, 2, model.PermissionModelsManage)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	// 停用后无法登录，已签发的令牌被撤销，也不再拥有管理权限
+	tokens, err := users.Login("bob@example.com", "password2", "", "")
+	assert.NoError(t, err)
+	user, err = admin.SetDisabled(ctx, 1, 2, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, user.DisabledAt)
+	_, err = users.Login("bob@example.com", "password2", "", "")
+	assert.ErrorIs(t, err, ErrAccountDisabled)
+	_, err = users.tokens.Refresh(ctx, tokens.RefreshToken)
+	assert.Error(t, err)
+	allowed, err = roles.HasPermission(ctx, 2, model.PermissionModelsManage)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	disabled := true
+	result, err = admin.ListUsers(UserFilter{Disabled: &disabled}, pagination.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 1)
+
+	_, err = admin.SetDisabled(ctx, 1, 2, false)
+	assert.NoError(t, err)
+	_, err = users.Login("bob@example.com", "password2", "", "")
+	assert.NoError(t, err)
+	_, err = admin.SetDisabled(ctx, 1, 99, true)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestAdminCannotEscalate(t *testing.T) {
+	admin, roles, users := setupAdminService(t)
+	ctx := context.Background()
+	assert.NoError(t, users.Register(&model.User{Username: "root", Email: "root@example.com", Password: "password3"}))
+	assert.NoError(t, users.Register(&model.User{Username: "carol", Email: "carol@example.com", Password: "password4"}))
+
+	// alice只能管理用户，bob是管理员
+	_, err := roles.CreateRole("operator", "", []string{model.PermissionUsersRead, model.PermissionUsersManage})
+	assert.NoError(t, err)
+	_, err = roles.CreateRole("auditor", "", []string{model.PermissionUsersRead})
+	assert.NoError(t, err)
+	assert.NoError(t, users.db.Model(&model.User{}).Where("id = ?", 1).Update("role", "operator").Error)
+	assert.NoError(t, users.db.Model(&model.User{}).Where("id = ?", 2).Update("role", model.RoleAdmin).Error)
+
+	// 不能授予自己没有的权限
+	_, err = admin.SetRole(ctx, 1, 4, model.RoleAdmin)
+	assert.ErrorIs(t, err, ErrExceedsActor)
+	user, err := admin.SetRole(ctx, 1, 4, "auditor")
+	assert.NoError(t, err)
+	assert.Equal(t, "auditor", user.Role)
+
+	// 不能降级或停用权限更高的用户，包括配置文件中的管理员
+	_, err = admin.SetRole(ctx, 1, 2, model.RoleUser)
+	assert.ErrorIs(t, err, ErrExceedsActor)
+	_, err = admin.SetDisabled(ctx, 1, 2, true)
+	assert.ErrorIs(t, err, ErrExceedsActor)
+	_, err = admin.SetDisabled(ctx, 1, 3, true)
+	assert.ErrorIs(t, err, ErrExceedsActor)
+	_, err = admin.SetDisabled(ctx, 1, 4, true)
+	assert.NoError(t, err)
+
+	// 已停用的管理员同样不能被重新启用
+	_, err = admin.SetDisabled(ctx, 3, 2, true)
+	assert.NoError(t, err)
+	_, err = admin.SetDisabled(ctx, 1, 2, false)
+	assert.ErrorIs(t, err, ErrExceedsActor)
+
+	// 拥有角色管理权限时可以授予任意角色
+	_, err = roles.UpdateRole("operator", "", []string{model.PermissionUsersRead, model.PermissionUsersManage, model.PermissionRolesManage})
+	assert.NoError(t, err)
+	user, err = admin.SetRole(ctx, 1, 4, model.RoleAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, user.Role)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyPrefix API密钥的固定开头，便于区分JWT和被密钥扫描工具识别
+	APIKeyPrefix = "dvl_"
+	// apiKeyLookupLength 前缀之后用于查找的明文长度
+	apiKeyLookupLength = 8
+	// apiKeyMaxPerUser 每个用户可同时持有的有效密钥数
+	apiKeyMaxPerUser = 20
+	// apiKeyTouchInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API密钥不存在")
+	ErrInvalidAPIKey  = errors.New("无效的API密钥参数")
+)
+
+// APIKeyOptions 创建API密钥的参数
+type APIKeyOptions struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time // 为空时永不过期
+}
+
+type APIKeyService interface {
+	// Create 创建API密钥，返回的明文密钥只在创建时出现一次
+	Create(userID uint, options APIKeyOptions) (*model.APIKey, string, error)
+	// List 分页列出用户未撤销的密钥
+	List(userID uint, page pagination.Page) (*pagination.Result[model.APIKey], error)
+	// Revoke 撤销用户的密钥，撤销后立即无法使用
+	Revoke(userID, keyID uint) error
+	// AuthenticateAPIKey 校验密钥，密钥无效、过期、已撤销或账户已停用时返回nil，查询失败时返回错误
+	AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, error)
+}
+
+type apiKeyService struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyService 创建API密钥服务实例
+func NewAPIKeyService(db *gorm.DB) APIKeyService {
+	return &apiKeyService{db: db}
+}
+
+func (s *apiKeyService) Create(userID uint, options APIKeyOptions) (*model.APIKey, string, error) {
+	name := strings.TrimSpace(options.Name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return nil, "", fmt.Errorf("%w: 名称长度应为1到100个字符", ErrInvalidAPIKey)
+	}
+	scopes, err := normalizeScopes(options.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if options.ExpiresAt != nil && !options.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("%w: 过期时间必须晚于当前时间", ErrInvalidAPIKey)
+	}
+
+	var count int64
+	s.db.Model(&model.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count)
+	if count >= apiKeyMaxPerUser {
+		return nil, "", fmt.Errorf("%w: 最多同时持有%d个密钥", ErrInvalidAPIKey, apiKeyMaxPerUser)
+	}
+
+	lookup := make([]byte, apiKeyLookupLength/2)
+	if _, err := rand.Read(lookup); err != nil {
+		return nil, "", fmt.Errorf("生成密钥失败: %v", err)
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("生成密钥失败: %v", err)
+	}
+	prefix := APIKeyPrefix + hex.EncodeToString(lookup)
+	plaintext := prefix + "_" + secret
+
+	key := &model.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: options.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+	return key, plaintext, nil
+}
+
+func (s *apiKeyService) List(userID uint, page pagination.Page) (*pagination.Result[model.APIKey], error) {
+	var keys []model.APIKey
+	query := s.db.Where("user_id = ? AND revoked_at IS NULL", userID)
+	if result := page.Apply(query, "api_keys").Find(&keys); result.Error != nil {
+		return nil, result.Error
+	}
+	return pagination.NewResult(keys, page, func(key model.APIKey) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: key.CreatedAt, ID: key.ID}
+	}), nil
+}
+
+func (s *apiKeyService) Revoke(userID, keyID uint) error {
+	result := s.db.Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *apiKeyService) AuthenticateAPIKey(ctx context.Context, key string) (*model.APIKey, error) {
+	prefixLength := len(APIKeyPrefix) + apiKeyLookupLength
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) <= prefixLength+1 || key[prefixLength] != '_' {
+		return nil, nil
+	}
+
+	var apiKey model.APIKey
+	err := s.db.WithContext(ctx).Preload("User").Where("prefix = ?", key[:prefixLength]).First(&apiKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(hashToken(key))) != 1 ||
+		apiKey.RevokedAt != nil ||
+		(apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now)) ||
+		apiKey.User.ID == 0 ||
+		apiKey.User.DeletionScheduledAt != nil ||
+		apiKey.User.DisabledAt != nil {
+		return nil, nil
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		s.db.WithContext(ctx).Model(&model.APIKey{}).Where("id = ?", apiKey.ID).Update("last_used_at", now)
+		apiKey.LastUsedAt = &now
+	}
+	return &apiKey, nil
+}
+
+// normalizeScopes 校验并去重授权范围
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: 至少需要一个授权范围", ErrInvalidAPIKey)
+	}
+	seen := make(map[string]bool, len(scopes))
+	var normalized []string
+	for _, scope := range scopes {
+		valid := false
+		for _, allowed := range model.APIKeyScopes {
+			if scope == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: 未知的授权范围%s", ErrInvalidAPIKey, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
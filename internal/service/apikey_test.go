@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	users, db, _ := setupAccountService(t)
+	keys := NewAPIKeyService(db)
+	ctx := context.Background()
+
+	_, _, err := keys.Create(1, APIKeyOptions{Name: "ci", Scopes: []string{"admin"}})
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, _, err = keys.Create(1, APIKeyOptions{Name: " "})
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	past := time.Now().Add(-time.Hour)
+	_, _, err = keys.Create(1, APIKeyOptions{Name: "ci", Scopes: []string{model.APIKeyScopeChat}, ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	key, plaintext, err := keys.Create(1, APIKeyOptions{Name: "ci", Scopes: []string{model.APIKeyScopeChat, model.APIKeyScopeChat}})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plaintext, key.Prefix+"_"))
+	assert.Equal(t, []string{model.APIKeyScopeChat}, key.Scopes)
+
+	// 只保存哈希
+	var stored model.APIKey
+	assert.NoError(t, db.First(&stored, key.ID).Error)
+	assert.Equal(t, hashToken(plaintext), stored.KeyHash)
+
+	authenticated, err := keys.AuthenticateAPIKey(ctx, plaintext)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", authenticated.User.Username)
+	assert.NotNil(t, authenticated.LastUsedAt)
+
+	// 前缀正确但密钥不同时拒绝
+	authenticated, err = keys.AuthenticateAPIKey(ctx, key.Prefix+"_forged")
+	assert.NoError(t, err)
+	assert.Nil(t, authenticated)
+
+	// 其他用户无法撤销
+	assert.ErrorIs(t, keys.Revoke(2, key.ID), ErrAPIKeyNotFound)
+	assert.NoError(t, keys.Revoke(1, key.ID))
+	authenticated, err = keys.AuthenticateAPIKey(ctx, plaintext)
+	assert.NoError(t, err)
+	assert.Nil(t, authenticated)
+	list, err := keys.List(1, pagination.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, list.Items)
+
+	// 账户申请删除后密钥失效
+	_, plaintext, err = keys.Create(1, APIKeyOptions{Name: "ci", Scopes: []string{model.APIKeyScopeUsage}})
+	assert.NoError(t, err)
+	_, err = users.ScheduleDeletion(1, "password1")
+	assert.NoError(t, err)
+	authenticated, err = keys.AuthenticateAPIKey(ctx, plaintext)
+	assert.NoError(t, err)
+	assert.Nil(t, authenticated)
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	_, db, _ := setupAccountService(t)
+	keys := NewAPIKeyService(db)
+
+	expiresAt := time.Now().Add(time.Hour)
+	key, plaintext, err := keys.Create(1, APIKeyOptions{Name: "temp", Scopes: []string{model.APIKeyScopeChat}, ExpiresAt: &expiresAt})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(key).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	authenticated, err := keys.AuthenticateAPIKey(context.Background(), plaintext)
+	assert.NoError(t, err)
+	assert.Nil(t, authenticated)
+}
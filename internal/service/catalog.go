@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidModel = errors.New("无效的模型参数")
+	ErrBuiltinModel = errors.New("配置文件中的模型不能删除，可以停用")
+)
+
+// ModelInfo 网关模型及其状态，Builtin为true表示来自配置文件
+type ModelInfo struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Builtin bool   `json:"builtin"`
+}
+
+type ModelCatalog interface {
+	// List 列出配置文件中的模型和管理员添加的模型，包括已停用的
+	List() ([]ModelInfo, error)
+	// Available 返回网关当前可用的模型
+	Available() ([]string, error)
+	// SetEnabled 添加模型或修改模型状态，模型由配置的LLM服务提供
+	SetEnabled(name string, enabled bool) (*ModelInfo, error)
+	// Delete 删除管理员添加的模型
+	Delete(name string) error
+}
+
+type modelCatalog struct {
+	db      *gorm.DB
+	builtin []string
+}
+
+// NewModelCatalog 创建网关模型目录实例
+func NewModelCatalog(db *gorm.DB, cfg *config.Config) ModelCatalog {
+	return &modelCatalog{db: db, builtin: builtinModels(cfg)}
+}
+
+// builtinModels 配置文件中的模型和Davlin智能体
+func builtinModels(cfg *config.Config) []string {
+	names := []string{GatewayAgentModel, cfg.LLM.Model}
+	if cfg.LLM.TitleModel != "" && cfg.LLM.TitleModel != cfg.LLM.Model {
+		names = append(names, cfg.LLM.TitleModel)
+	}
+	return names
+}
+
+func (c *modelCatalog) List() ([]ModelInfo, error) {
+	var records []model.GatewayModel
+	if err := c.db.Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(records))
+	for _, record := range records {
+		enabled[record.Name] = record.Enabled
+	}
+
+	models := make([]ModelInfo, 0, len(c.builtin)+len(records))
+	for _, name := range c.builtin {
+		on, ok := enabled[name]
+		models = append(models, ModelInfo{Name: name, Enabled: !ok || on, Builtin: true})
+	}
+	for _, record := range records {
+		if !c.isBuiltin(record.Name) {
+			models = append(models, ModelInfo{Name: record.Name, Enabled: record.Enabled})
+		}
+	}
+	return models, nil
+}
+
+func (c *modelCatalog) Available() ([]string, error) {
+	models, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		if m.Enabled {
+			names = append(names, m.Name)
+		}
+	}
+	return names, nil
+}
+
+func (c *modelCatalog) SetEnabled(name string, enabled bool) (*ModelInfo, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return nil, fmt.Errorf("%w: 模型名称长度应为1到100个字符", ErrInvalidModel)
+	}
+
+	var record model.GatewayModel
+	result := c.db.Where("name = ?", name).Limit(1).Find(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	now := time.Now()
+	if result.RowsAffected == 0 {
+		record = model.GatewayModel{Name: name, Enabled: enabled, CreatedAt: now, UpdatedAt: now}
+		if err := c.db.Create(&record).Error; err != nil {
+			return nil, err
+		}
+	} else if err := c.db.Model(&record).Updates(map[string]interface{}{"enabled": enabled, "updated_at": now}).Error; err != nil {
+		return nil, err
+	}
+	return &ModelInfo{Name: name, Enabled: enabled, Builtin: c.isBuiltin(name)}, nil
+}
+
+func (c *modelCatalog) Delete(name string) error {
+	if c.isBuiltin(name) {
+		return ErrBuiltinModel
+	}
+	result := c.db.Where("name = ?", name).Delete(&model.GatewayModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrModelNotFound
+	}
+	return nil
+}
+
+func (c *modelCatalog) isBuiltin(name string) bool {
+	for _, builtin := range c.builtin {
+		if builtin == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupModelCatalog(t *testing.T, cfg *config.Config) ModelCatalog {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.GatewayModel{}))
+	return NewModelCatalog(db, cfg)
+}
+
+func TestModelCatalog(t *testing.T) {
+	catalog := setupModelCatalog(t, &config.Config{LLM: config.LLMConfig{Model: "gpt-4o", TitleModel: "gpt-4o"}})
+
+	// 添加模型后可用，停用配置文件中的模型后不可用
+	_, err := catalog.SetEnabled("gpt-4.1", true)
+	assert.NoError(t, err)
+	info, err := catalog.SetEnabled("gpt-4o", false)
+	assert.NoError(t, err)
+	assert.True(t, info.Builtin)
+	assert.False(t, info.Enabled)
+
+	available, err := catalog.Available()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{GatewayAgentModel, "gpt-4.1"}, available)
+	models, err := catalog.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []ModelInfo{
+		{Name: GatewayAgentModel, Enabled: true, Builtin: true},
+		{Name: "gpt-4o", Enabled: false, Builtin: true},
+		{Name: "gpt-4.1", Enabled: true},
+	}, models)
+
+	gateway := NewGatewayService(nil, nil, nil, nil, catalog)
+	_, _, err = gateway.Complete(context.Background(), CompletionRequest{UserID: 1, Model: "gpt-4o", Messages: []*schema.Message{schema.UserMessage("hi")}})
+	assert.ErrorIs(t, err, ErrModelNotFound)
+
+	// 配置文件中的模型只能停用，管理员添加的模型可以删除
+	assert.ErrorIs(t, catalog.Delete("gpt-4o"), ErrBuiltinModel)
+	assert.NoError(t, catalog.Delete("gpt-4.1"))
+	assert.ErrorIs(t, catalog.Delete("gpt-4.1"), ErrModelNotFound)
+	_, err = catalog.SetEnabled(" ", true)
+	assert.ErrorIs(t, err, ErrInvalidModel)
+}
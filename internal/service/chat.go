@@ -1,52 +1,654 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"io"
+	"log"
+	"strings"
 
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/compose"
+	einoagent "github.com/cloudwego/eino/flow/agent"
+	"github.com/cloudwego/eino/schema"
 	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/davlin-coder/davlin/internal/resource/agent"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
 	"gorm.io/gorm"
 )
 
+// historyLimit 调用模型时携带的最大历史消息数
+const historyLimit = 20
+
+var (
+	ErrConversationNotFound = errors.New("会话不存在")
+	ErrMessageNotFound      = errors.New("消息不存在")
+)
+
+// SendOptions 发送消息的可选参数
+type SendOptions struct {
+	PromptID    uint            // 切换会话使用的系统提示词
+	WorkspaceID uint            // 新会话所属的工作区，仅在未指定会话时生效
+	Locale      string          // 客户端语言区域
+	OnEvent     func(ChatEvent) // 接收生成过程中的事件，为空时不推送
+}
+
+// ChatEvent 生成过程中推送给客户端的事件
+type ChatEvent struct {
+	Type string      `json:"type"` // start: 开始生成，delta: 回复片段，tool_start/tool_end: 工具调用，title: 自动生成的会话标题
+	Data interface{} `json:"data"`
+}
+
+func (o SendOptions) emit(event ChatEvent) {
+	if o.OnEvent != nil {
+		o.OnEvent(event)
+	}
+}
+
+// BranchMessage 当前分支上的消息及其兄弟节点信息
+type BranchMessage struct {
+	model.ChatMessage
+	SiblingIDs   []uint `json:"sibling_ids"`   // 同一父消息下的全部消息ID，按创建顺序
+	SiblingIndex int    `json:"sibling_index"` // 当前消息在兄弟节点中的位置
+	SiblingCount int    `json:"sibling_count"`
+}
+
 type ChatService interface {
-	SendMessage(message *model.ChatMessage) (map[string]interface{}, error)
-	GetHistory(userID uint) ([]model.ChatMessage, error)
+	SendMessage(ctx context.Context, message *model.ChatMessage, opts SendOptions) (map[string]interface{}, error)
+	// Regenerate 为指定的助手消息重新生成回复，新回复作为其兄弟节点
+	Regenerate(ctx context.Context, userID, messageID uint, opts SendOptions) (map[string]interface{}, error)
+	// EditMessage 以修改后的内容从指定用户消息处分叉出新分支
+	EditMessage(ctx context.Context, userID, messageID uint, content string, opts SendOptions) (map[string]interface{}, error)
+	// GetHistory 分页返回用户的消息，includeTrace为true时附带助手回复的执行步骤
+	GetHistory(userID uint, includeTrace bool, page pagination.Page) (*pagination.Result[model.ChatMessage], error)
+	// ListConversations 分页返回会话，workspaceID为0时返回用户的个人会话，否则返回工作区的全部会话
+	ListConversations(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.Conversation], error)
+	// GetConversationMessages 返回会话当前分支上的消息
+	GetConversationMessages(userID, conversationID uint, includeTrace bool) ([]BranchMessage, error)
+	// SwitchBranch 切换到包含指定消息的分支，分支末端取每层最新的消息
+	SwitchBranch(userID, conversationID, messageID uint) error
+	// CancelGeneration 取消会话正在进行的生成，已生成的部分会被保存
+	CancelGeneration(ctx context.Context, userID, conversationID uint) error
+	// RenameConversation 修改会话标题
+	RenameConversation(userID, conversationID uint, title string) error
 }
 
 type chatService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	agent       agent.Agent
+	usage       UsageService
+	quota       QuotaService
+	prompt      PromptService
+	generations GenerationRegistry
+	titles      TitleService
+	workspaces  WorkspaceService
 }
 
-func NewChatService(db *gorm.DB) ChatService {
-	return &chatService{db: db}
+func NewChatService(db *gorm.DB, agent agent.Agent, usage UsageService, quota QuotaService, prompt PromptService, generations GenerationRegistry, titles TitleService, workspaces WorkspaceService) ChatService {
+	return &chatService{db: db, agent: agent, usage: usage, quota: quota, prompt: prompt, generations: generations, titles: titles, workspaces: workspaces}
 }
 
-func (s *chatService) SendMessage(message *model.ChatMessage) (map[string]interface{}, error) {
+func (s *chatService) SendMessage(ctx context.Context, message *model.ChatMessage, opts SendOptions) (map[string]interface{}, error) {
 	if s.db == nil {
 		return nil, errors.New("database connection is not initialized")
 	}
 
+	conversation, err := s.prepareConversation(message, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 调用模型前检查配额
+	release, err := s.acquire(ctx, message.UserID, conversation.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if conversation.ID == 0 {
+		if result := s.db.Create(conversation); result.Error != nil {
+			return nil, result.Error
+		}
+	}
+	if err := s.applyPrompt(conversation, opts); err != nil {
+		return nil, err
+	}
+	// 先登记生成再保存消息，会话已有生成时不留下没有回复的消息
+	ctx, done, err := s.startGeneration(ctx, message.UserID, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	message.ConversationID = conversation.ID
+	message.Role = string(schema.User)
+	message.Status = model.MessageStatusCompleted
+	// 新消息接在当前分支末端，复制ID避免与会话字段共用指针
+	if conversation.CurrentMessageID != nil {
+		parentID := *conversation.CurrentMessageID
+		message.ParentID = &parentID
+	}
+
 	// 保存消息到数据库
 	result := s.db.Create(message)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return map[string]interface{}{
-		"status":     "success",
-		"message_id": message.ID,
-	}, nil
+	return s.reply(ctx, conversation, message, opts)
 }
 
-func (s *chatService) GetHistory(userID uint) ([]model.ChatMessage, error) {
+func (s *chatService) Regenerate(ctx context.Context, userID, messageID uint, opts SendOptions) (map[string]interface{}, error) {
+	var target model.ChatMessage
+	result := s.db.Where("id = ? AND user_id = ? AND role = ?", messageID, userID, string(schema.Assistant)).First(&target)
+	if result.Error != nil || target.ParentID == nil {
+		return nil, ErrMessageNotFound
+	}
+	var question model.ChatMessage
+	if result := s.db.First(&question, *target.ParentID); result.Error != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	conversation, err := s.editableConversation(userID, target.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	release, err := s.acquire(ctx, userID, conversation.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := s.applyPrompt(conversation, opts); err != nil {
+		return nil, err
+	}
+	ctx, done, err := s.startGeneration(ctx, userID, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return s.reply(ctx, conversation, &question, opts)
+}
+
+func (s *chatService) EditMessage(ctx context.Context, userID, messageID uint, content string, opts SendOptions) (map[string]interface{}, error) {
+	var original model.ChatMessage
+	result := s.db.Where("id = ? AND user_id = ? AND role = ?", messageID, userID, string(schema.User)).First(&original)
+	if result.Error != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	conversation, err := s.editableConversation(userID, original.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	release, err := s.acquire(ctx, userID, conversation.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := s.applyPrompt(conversation, opts); err != nil {
+		return nil, err
+	}
+	ctx, done, err := s.startGeneration(ctx, userID, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	// 新消息与原消息共享父节点，形成新的分支
+	message := &model.ChatMessage{
+		UserID:         userID,
+		ConversationID: conversation.ID,
+		ParentID:       original.ParentID,
+		Content:        content,
+		Role:           string(schema.User),
+		Status:         model.MessageStatusCompleted,
+	}
+	if result := s.db.Create(message); result.Error != nil {
+		return nil, result.Error
+	}
+	return s.reply(ctx, conversation, message, opts)
+}
+
+// reply 以question所在分支为上下文调用模型，保存回复并将其设为会话当前分支的末端，
+// 调用方须先通过startGeneration登记生成并传入返回的上下文
+func (s *chatService) reply(ctx context.Context, conversation *model.Conversation, question *model.ChatMessage, opts SendOptions) (map[string]interface{}, error) {
+	input, err := s.buildInput(conversation.ID, question.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var promptVersionID uint
+	if s.prompt != nil {
+		var user model.User
+		s.db.Select("username").Where("id = ?", question.UserID).Limit(1).Find(&user)
+		vars := PromptVars{UserName: user.Username, Locale: opts.Locale}
+		if conversation.WorkspaceID != nil {
+			s.db.Model(&model.Document{}).Where("workspace_id = ?", *conversation.WorkspaceID).
+				Order("updated_at DESC").Limit(promptDocumentsLimit).Pluck("name", &vars.Documents)
+		}
+		systemPrompt, versionID, err := s.prompt.BuildSystemPrompt(question.UserID, conversation.PromptID, vars)
+		if err != nil {
+			return nil, err
+		}
+		ctx = agent.WithSystemPrompt(ctx, systemPrompt)
+		promptVersionID = versionID
+	}
+	// 工作区会话中智能体可以检索工作区的知识库
+	if conversation.WorkspaceID != nil {
+		ctx = tools.WithWorkspace(ctx, *conversation.WorkspaceID)
+	}
+
+	trace := newTraceRecorder()
+	trace.onEvent = opts.emit
+	handlers := []callbacks.Handler{trace.Handler()}
+	if s.usage != nil {
+		handlers = append(handlers, s.usage.CallbackHandler(question.UserID, conversation.ID))
+	}
+	agentOpts := []einoagent.AgentOption{einoagent.WithComposeOptions(compose.WithCallbacks(handlers...))}
+
+	opts.emit(ChatEvent{Type: "start", Data: map[string]interface{}{
+		"conversation_id": conversation.ID,
+		"message_id":      question.ID,
+	}})
+
+	// 被取消时保存已生成的部分，其他错误直接返回
+	status := model.MessageStatusCompleted
+	content, err := s.generate(ctx, input, opts, agentOpts)
+	if err != nil {
+		if ctx.Err() == nil {
+			return nil, err
+		}
+		status = model.MessageStatusCancelled
+	}
+
+	reply := &model.ChatMessage{
+		UserID:          question.UserID,
+		ConversationID:  conversation.ID,
+		ParentID:        &question.ID,
+		Content:         content,
+		Role:            string(schema.Assistant),
+		PromptVersionID: promptVersionID,
+		Model:           trace.Model(),
+		Status:          status,
+		Trace:           trace.Steps(),
+	}
+	if result := s.db.Create(reply); result.Error != nil {
+		return nil, result.Error
+	}
+	if result := s.db.Model(conversation).Update("current_message_id", reply.ID); result.Error != nil {
+		return nil, result.Error
+	}
+
+	responseStatus := "success"
+	if status == model.MessageStatusCancelled {
+		responseStatus = status
+	}
+	response := map[string]interface{}{
+		"status":          responseStatus,
+		"conversation_id": conversation.ID,
+		"message_id":      question.ID,
+		"reply":           reply,
+	}
+	// 首轮问答完成后异步生成标题，不阻塞回复
+	if s.titles != nil && conversation.Title == "" && question.ParentID == nil && status == model.MessageStatusCompleted {
+		response["title_pending"] = true
+		go s.generateTitle(question, reply, opts)
+	}
+	return response, nil
+}
+
+// generateTitle 生成会话标题并通过事件推送给客户端
+func (s *chatService) generateTitle(question, reply *model.ChatMessage, opts SendOptions) {
+	title, err := s.titles.Generate(context.Background(), question.UserID, question.ConversationID, question.Content, reply.Content)
+	if err != nil {
+		log.Printf("生成会话标题失败: %v", err)
+		opts.emit(ChatEvent{Type: "title", Data: map[string]interface{}{"conversation_id": question.ConversationID}})
+		return
+	}
+	opts.emit(ChatEvent{Type: "title", Data: map[string]interface{}{
+		"conversation_id": question.ConversationID,
+		"title":           title,
+	}})
+}
+
+// generate 以流式调用智能体并逐段推送回复，出错时返回已生成的部分
+func (s *chatService) generate(ctx context.Context, input []*schema.Message, opts SendOptions, agentOpts []einoagent.AgentOption) (string, error) {
+	stream, err := s.agent.Stream(ctx, input, agentOpts...)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	for {
+		if ctx.Err() != nil {
+			return content.String(), context.Cause(ctx)
+		}
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return content.String(), nil
+		}
+		if err != nil {
+			return content.String(), err
+		}
+		if chunk.Content == "" {
+			continue
+		}
+		content.WriteString(chunk.Content)
+		opts.emit(ChatEvent{Type: "delta", Data: chunk.Content})
+	}
+}
+
+// startGeneration 登记会话的生成，未配置登记表时仅创建可取消的上下文
+func (s *chatService) startGeneration(ctx context.Context, userID, conversationID uint) (context.Context, func(), error) {
+	if s.generations == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	return s.generations.Start(ctx, userID, conversationID)
+}
+
+func (s *chatService) CancelGeneration(ctx context.Context, userID, conversationID uint) error {
+	if _, err := s.getConversation(userID, conversationID); err != nil {
+		return err
+	}
+	if s.generations == nil {
+		return ErrNoActiveGeneration
+	}
+	return s.generations.Cancel(ctx, userID, conversationID)
+}
+
+func (s *chatService) RenameConversation(userID, conversationID uint, title string) error {
+	if s.titles == nil {
+		return errors.New("标题服务未初始化")
+	}
+	return s.titles.Rename(userID, conversationID, title)
+}
+
+// acquire 检查并占用用户配额，工作区会话还需占用工作区配额，未配置配额服务时直接放行
+func (s *chatService) acquire(ctx context.Context, userID uint, workspaceID *uint) (func(), error) {
+	if s.quota == nil {
+		return func() {}, nil
+	}
+	if workspaceID != nil {
+		return s.quota.Acquire(ctx, userID, *workspaceID)
+	}
+	return s.quota.Acquire(ctx, userID, 0)
+}
+
+// applyPrompt 按请求切换会话使用的系统提示词
+func (s *chatService) applyPrompt(conversation *model.Conversation, opts SendOptions) error {
+	if opts.PromptID == 0 {
+		return nil
+	}
+	var count int64
+	s.db.Model(&model.Prompt{}).Where("id = ?", opts.PromptID).Count(&count)
+	if count == 0 {
+		return errors.New("提示词不存在")
+	}
+	conversation.PromptID = &opts.PromptID
+	return s.db.Model(conversation).Update("prompt_id", opts.PromptID).Error
+}
+
+// prepareConversation 返回消息所属会话，未指定会话时返回尚未保存的新会话
+func (s *chatService) prepareConversation(message *model.ChatMessage, opts SendOptions) (*model.Conversation, error) {
+	if message.ConversationID != 0 {
+		return s.editableConversation(message.UserID, message.ConversationID)
+	}
+
+	conversation := &model.Conversation{UserID: message.UserID}
+	if opts.WorkspaceID != 0 {
+		if err := s.requireWorkspaceEditor(message.UserID, opts.WorkspaceID); err != nil {
+			return nil, err
+		}
+		workspaceID := opts.WorkspaceID
+		conversation.WorkspaceID = &workspaceID
+	}
+	return conversation, nil
+}
+
+// getConversation 返回用户可以查看的会话：自己的个人会话或所在工作区的会话
+func (s *chatService) getConversation(userID, conversationID uint) (*model.Conversation, error) {
+	var conversation model.Conversation
+	result := s.db.Where("id = ?", conversationID).First(&conversation)
+	if result.Error != nil {
+		return nil, ErrConversationNotFound
+	}
+	if conversation.WorkspaceID == nil {
+		if conversation.UserID != userID {
+			return nil, ErrConversationNotFound
+		}
+		return &conversation, nil
+	}
+	if s.workspaces == nil {
+		return nil, ErrConversationNotFound
+	}
+	if _, err := s.workspaces.MemberRole(userID, *conversation.WorkspaceID); err != nil {
+		return nil, ErrConversationNotFound
+	}
+	return &conversation, nil
+}
+
+// editableConversation 返回用户可以发送消息的会话，工作区会话要求编辑者及以上角色
+func (s *chatService) editableConversation(userID, conversationID uint) (*model.Conversation, error) {
+	conversation, err := s.getConversation(userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.WorkspaceID != nil {
+		if err := s.requireWorkspaceEditor(userID, *conversation.WorkspaceID); err != nil {
+			return nil, err
+		}
+	}
+	return conversation, nil
+}
+
+// requireWorkspaceEditor 要求用户是工作区的编辑者或所有者
+func (s *chatService) requireWorkspaceEditor(userID, workspaceID uint) error {
+	if s.workspaces == nil {
+		return ErrWorkspaceNotFound
+	}
+	role, err := s.workspaces.MemberRole(userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if !hasWorkspaceRole(role, model.WorkspaceRoleEditor) {
+		return ErrWorkspaceForbidden
+	}
+	return nil
+}
+
+// loadTree 加载会话的全部消息，返回按ID索引的消息和按父消息ID索引的子消息，根消息的父ID记为0
+func (s *chatService) loadTree(conversationID uint) (map[uint]*model.ChatMessage, map[uint][]uint, error) {
+	var messages []*model.ChatMessage
+	result := s.db.Where("conversation_id = ?", conversationID).Order("id asc").Find(&messages)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	nodes := make(map[uint]*model.ChatMessage, len(messages))
+	children := make(map[uint][]uint)
+	for _, message := range messages {
+		nodes[message.ID] = message
+		var parentID uint
+		if message.ParentID != nil {
+			parentID = *message.ParentID
+		}
+		children[parentID] = append(children[parentID], message.ID)
+	}
+	return nodes, children, nil
+}
+
+// branch 返回从根消息到leafID的路径
+func branch(nodes map[uint]*model.ChatMessage, leafID uint) []*model.ChatMessage {
+	var path []*model.ChatMessage
+	for node, ok := nodes[leafID]; ok; {
+		path = append(path, node)
+		if node.ParentID == nil {
+			break
+		}
+		node, ok = nodes[*node.ParentID]
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// buildInput 将leafID所在分支最近的历史消息转换为模型输入
+func (s *chatService) buildInput(conversationID, leafID uint) ([]*schema.Message, error) {
+	nodes, _, err := s.loadTree(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	path := branch(nodes, leafID)
+	if len(path) > historyLimit {
+		path = path[len(path)-historyLimit:]
+	}
+	input := make([]*schema.Message, 0, len(path))
+	for _, message := range path {
+		input = append(input, &schema.Message{
+			Role:    schema.RoleType(message.Role),
+			Content: message.Content,
+		})
+	}
+	return input, nil
+}
+
+func (s *chatService) GetHistory(userID uint, includeTrace bool, page pagination.Page) (*pagination.Result[model.ChatMessage], error) {
 	if s.db == nil {
 		return nil, errors.New("database connection is not initialized")
 	}
 
+	query := s.db.Where("user_id = ?", userID)
+	if includeTrace {
+		query = query.Preload("Trace", orderTrace)
+	}
 	var messages []model.ChatMessage
-	result := s.db.Where("user_id = ?", userID).Order("created_at desc").Find(&messages)
+	result := page.Apply(query, "chat_messages").Find(&messages)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
+	return pagination.NewResult(messages, page, func(message model.ChatMessage) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: message.CreatedAt, ID: message.ID}
+	}), nil
+}
+
+func (s *chatService) ListConversations(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.Conversation], error) {
+	query := s.db.Where("user_id = ? AND workspace_id IS NULL", userID)
+	if workspaceID != 0 {
+		if s.workspaces == nil {
+			return nil, ErrWorkspaceNotFound
+		}
+		if _, err := s.workspaces.MemberRole(userID, workspaceID); err != nil {
+			return nil, err
+		}
+		query = s.db.Where("workspace_id = ?", workspaceID)
+	}
+
+	var conversations []model.Conversation
+	result := page.Apply(query, "conversations").Find(&conversations)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return pagination.NewResult(conversations, page, func(conversation model.Conversation) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: conversation.CreatedAt, ID: conversation.ID}
+	}), nil
+}
+
+func (s *chatService) GetConversationMessages(userID, conversationID uint, includeTrace bool) ([]BranchMessage, error) {
+	conversation, err := s.getConversation(userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.CurrentMessageID == nil {
+		return []BranchMessage{}, nil
+	}
+
+	nodes, children, err := s.loadTree(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	path := branch(nodes, *conversation.CurrentMessageID)
+	if includeTrace {
+		if err := s.attachTrace(path); err != nil {
+			return nil, err
+		}
+	}
+	messages := make([]BranchMessage, 0, len(path))
+	for _, message := range path {
+		var parentID uint
+		if message.ParentID != nil {
+			parentID = *message.ParentID
+		}
+		siblings := children[parentID]
+		index := 0
+		for i, id := range siblings {
+			if id == message.ID {
+				index = i
+			}
+		}
+		messages = append(messages, BranchMessage{
+			ChatMessage:  *message,
+			SiblingIDs:   siblings,
+			SiblingIndex: index,
+			SiblingCount: len(siblings),
+		})
+	}
 	return messages, nil
-}
\ No newline at end of file
+}
+
+// attachTrace 为消息加载执行步骤
+func (s *chatService) attachTrace(messages []*model.ChatMessage) error {
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	var steps []model.TraceStep
+	if result := orderTrace(s.db.Where("message_id IN ?", ids)).Find(&steps); result.Error != nil {
+		return result.Error
+	}
+
+	byMessage := make(map[uint][]model.TraceStep)
+	for _, step := range steps {
+		byMessage[step.MessageID] = append(byMessage[step.MessageID], step)
+	}
+	for _, message := range messages {
+		message.Trace = byMessage[message.ID]
+	}
+	return nil
+}
+
+// orderTrace 按执行顺序排列步骤
+func orderTrace(db *gorm.DB) *gorm.DB {
+	return db.Order("seq asc")
+}
+
+func (s *chatService) SwitchBranch(userID, conversationID, messageID uint) error {
+	conversation, err := s.editableConversation(userID, conversationID)
+	if err != nil {
+		return err
+	}
+
+	nodes, children, err := s.loadTree(conversationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := nodes[messageID]; !ok {
+		return ErrMessageNotFound
+	}
+
+	// 沿最新的子消息向下找到分支末端
+	leafID := messageID
+	for len(children[leafID]) > 0 {
+		next := children[leafID]
+		leafID = next[len(next)-1]
+	}
+	return s.db.Model(conversation).Update("current_message_id", leafID).Error
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 
+	einoagent "github.com/cloudwego/eino/flow/agent"
+	"github.com/cloudwego/eino/schema"
 	"github.com/davlin-coder/davlin/internal/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -22,16 +24,39 @@ func (m *MockLLMClient) Chat(ctx context.Context, messages []*model.ChatMessage)
 	return args.String(0), args.Error(1)
 }
 
+// MockAgent 模拟对话智能体
+type MockAgent struct {
+	mock.Mock
+}
+
+func (m *MockAgent) Generate(ctx context.Context, input []*schema.Message, opts ...einoagent.AgentOption) (*schema.Message, error) {
+	args := m.Called(ctx, input)
+	msg, _ := args.Get(0).(*schema.Message)
+	return msg, args.Error(1)
+}
+
+func (m *MockAgent) Stream(ctx context.Context, input []*schema.Message, opts ...einoagent.AgentOption) (*schema.StreamReader[*schema.Message], error) {
+	args := m.Called(ctx, input)
+	// 返回单条消息时包装为流，每次调用都得到新的流
+	if msg, ok := args.Get(0).(*schema.Message); ok {
+		return schema.StreamReaderFromArray([]*schema.Message{msg}), args.Error(1)
+	}
+	sr, _ := args.Get(0).(*schema.StreamReader[*schema.Message])
+	return sr, args.Error(1)
+}
+
 func TestChatService(t *testing.T) {
 	// 创建聊天服务实例
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 
 	// 自动迁移数据库表结构
-	err = db.AutoMigrate(&model.ChatMessage{})
+	err = db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{})
 	assert.NoError(t, err)
 
-	chatService := NewChatService(db)
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(schema.AssistantMessage("Hi", nil), nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, nil, nil)
 
 	// 测试发送消息
 	message := &model.ChatMessage{
@@ -40,12 +65,18 @@ func TestChatService(t *testing.T) {
 	}
 
 	// 执行测试
-	response, err := chatService.SendMessage(message)
+	response, err := chatService.SendMessage(context.Background(), message, SendOptions{})
 
 	// 验证结果
 	assert.NoError(t, err)
 	assert.NotNil(t, response)
 	assert.IsType(t, map[string]interface{}{}, response)
+	assert.NotZero(t, response["conversation_id"])
+
+	// 验证回复已保存
+	var count int64
+	db.Model(&model.ChatMessage{}).Where("role = ?", "assistant").Count(&count)
+	assert.Equal(t, int64(1), count)
 }
 
 func TestChatServiceError(t *testing.T) {
@@ -53,7 +84,7 @@ func TestChatServiceError(t *testing.T) {
 	_, err := gorm.Open(sqlite.Open("/invalid/path"), &gorm.Config{})
 	if err != nil {
 		// 如果数据库连接失败，创建一个新的服务实例
-		chatService := NewChatService(nil)
+		chatService := NewChatService(nil, nil, nil, nil, nil, nil, nil, nil)
 
 		// 测试发送消息
 		message := &model.ChatMessage{
@@ -62,7 +93,7 @@ func TestChatServiceError(t *testing.T) {
 		}
 
 		// 执行测试
-		response, err := chatService.SendMessage(message)
+		response, err := chatService.SendMessage(context.Background(), message, SendOptions{})
 
 		// 验证错误处理
 		assert.Error(t, err)
@@ -74,3 +105,56 @@ func TestChatServiceError(t *testing.T) {
 	// 如果数据库连接成功（不应该发生），标记测试失败
 	t.Error("Expected database connection to fail")
 }
+
+func TestChatBranching(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}))
+
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(schema.AssistantMessage("answer", nil), nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, nil, nil)
+	ctx := context.Background()
+
+	first := &model.ChatMessage{UserID: 1, Content: "q1"}
+	response, err := chatService.SendMessage(ctx, first, SendOptions{})
+	assert.NoError(t, err)
+	conversationID := response["conversation_id"].(uint)
+	firstReply := response["reply"].(*model.ChatMessage)
+
+	second := &model.ChatMessage{UserID: 1, ConversationID: conversationID, Content: "q2"}
+	response, err = chatService.SendMessage(ctx, second, SendOptions{})
+	assert.NoError(t, err)
+	secondReply := response["reply"].(*model.ChatMessage)
+	assert.Equal(t, firstReply.ID, *second.ParentID)
+
+	// 重新生成第二个回复
+	_, err = chatService.Regenerate(ctx, 1, secondReply.ID, SendOptions{})
+	assert.NoError(t, err)
+	messages, err := chatService.GetConversationMessages(1, conversationID, false)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 4)
+	assert.Equal(t, 2, messages[3].SiblingCount)
+	assert.Equal(t, 1, messages[3].SiblingIndex)
+
+	// 修改第一个问题后，新分支只包含修改后的问题和回复
+	_, err = chatService.EditMessage(ctx, 1, first.ID, "q1 edited", SendOptions{})
+	assert.NoError(t, err)
+	messages, err = chatService.GetConversationMessages(1, conversationID, false)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "q1 edited", messages[0].Content)
+	assert.Equal(t, 2, messages[0].SiblingCount)
+
+	// 切换回原分支，末端为最新的重新生成回复
+	assert.NoError(t, chatService.SwitchBranch(1, conversationID, first.ID))
+	messages, err = chatService.GetConversationMessages(1, conversationID, false)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 4)
+	assert.Equal(t, "q1", messages[0].Content)
+	assert.Equal(t, 0, messages[0].SiblingIndex)
+
+	// 其他用户无法访问
+	_, err = chatService.GetConversationMessages(2, conversationID, false)
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+}
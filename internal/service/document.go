@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"gorm.io/gorm"
+)
+
+const (
+	// documentMaxSize 单个文档内容的最大字节数
+	documentMaxSize = 1 << 20
+	// documentSearchKeywords 检索时最多使用的关键词数
+	documentSearchKeywords = 5
+	// documentSearchCandidates 参与评分的最大文档数
+	documentSearchCandidates = 50
+	// documentSnippetRadius 片段中命中位置前后保留的字符数
+	documentSnippetRadius = 200
+	// documentSearchLimit 用户检索时返回的最大片段数
+	documentSearchLimit = 10
+)
+
+var (
+	ErrDocumentNotFound = errors.New("文档不存在")
+	ErrInvalidDocument  = errors.New("无效的文档")
+)
+
+// documentColumns 列表中返回的字段，不包含文档内容
+var documentColumns = []string{"id", "workspace_id", "uploaded_by", "name", "content_type", "size", "created_at", "updated_at"}
+
+type DocumentService interface {
+	// Upload 向工作区知识库上传纯文本文档，需要编辑者及以上角色
+	Upload(userID, workspaceID uint, name, contentType string, content []byte) (*model.Document, error)
+	// List 分页列出工作区文档，不返回内容
+	List(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.Document], error)
+	// Get 获取文档及其内容
+	Get(userID, workspaceID, documentID uint) (*model.Document, error)
+	// Delete 删除文档，需要编辑者及以上角色
+	Delete(userID, workspaceID, documentID uint) error
+	// Search 按关键词检索工作区知识库，返回命中的片段
+	Search(ctx context.Context, userID, workspaceID uint, query string) ([]tools.DocumentSnippet, error)
+}
+
+type documentService struct {
+	db         *gorm.DB
+	workspaces WorkspaceService
+	searcher   tools.DocumentSearcher
+}
+
+// NewDocumentService 创建工作区文档服务实例
+func NewDocumentService(db *gorm.DB, workspaces WorkspaceService, searcher tools.DocumentSearcher) DocumentService {
+	return &documentService{db: db, workspaces: workspaces, searcher: searcher}
+}
+
+func (s *documentService) Upload(userID, workspaceID uint, name, contentType string, content []byte) (*model.Document, error) {
+	if err := s.requireEditor(userID, workspaceID); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 255 {
+		return nil, fmt.Errorf("%w: 文件名长度应为1到255个字符", ErrInvalidDocument)
+	}
+	if len(content) == 0 || len(content) > documentMaxSize {
+		return nil, fmt.Errorf("%w: 文档大小应为1字节到%dMB", ErrInvalidDocument, documentMaxSize>>20)
+	}
+	if !utf8.Valid(content) || strings.ContainsRune(string(content), 0) {
+		return nil, fmt.Errorf("%w: 只支持UTF-8编码的文本文档", ErrInvalidDocument)
+	}
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	now := time.Now()
+	document := &model.Document{
+		WorkspaceID: workspaceID,
+		UploadedBy:  userID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        len(content),
+		Content:     string(content),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.db.Create(document).Error; err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+func (s *documentService) List(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.Document], error) {
+	if _, err := s.workspaces.MemberRole(userID, workspaceID); err != nil {
+		return nil, err
+	}
+	var documents []model.Document
+	query := s.db.Select(documentColumns).Where("workspace_id = ?", workspaceID)
+	if err := page.Apply(query, "documents").Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	return pagination.NewResult(documents, page, func(document model.Document) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: document.CreatedAt, ID: document.ID}
+	}), nil
+}
+
+func (s *documentService) Get(userID, workspaceID, documentID uint) (*model.Document, error) {
+	if _, err := s.workspaces.MemberRole(userID, workspaceID); err != nil {
+		return nil, err
+	}
+	var document model.Document
+	result := s.db.Where("id = ? AND workspace_id = ?", documentID, workspaceID).Limit(1).Find(&document)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDocumentNotFound
+	}
+	return &document, nil
+}
+
+func (s *documentService) Delete(userID, workspaceID, documentID uint) error {
+	if err := s.requireEditor(userID, workspaceID); err != nil {
+		return err
+	}
+	result := s.db.Where("id = ? AND workspace_id = ?", documentID, workspaceID).Delete(&model.Document{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDocumentNotFound
+	}
+	return nil
+}
+
+func (s *documentService) Search(ctx context.Context, userID, workspaceID uint, query string) ([]tools.DocumentSnippet, error) {
+	if _, err := s.workspaces.MemberRole(userID, workspaceID); err != nil {
+		return nil, err
+	}
+	return s.searcher.SearchDocuments(ctx, workspaceID, query, documentSearchLimit)
+}
+
+// requireEditor 要求用户是工作区的编辑者或所有者
+func (s *documentService) requireEditor(userID, workspaceID uint) error {
+	role, err := s.workspaces.MemberRole(userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if !hasWorkspaceRole(role, model.WorkspaceRoleEditor) {
+		return ErrWorkspaceForbidden
+	}
+	return nil
+}
+
+// documentSearcher 以关键词匹配检索工作区文档，供智能体工具和文档服务使用
+type documentSearcher struct {
+	db *gorm.DB
+}
+
+// NewDocumentSearcher 创建知识库检索实例，调用方负责校验工作区访问权限
+func NewDocumentSearcher(db *gorm.DB) tools.DocumentSearcher {
+	return &documentSearcher{db: db}
+}
+
+// SearchDocuments 查找包含任一关键词的文档，按关键词出现次数排序，每个文档返回第一个命中位置附近的片段
+func (s *documentSearcher) SearchDocuments(ctx context.Context, workspaceID uint, query string, limit int) ([]tools.DocumentSnippet, error) {
+	keywords := searchKeywords(query)
+	snippets := []tools.DocumentSnippet{}
+	if len(keywords) == 0 {
+		return snippets, nil
+	}
+
+	conditions := make([]string, 0, len(keywords))
+	args := make([]interface{}, 0, len(keywords)+1)
+	args = append(args, workspaceID)
+	for _, keyword := range keywords {
+		conditions = append(conditions, "content LIKE ? ESCAPE '!'")
+		args = append(args, "%"+escapeLikeBang(keyword)+"%")
+	}
+	var documents []model.Document
+	result := s.db.WithContext(ctx).
+		Where("workspace_id = ? AND ("+strings.Join(conditions, " OR ")+")", args...).
+		Order("updated_at DESC").Limit(documentSearchCandidates).Find(&documents)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	type scored struct {
+		snippet tools.DocumentSnippet
+		score   int
+	}
+	hits := make([]scored, 0, len(documents))
+	for _, document := range documents {
+		lower := strings.ToLower(document.Content)
+		score, first := 0, -1
+		for _, keyword := range keywords {
+			score += strings.Count(lower, keyword)
+			if index := strings.Index(lower, keyword); index >= 0 && (first < 0 || index < first) {
+				first = index
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		hits = append(hits, scored{score: score, snippet: tools.DocumentSnippet{
+			DocumentID: document.ID,
+			Name:       document.Name,
+			Snippet:    documentSnippet(document.Content, utf8.RuneCountInString(lower[:first])),
+		}})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+
+	for _, hit := range hits {
+		if len(snippets) == limit {
+			break
+		}
+		snippets = append(snippets, hit.snippet)
+	}
+	return snippets, nil
+}
+
+// searchKeywords 将查询拆分为去重后的小写关键词，最多documentSearchKeywords个
+func searchKeywords(query string) []string {
+	var keywords []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Fields(strings.ToLower(query)) {
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		keywords = append(keywords, field)
+		if len(keywords) == documentSearchKeywords {
+			break
+		}
+	}
+	return keywords
+}
+
+// documentSnippet 截取第offset个字符前后documentSnippetRadius个字符，截断处以省略号标记
+func documentSnippet(content string, offset int) string {
+	runes := []rune(content)
+	start := offset - documentSnippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := offset + documentSnippetRadius
+	if end > len(runes) {
+		end = len(runes)
+	}
+	snippet := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentUploadAndAccess(t *testing.T) {
+	workspaces, _, db, _ := setupWorkspaceService(t)
+	documents := NewDocumentService(db, workspaces, NewDocumentSearcher(db))
+
+	// 查看者不能上传，只支持文本文档
+	_, err := documents.Upload(2, 1, "notes.txt", "", []byte("hello"))
+	assert.ErrorIs(t, err, ErrWorkspaceForbidden)
+	_, err = documents.Upload(1, 1, "image.png", "image/png", []byte{0x89, 0x50, 0xff, 0xfe})
+	assert.ErrorIs(t, err, ErrInvalidDocument)
+	_, err = documents.Upload(1, 1, "big.txt", "", []byte(strings.Repeat("a", documentMaxSize+1)))
+	assert.ErrorIs(t, err, ErrInvalidDocument)
+
+	document, err := documents.Upload(1, 1, "notes.txt", "", []byte("hello team"))
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", document.ContentType)
+	assert.Equal(t, 10, document.Size)
+
+	// 列表不返回内容，查看者可以读取文档
+	list, err := documents.List(2, 1, pagination.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, list.Items, 1)
+	assert.Empty(t, list.Items[0].Content)
+	got, err := documents.Get(2, 1, document.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello team", got.Content)
+	_, err = documents.Get(3, 1, document.ID)
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+
+	assert.ErrorIs(t, documents.Delete(2, 1, document.ID), ErrWorkspaceForbidden)
+	assert.NoError(t, documents.Delete(1, 1, document.ID))
+	assert.ErrorIs(t, documents.Delete(1, 1, document.ID), ErrDocumentNotFound)
+}
+
+func TestDocumentSearch(t *testing.T) {
+	workspaces, _, db, _ := setupWorkspaceService(t)
+	documents := NewDocumentService(db, workspaces, NewDocumentSearcher(db))
+	other, err := workspaces.Create(1, "Other")
+	assert.NoError(t, err)
+
+	_, err = documents.Upload(1, 1, "deploy.md", "text/markdown", []byte("Deploy with Docker. Docker images are built by CI."))
+	assert.NoError(t, err)
+	_, err = documents.Upload(1, 1, "onboarding.md", "text/markdown", []byte(strings.Repeat("欢迎加入团队。", 100)+"请先阅读docker文档。"))
+	assert.NoError(t, err)
+	_, err = documents.Upload(1, other.ID, "secret.md", "", []byte("docker secret"))
+	assert.NoError(t, err)
+	_, err = documents.Upload(1, 1, "percent.md", "", []byte("100% done"))
+	assert.NoError(t, err)
+
+	// 按关键词出现次数排序，只检索指定的工作区
+	snippets, err := documents.Search(context.Background(), 2, 1, "DOCKER")
+	assert.NoError(t, err)
+	assert.Len(t, snippets, 2)
+	assert.Equal(t, "deploy.md", snippets[0].Name)
+	assert.True(t, strings.HasPrefix(snippets[1].Snippet, "…"))
+	assert.True(t, strings.HasSuffix(snippets[1].Snippet, "docker文档。"))
+
+	// LIKE通配符按字面匹配
+	snippets, err = documents.Search(context.Background(), 2, 1, "%")
+	assert.NoError(t, err)
+	assert.Len(t, snippets, 1)
+	_, err = documents.Search(context.Background(), 3, 1, "docker")
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+
+	// 智能体工具只在工作区会话中检索
+	tool := tools.NewSearchDocumentsTool(NewDocumentSearcher(db))
+	result, err := tool.InvokableRun(context.Background(), `{"query":"docker"}`)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "does not belong to a workspace")
+	result, err = tool.InvokableRun(tools.WithWorkspace(context.Background(), other.ID), `{"query":"docker"}`)
+	assert.NoError(t, err)
+	var found []tools.DocumentSnippet
+	assert.NoError(t, json.Unmarshal([]byte(result), &found))
+	assert.Equal(t, []tools.DocumentSnippet{{DocumentID: 3, Name: "secret.md", Snippet: "docker secret"}}, found)
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/pdf"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"gorm.io/gorm"
+)
+
+// 支持的导出格式
+const (
+	ExportMarkdown = "md"
+	ExportJSON     = "json"
+	ExportPDF      = "pdf"
+)
+
+// exportArgumentsLength 工具调用摘要中参数的最大长度
+const exportArgumentsLength = 200
+
+var (
+	ErrUnsupportedFormat = errors.New("不支持的导出格式")
+
+	urlPattern = regexp.MustCompile(`https?://[^\s"'<>()\[\]{}\\]+`)
+)
+
+// ConversationExport 导出的会话内容，消息为当前分支
+type ConversationExport struct {
+	Conversation model.Conversation `json:"conversation"`
+	Messages     []ExportMessage    `json:"messages"`
+	ExportedAt   time.Time          `json:"exported_at"`
+}
+
+// ExportMessage 导出的单条消息
+type ExportMessage struct {
+	ID        uint             `json:"id"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Status    string           `json:"status"`
+	CreatedAt time.Time        `json:"created_at"`
+	Tools     []ExportTool     `json:"tools,omitempty"`
+	Citations []ExportCitation `json:"citations,omitempty"`
+}
+
+// ExportTool 工具调用摘要
+type ExportTool struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// ExportCitation 回复引用的来源链接
+type ExportCitation struct {
+	Index int    `json:"index"`
+	URL   string `json:"url"`
+}
+
+// ExportFile 导出的文件
+type ExportFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+type ExportService interface {
+	// ExportConversation 按格式导出单个会话
+	ExportConversation(userID, conversationID uint, format string) (*ExportFile, error)
+	// ExportAll 将用户的全部会话按格式导出后打包为zip写入w
+	ExportAll(userID uint, format string, w io.Writer) error
+}
+
+type exportService struct {
+	db   *gorm.DB
+	chat ChatService
+	tm   template.TemplateManager
+}
+
+// NewExportService 创建导出服务实例
+func NewExportService(db *gorm.DB, chat ChatService, tm template.TemplateManager) ExportService {
+	return &exportService{db: db, chat: chat, tm: tm}
+}
+
+func (s *exportService) ExportConversation(userID, conversationID uint, format string) (*ExportFile, error) {
+	var conversation model.Conversation
+	if result := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation); result.Error != nil {
+		return nil, ErrConversationNotFound
+	}
+	return s.export(&conversation, format)
+}
+
+func (s *exportService) ExportAll(userID uint, format string, w io.Writer) error {
+	if !supportedFormat(format) {
+		return ErrUnsupportedFormat
+	}
+
+	var conversations []model.Conversation
+	if result := s.db.Where("user_id = ?", userID).Order("id asc").Find(&conversations); result.Error != nil {
+		return result.Error
+	}
+
+	archive := zip.NewWriter(w)
+	for i := range conversations {
+		file, err := s.export(&conversations[i], format)
+		if err != nil {
+			return err
+		}
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: conversations[i].UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(file.Data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// export 加载会话当前分支并渲染为指定格式
+func (s *exportService) export(conversation *model.Conversation, format string) (*ExportFile, error) {
+	if !supportedFormat(format) {
+		return nil, ErrUnsupportedFormat
+	}
+	data, err := s.load(conversation)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &ExportFile{Name: exportFileName(conversation, format)}
+	switch format {
+	case ExportMarkdown:
+		content, err := s.tm.RenderText(template.ConversationMarkdown, data)
+		if err != nil {
+			return nil, err
+		}
+		file.ContentType = "text/markdown; charset=utf-8"
+		file.Data = []byte(content)
+	case ExportJSON:
+		file.ContentType = "application/json"
+		file.Data, err = json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+	case ExportPDF:
+		file.ContentType = "application/pdf"
+		file.Data = renderPDF(data)
+	}
+	return file, nil
+}
+
+// load 组装导出数据，包含工具调用摘要和引用来源
+func (s *exportService) load(conversation *model.Conversation) (*ConversationExport, error) {
+	messages, err := s.chat.GetConversationMessages(conversation.UserID, conversation.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &ConversationExport{
+		Conversation: *conversation,
+		Messages:     make([]ExportMessage, 0, len(messages)),
+		ExportedAt:   time.Now(),
+	}
+	for _, message := range messages {
+		exported := ExportMessage{
+			ID:        message.ID,
+			Role:      message.Role,
+			Content:   message.Content,
+			Status:    message.Status,
+			CreatedAt: message.CreatedAt,
+		}
+		// 引用来源取自工具结果和回复内容中的链接
+		sources := []string{message.Content}
+		for _, step := range message.Trace {
+			if step.Type != model.TraceStepToolCall {
+				continue
+			}
+			exported.Tools = append(exported.Tools, ExportTool{
+				Name:      step.ToolName,
+				Arguments: truncate(step.Arguments, exportArgumentsLength),
+				Error:     step.Error,
+				LatencyMs: step.LatencyMs,
+			})
+			sources = append(sources, step.Result)
+		}
+		if message.Role == "assistant" {
+			exported.Citations = citations(sources)
+		}
+		data.Messages = append(data.Messages, exported)
+	}
+	return data, nil
+}
+
+// renderPDF 将会话渲染为PDF
+func renderPDF(data *ConversationExport) []byte {
+	doc := pdf.New()
+	title := data.Conversation.Title
+	if title == "" {
+		title = fmt.Sprintf("会话 %d", data.Conversation.ID)
+	}
+	doc.Heading(title)
+	doc.Note(fmt.Sprintf("创建于 %s，导出于 %s",
+		data.Conversation.CreatedAt.Format("2006-01-02 15:04"), data.ExportedAt.Format("2006-01-02 15:04")))
+
+	for _, message := range data.Messages {
+		doc.Space(12)
+		role := "助手"
+		if message.Role == "user" {
+			role = "用户"
+		}
+		header := fmt.Sprintf("%s · %s", role, message.CreatedAt.Format("2006-01-02 15:04:05"))
+		if message.Status == model.MessageStatusCancelled {
+			header += "（已取消）"
+		}
+		doc.Note(header)
+		for _, tool := range message.Tools {
+			line := fmt.Sprintf("工具调用 %s %s", tool.Name, tool.Arguments)
+			if tool.Error != "" {
+				line += " — 失败：" + tool.Error
+			}
+			doc.Note(line)
+		}
+		doc.Paragraph(message.Content)
+		if len(message.Citations) > 0 {
+			doc.Space(4)
+			doc.Note("引用来源")
+			for _, citation := range message.Citations {
+				doc.Note(fmt.Sprintf("%d. %s", citation.Index, citation.URL))
+			}
+		}
+	}
+	return doc.Bytes()
+}
+
+// citations 按出现顺序提取去重后的链接
+func citations(sources []string) []ExportCitation {
+	var result []ExportCitation
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		for _, url := range urlPattern.FindAllString(source, -1) {
+			url = strings.TrimRight(url, ".,;:!?，。；：！？")
+			if seen[url] {
+				continue
+			}
+			seen[url] = true
+			result = append(result, ExportCitation{Index: len(result) + 1, URL: url})
+		}
+	}
+	return result
+}
+
+func supportedFormat(format string) bool {
+	return format == ExportMarkdown || format == ExportJSON || format == ExportPDF
+}
+
+// exportFileName 生成导出文件名，去除标题中不能用于文件名的字符
+func exportFileName(conversation *model.Conversation, format string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return -1
+		}
+		if r == ' ' {
+			return '-'
+		}
+		return r
+	}, conversation.Title)
+	name = truncate(name, 40)
+	if name == "" {
+		return fmt.Sprintf("conversation-%d.%s", conversation.ID, format)
+	}
+	return fmt.Sprintf("%d-%s.%s", conversation.ID, name, format)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupExportService(t *testing.T) (ExportService, uint) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}, &model.TraceStep{}))
+
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(schema.AssistantMessage("Eino是字节跳动开源的框架，详见 https://github.com/cloudwego/eino。", nil), nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, nil, nil)
+
+	response, err := chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, Content: "什么是eino"}, SendOptions{})
+	assert.NoError(t, err)
+	conversationID := response["conversation_id"].(uint)
+	reply := response["reply"].(*model.ChatMessage)
+	db.Model(&model.Conversation{}).Where("id = ?", conversationID).Update("title", "Eino 入门/介绍")
+	db.Create(&model.TraceStep{
+		MessageID: reply.ID, Seq: 1, Type: model.TraceStepToolCall, ToolName: "duckduckgo_search",
+		Arguments: `{"query":"eino"}`, Result: `[{"link":"https://www.cloudwego.io/zh/docs/eino/"}]`, LatencyMs: 320,
+	})
+
+	tm, err := template.NewTemplateManager()
+	assert.NoError(t, err)
+	return NewExportService(db, chatService, tm), conversationID
+}
+
+func TestExportConversation(t *testing.T) {
+	exportService, conversationID := setupExportService(t)
+
+	file, err := exportService.ExportConversation(1, conversationID, ExportMarkdown)
+	assert.NoError(t, err)
+	assert.Equal(t, "1-Eino-入门介绍.md", file.Name)
+	content := string(file.Data)
+	assert.Contains(t, content, "# Eino 入门/介绍")
+	assert.Contains(t, content, "`duckduckgo_search` {\"query\":\"eino\"}（320ms）")
+	assert.Contains(t, content, "1. <https://github.com/cloudwego/eino>")
+	assert.Contains(t, content, "2. <https://www.cloudwego.io/zh/docs/eino/>")
+
+	file, err = exportService.ExportConversation(1, conversationID, ExportJSON)
+	assert.NoError(t, err)
+	var exported ConversationExport
+	assert.NoError(t, json.Unmarshal(file.Data, &exported))
+	assert.Len(t, exported.Messages, 2)
+	assert.Len(t, exported.Messages[1].Tools, 1)
+	assert.Len(t, exported.Messages[1].Citations, 2)
+
+	file, err = exportService.ExportConversation(1, conversationID, ExportPDF)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(file.Data, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(file.Data, []byte("%%EOF\n")))
+
+	_, err = exportService.ExportConversation(1, conversationID, "docx")
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	_, err = exportService.ExportConversation(2, conversationID, ExportMarkdown)
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+}
+
+func TestExportAll(t *testing.T) {
+	exportService, _ := setupExportService(t)
+
+	var buf bytes.Buffer
+	assert.NoError(t, exportService.ExportAll(1, ExportJSON, &buf))
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, archive.File, 1)
+	assert.Equal(t, "1-Eino-入门介绍.json", archive.File[0].Name)
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// feedbackCommentLength 反馈文字的最大字符数
+	feedbackCommentLength = 2000
+	// feedbackExportBatch 导出时每批加载的反馈数
+	feedbackExportBatch = 100
+)
+
+// FeedbackReasons 可选的反馈原因
+var FeedbackReasons = []string{
+	"accurate", "helpful", "well_formatted", // 正面
+	"inaccurate", "unhelpful", "incomplete", "bad_tool_use", "unsafe", "too_verbose", // 负面
+	"other",
+}
+
+var ErrFeedbackNotFound = errors.New("反馈不存在")
+
+// FeedbackInput 提交的反馈内容
+type FeedbackInput struct {
+	Rating  string
+	Reasons []string
+	Comment string
+}
+
+// FeedbackQuery 导出反馈的筛选条件，零值表示不限制
+type FeedbackQuery struct {
+	From            time.Time
+	To              time.Time
+	Rating          string
+	Model           string
+	PromptVersionID uint
+}
+
+// FeedbackExample 导出的评估样本，input为被评价回复之前的对话
+type FeedbackExample struct {
+	FeedbackID      uint             `json:"feedback_id"`
+	MessageID       uint             `json:"message_id"`
+	ConversationID  uint             `json:"conversation_id"`
+	Rating          string           `json:"rating"`
+	Reasons         []string         `json:"reasons"`
+	Comment         string           `json:"comment,omitempty"`
+	Model           string           `json:"model,omitempty"`
+	PromptVersionID uint             `json:"prompt_version_id,omitempty"`
+	PromptName      string           `json:"prompt_name,omitempty"`
+	PromptVersion   int              `json:"prompt_version,omitempty"`
+	Input           []ExampleMessage `json:"input"`
+	Output          string           `json:"output"`
+	RatedAt         time.Time        `json:"rated_at"`
+}
+
+// ExampleMessage 评估样本中的一条上下文消息
+type ExampleMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type FeedbackService interface {
+	// Submit 提交或更新对助手回复的评价
+	Submit(userID, messageID uint, input FeedbackInput) (*model.MessageFeedback, error)
+	// Delete 撤回评价
+	Delete(userID, messageID uint) error
+	// Export 按条件导出有评价的样本，每行一个JSON写入w
+	Export(query FeedbackQuery, w io.Writer) error
+}
+
+type feedbackService struct {
+	db *gorm.DB
+}
+
+// NewFeedbackService 创建反馈服务实例
+func NewFeedbackService(db *gorm.DB) FeedbackService {
+	return &feedbackService{db: db}
+}
+
+func (s *feedbackService) Submit(userID, messageID uint, input FeedbackInput) (*model.MessageFeedback, error) {
+	if input.Rating != model.FeedbackUp && input.Rating != model.FeedbackDown {
+		return nil, errors.New("评分只能是up或down")
+	}
+	reasons, err := normalizeReasons(input.Reasons)
+	if err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(input.Comment) > feedbackCommentLength {
+		return nil, errors.New("反馈内容过长")
+	}
+
+	var message model.ChatMessage
+	result := s.db.Where("id = ? AND user_id = ? AND role = ?", messageID, userID, "assistant").First(&message)
+	if result.Error != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	feedback := model.MessageFeedback{UserID: userID, MessageID: messageID}
+	if result := s.db.Where(&feedback).Limit(1).Find(&feedback); result.Error != nil {
+		return nil, result.Error
+	}
+	feedback.ConversationID = message.ConversationID
+	feedback.Rating = input.Rating
+	feedback.Reasons = reasons
+	feedback.Comment = input.Comment
+	feedback.Model = message.Model
+	feedback.PromptVersionID = message.PromptVersionID
+	if result := s.db.Save(&feedback); result.Error != nil {
+		return nil, result.Error
+	}
+	return &feedback, nil
+}
+
+func (s *feedbackService) Delete(userID, messageID uint) error {
+	result := s.db.Where("user_id = ? AND message_id = ?", userID, messageID).Delete(&model.MessageFeedback{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedbackNotFound
+	}
+	return nil
+}
+
+func (s *feedbackService) Export(query FeedbackQuery, w io.Writer) error {
+	db := s.db.Model(&model.MessageFeedback{})
+	if !query.From.IsZero() {
+		db = db.Where("updated_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("updated_at < ?", query.To)
+	}
+	if query.Rating != "" {
+		db = db.Where("rating = ?", query.Rating)
+	}
+	if query.Model != "" {
+		db = db.Where("model = ?", query.Model)
+	}
+	if query.PromptVersionID != 0 {
+		db = db.Where("prompt_version_id = ?", query.PromptVersionID)
+	}
+
+	encoder := json.NewEncoder(w)
+	versions := make(map[uint]*promptVersionInfo)
+	var feedbacks []model.MessageFeedback
+	var exportErr error
+	result := db.Order("id asc").FindInBatches(&feedbacks, feedbackExportBatch, func(tx *gorm.DB, batch int) error {
+		// 同一批中同一会话的消息只加载一次
+		trees := make(map[uint]map[uint]*model.ChatMessage)
+		for _, feedback := range feedbacks {
+			nodes, ok := trees[feedback.ConversationID]
+			if !ok {
+				var err error
+				if nodes, err = s.loadMessages(feedback.ConversationID); err != nil {
+					return err
+				}
+				trees[feedback.ConversationID] = nodes
+			}
+			path := branch(nodes, feedback.MessageID)
+			if len(path) == 0 {
+				// 消息已被删除
+				continue
+			}
+
+			example := FeedbackExample{
+				FeedbackID:      feedback.ID,
+				MessageID:       feedback.MessageID,
+				ConversationID:  feedback.ConversationID,
+				Rating:          feedback.Rating,
+				Reasons:         feedback.Reasons,
+				Comment:         feedback.Comment,
+				Model:           feedback.Model,
+				PromptVersionID: feedback.PromptVersionID,
+				Input:           make([]ExampleMessage, 0, len(path)-1),
+				Output:          path[len(path)-1].Content,
+				RatedAt:         feedback.UpdatedAt,
+			}
+			for _, message := range path[:len(path)-1] {
+				example.Input = append(example.Input, ExampleMessage{Role: message.Role, Content: message.Content})
+			}
+			if feedback.PromptVersionID != 0 {
+				info, err := s.promptVersion(versions, feedback.PromptVersionID)
+				if err != nil {
+					return err
+				}
+				example.PromptName = info.name
+				example.PromptVersion = info.version
+			}
+			if err := encoder.Encode(example); err != nil {
+				exportErr = err
+				return err
+			}
+		}
+		return nil
+	})
+	if exportErr != nil {
+		return exportErr
+	}
+	return result.Error
+}
+
+// loadMessages 加载会话全部消息用于还原上下文
+func (s *feedbackService) loadMessages(conversationID uint) (map[uint]*model.ChatMessage, error) {
+	var messages []*model.ChatMessage
+	result := s.db.Select("id", "parent_id", "role", "content").Where("conversation_id = ?", conversationID).Find(&messages)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	nodes := make(map[uint]*model.ChatMessage, len(messages))
+	for _, message := range messages {
+		nodes[message.ID] = message
+	}
+	return nodes, nil
+}
+
+// promptVersionInfo 提示词版本对应的名称和版本号
+type promptVersionInfo struct {
+	name    string
+	version int
+}
+
+// promptVersion 查询提示词版本信息并缓存
+func (s *feedbackService) promptVersion(cache map[uint]*promptVersionInfo, versionID uint) (*promptVersionInfo, error) {
+	if info, ok := cache[versionID]; ok {
+		return info, nil
+	}
+	info := &promptVersionInfo{}
+	var version model.PromptVersion
+	if result := s.db.Where("id = ?", versionID).Limit(1).Find(&version); result.Error != nil {
+		return nil, result.Error
+	}
+	if version.ID != 0 {
+		var prompt model.Prompt
+		if result := s.db.Select("name").Where("id = ?", version.PromptID).Limit(1).Find(&prompt); result.Error != nil {
+			return nil, result.Error
+		}
+		info.name = prompt.Name
+		info.version = version.Version
+	}
+	cache[versionID] = info
+	return info, nil
+}
+
+// normalizeReasons 校验反馈原因并去重
+func normalizeReasons(reasons []string) ([]string, error) {
+	normalized := make([]string, 0, len(reasons))
+	seen := make(map[string]bool, len(reasons))
+	for _, reason := range reasons {
+		valid := false
+		for _, allowed := range FeedbackReasons {
+			if reason == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, errors.New("无效的反馈原因: " + reason)
+		}
+		if !seen[reason] {
+			seen[reason] = true
+			normalized = append(normalized, reason)
+		}
+	}
+	return normalized, nil
+}
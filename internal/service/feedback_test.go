@@ -0,0 +1,100 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupFeedbackService(t *testing.T) (FeedbackService, *gorm.DB, *model.ChatMessage) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}, &model.MessageFeedback{}, &model.Prompt{}, &model.PromptVersion{}))
+
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(schema.AssistantMessage("Go是一门编程语言", nil), nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, nil, nil)
+	response, err := chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, Content: "什么是Go"}, SendOptions{})
+	assert.NoError(t, err)
+	reply := response["reply"].(*model.ChatMessage)
+
+	// 模拟使用提示词版本和模型生成的回复
+	prompt := model.Prompt{Name: "assistant"}
+	db.Create(&prompt)
+	version := model.PromptVersion{PromptID: prompt.ID, Version: 3, Content: "你是助手"}
+	db.Create(&version)
+	db.Model(reply).Updates(map[string]interface{}{"model": "gpt-4o", "prompt_version_id": version.ID})
+
+	return NewFeedbackService(db), db, reply
+}
+
+func TestSubmitFeedback(t *testing.T) {
+	feedbackService, db, reply := setupFeedbackService(t)
+
+	feedback, err := feedbackService.Submit(1, reply.ID, FeedbackInput{Rating: model.FeedbackDown, Reasons: []string{"incomplete", "incomplete"}, Comment: "缺少示例"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"incomplete"}, feedback.Reasons)
+	assert.Equal(t, "gpt-4o", feedback.Model)
+	assert.NotZero(t, feedback.PromptVersionID)
+
+	// 重复提交覆盖之前的评价
+	_, err = feedbackService.Submit(1, reply.ID, FeedbackInput{Rating: model.FeedbackUp, Reasons: []string{"helpful"}})
+	assert.NoError(t, err)
+	var feedbacks []model.MessageFeedback
+	db.Find(&feedbacks)
+	assert.Len(t, feedbacks, 1)
+	assert.Equal(t, model.FeedbackUp, feedbacks[0].Rating)
+	assert.Equal(t, []string{"helpful"}, feedbacks[0].Reasons)
+
+	_, err = feedbackService.Submit(1, reply.ID, FeedbackInput{Rating: "meh"})
+	assert.Error(t, err)
+	_, err = feedbackService.Submit(1, reply.ID, FeedbackInput{Rating: model.FeedbackUp, Reasons: []string{"funny"}})
+	assert.Error(t, err)
+	// 只能评价自己的助手回复
+	_, err = feedbackService.Submit(2, reply.ID, FeedbackInput{Rating: model.FeedbackUp})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = feedbackService.Submit(1, *reply.ParentID, FeedbackInput{Rating: model.FeedbackUp})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+
+	assert.NoError(t, feedbackService.Delete(1, reply.ID))
+	assert.ErrorIs(t, feedbackService.Delete(1, reply.ID), ErrFeedbackNotFound)
+}
+
+func TestExportFeedback(t *testing.T) {
+	feedbackService, _, reply := setupFeedbackService(t)
+	_, err := feedbackService.Submit(1, reply.ID, FeedbackInput{Rating: model.FeedbackDown, Reasons: []string{"inaccurate"}, Comment: "不准确"})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, feedbackService.Export(FeedbackQuery{Rating: model.FeedbackDown}, &buf))
+	var examples []FeedbackExample
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var example FeedbackExample
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &example))
+		examples = append(examples, example)
+	}
+	assert.Len(t, examples, 1)
+	example := examples[0]
+	assert.Equal(t, []ExampleMessage{{Role: "user", Content: "什么是Go"}}, example.Input)
+	assert.Equal(t, "Go是一门编程语言", example.Output)
+	assert.Equal(t, "gpt-4o", example.Model)
+	assert.Equal(t, "assistant", example.PromptName)
+	assert.Equal(t, 3, example.PromptVersion)
+	assert.Equal(t, []string{"inaccurate"}, example.Reasons)
+
+	buf.Reset()
+	assert.NoError(t, feedbackService.Export(FeedbackQuery{Rating: model.FeedbackUp}, &buf))
+	assert.Zero(t, buf.Len())
+	assert.NoError(t, feedbackService.Export(FeedbackQuery{Model: "gpt-3.5-turbo"}, &buf))
+	assert.Zero(t, buf.Len())
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	einoagent "github.com/cloudwego/eino/flow/agent"
+	"github.com/cloudwego/eino/schema"
+	ucb "github.com/cloudwego/eino/utils/callbacks"
+	"github.com/davlin-coder/davlin/internal/resource/agent"
+	"github.com/davlin-coder/davlin/internal/resource/llm"
+)
+
+// GatewayAgentModel 网关中代表Davlin智能体的模型名称，使用服务端工具生成最终回答
+const GatewayAgentModel = "davlin-agent"
+
+var (
+	ErrModelNotFound    = errors.New("模型不存在")
+	ErrAgentCustomTools = errors.New(GatewayAgentModel + "使用服务端工具，不支持自定义工具")
+)
+
+// CompletionRequest 网关的一次补全请求
+type CompletionRequest struct {
+	UserID     uint
+	Model      string
+	Messages   []*schema.Message
+	Tools      []*schema.ToolInfo // 客户端定义的工具，模型返回工具调用由客户端执行
+	ToolChoice *schema.ToolChoice
+	Options    []einomodel.Option // 温度、最大token数等采样参数
+}
+
+type GatewayService interface {
+	// Models 返回网关可用的模型
+	Models() ([]string, error)
+	// Complete 调用模型并返回完整回复和本次请求的token用量
+	Complete(ctx context.Context, request CompletionRequest) (*schema.Message, *schema.TokenUsage, error)
+	// Stream 流式调用模型，每个片段回调一次onChunk，结束后返回token用量
+	Stream(ctx context.Context, request CompletionRequest, onChunk func(*schema.Message) error) (*schema.TokenUsage, error)
+}
+
+type gatewayService struct {
+	agent   agent.Agent
+	models  llm.ModelFactory
+	usage   UsageService
+	quota   QuotaService
+	catalog ModelCatalog
+}
+
+// NewGatewayService 创建OpenAI兼容网关服务实例，可用模型由模型目录管理
+func NewGatewayService(agent agent.Agent, models llm.ModelFactory, usage UsageService, quota QuotaService, catalog ModelCatalog) GatewayService {
+	return &gatewayService{agent: agent, models: models, usage: usage, quota: quota, catalog: catalog}
+}
+
+func (s *gatewayService) Models() ([]string, error) {
+	return s.catalog.Available()
+}
+
+func (s *gatewayService) Complete(ctx context.Context, request CompletionRequest) (*schema.Message, *schema.TokenUsage, error) {
+	var message *schema.Message
+	usage, err := s.run(ctx, request, func(ctx context.Context, generate generator) error {
+		var err error
+		message, err = generate.Generate(ctx, request.Messages)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return message, usage, nil
+}
+
+func (s *gatewayService) Stream(ctx context.Context, request CompletionRequest, onChunk func(*schema.Message) error) (*schema.TokenUsage, error) {
+	return s.run(ctx, request, func(ctx context.Context, generate generator) error {
+		stream, err := generate.Stream(ctx, request.Messages)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := onChunk(chunk); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// generator 统一智能体和模型的调用方式
+type generator interface {
+	Generate(ctx context.Context, input []*schema.Message) (*schema.Message, error)
+	Stream(ctx context.Context, input []*schema.Message) (*schema.StreamReader[*schema.Message], error)
+}
+
+// run 检查配额并挂载用量回调后调用模型，返回本次请求全部模型调用的token用量
+func (s *gatewayService) run(ctx context.Context, request CompletionRequest, call func(context.Context, generator) error) (*schema.TokenUsage, error) {
+	available, err := s.hasModel(request.Model)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, request.Model)
+	}
+	if request.Model == GatewayAgentModel && len(request.Tools) > 0 {
+		return nil, ErrAgentCustomTools
+	}
+
+	if s.quota != nil {
+		release, err := s.quota.Acquire(ctx, request.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	collector := &usageCollector{}
+	handlers := []callbacks.Handler{collector.Handler()}
+	if s.usage != nil {
+		handlers = append(handlers, s.usage.CallbackHandler(request.UserID, 0))
+	}
+
+	var target generator
+	if request.Model == GatewayAgentModel {
+		target = &agentGenerator{agent: s.agent, opts: []einoagent.AgentOption{einoagent.WithComposeOptions(
+			compose.WithCallbacks(handlers...),
+			compose.WithChatModelOption(request.Options...),
+		)}}
+	} else {
+		chatModel, err := s.models(ctx, request.Model)
+		if err != nil {
+			return nil, err
+		}
+		// 模型实例仅用于本次请求，绑定客户端工具不影响其他请求
+		if len(request.Tools) > 0 {
+			if err := chatModel.BindTools(request.Tools); err != nil {
+				return nil, err
+			}
+		}
+		opts := request.Options
+		if request.ToolChoice != nil {
+			opts = append(opts, einomodel.WithToolChoice(*request.ToolChoice))
+		}
+		ctx = callbacks.InitCallbacks(ctx, &callbacks.RunInfo{Name: request.Model, Component: components.ComponentOfChatModel}, handlers...)
+		target = &modelGenerator{model: chatModel, opts: opts}
+	}
+
+	if err := call(ctx, target); err != nil {
+		return nil, err
+	}
+	usage := collector.Usage()
+	return &usage, nil
+}
+
+func (s *gatewayService) hasModel(name string) (bool, error) {
+	names, err := s.catalog.Available()
+	if err != nil {
+		return false, err
+	}
+	for _, model := range names {
+		if model == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type agentGenerator struct {
+	agent agent.Agent
+	opts  []einoagent.AgentOption
+}
+
+func (g *agentGenerator) Generate(ctx context.Context, input []*schema.Message) (*schema.Message, error) {
+	return g.agent.Generate(ctx, input, g.opts...)
+}
+
+func (g *agentGenerator) Stream(ctx context.Context, input []*schema.Message) (*schema.StreamReader[*schema.Message], error) {
+	return g.agent.Stream(ctx, input, g.opts...)
+}
+
+type modelGenerator struct {
+	model einomodel.ChatModel
+	opts  []einomodel.Option
+}
+
+func (g *modelGenerator) Generate(ctx context.Context, input []*schema.Message) (*schema.Message, error) {
+	return g.model.Generate(ctx, input, g.opts...)
+}
+
+func (g *modelGenerator) Stream(ctx context.Context, input []*schema.Message) (*schema.StreamReader[*schema.Message], error) {
+	return g.model.Stream(ctx, input, g.opts...)
+}
+
+// usageCollector 通过回调累加一次请求中全部模型调用的token用量
+type usageCollector struct {
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+	usage schema.TokenUsage
+}
+
+func (u *usageCollector) Handler() callbacks.Handler {
+	return ucb.NewHandlerHelper().ChatModel(&ucb.ModelCallbackHandler{
+		OnEnd: func(ctx context.Context, runInfo *callbacks.RunInfo, output *einomodel.CallbackOutput) context.Context {
+			if output != nil {
+				u.add(output.TokenUsage)
+			}
+			return ctx
+		},
+		OnEndWithStreamOutput: func(ctx context.Context, runInfo *callbacks.RunInfo, output *schema.StreamReader[*einomodel.CallbackOutput]) context.Context {
+			u.wg.Add(1)
+			go func() {
+				defer u.wg.Done()
+				defer output.Close()
+				var last *einomodel.TokenUsage
+				for {
+					chunk, err := output.Recv()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						return
+					}
+					if chunk != nil && chunk.TokenUsage != nil {
+						last = chunk.TokenUsage
+					}
+				}
+				u.add(last)
+			}()
+			return ctx
+		},
+	}).Handler()
+}
+
+func (u *usageCollector) add(usage *einomodel.TokenUsage) {
+	if usage == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.usage.PromptTokens += usage.PromptTokens
+	u.usage.CompletionTokens += usage.CompletionTokens
+	u.usage.TotalTokens += usage.TotalTokens
+}
+
+// Usage 等待流式输出处理完成后返回累计用量
+func (u *usageCollector) Usage() schema.TokenUsage {
+	u.wg.Wait()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.usage
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/callbacks"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// usageChatModel 模拟通过回调上报用量的模型，记录绑定的工具
+type usageChatModel struct {
+	reply *schema.Message
+	tools []*schema.ToolInfo
+}
+
+func (m *usageChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...einomodel.Option) (*schema.Message, error) {
+	callbacks.OnEnd(ctx, &einomodel.CallbackOutput{Message: m.reply, TokenUsage: &einomodel.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}})
+	return m.reply, nil
+}
+
+func (m *usageChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...einomodel.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{schema.AssistantMessage("Hel", nil), schema.AssistantMessage(msg.Content[3:], nil)}), nil
+}
+
+func (m *usageChatModel) BindTools(tools []*schema.ToolInfo) error {
+	m.tools = tools
+	return nil
+}
+
+func setupGatewayService(t *testing.T, reply *schema.Message) (GatewayService, *MockAgent, *usageChatModel) {
+	agent := new(MockAgent)
+	chatModel := &usageChatModel{reply: reply}
+	cfg := &config.Config{LLM: config.LLMConfig{Model: "gpt-4o", TitleModel: "gpt-4o-mini"}}
+	factory := func(ctx context.Context, name string) (einomodel.ChatModel, error) {
+		return chatModel, nil
+	}
+	return NewGatewayService(agent, factory, nil, nil, setupModelCatalog(t, cfg)), agent, chatModel
+}
+
+func TestGatewayComplete(t *testing.T) {
+	gateway, agent, chatModel := setupGatewayService(t, schema.AssistantMessage("Hello", nil))
+	models, err := gateway.Models()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{GatewayAgentModel, "gpt-4o", "gpt-4o-mini"}, models)
+
+	// 直接调用模型时绑定客户端工具并统计用量
+	tools := []*schema.ToolInfo{{Name: "get_weather"}}
+	message, usage, err := gateway.Complete(context.Background(), CompletionRequest{
+		UserID: 1, Model: "gpt-4o", Messages: []*schema.Message{schema.UserMessage("hi")}, Tools: tools,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", message.Content)
+	assert.Equal(t, 15, usage.TotalTokens)
+	assert.Equal(t, tools, chatModel.tools)
+
+	// 智能体模型使用服务端工具
+	agent.On("Generate", mock.Anything, mock.Anything).Return(schema.AssistantMessage("researched", nil), nil)
+	message, _, err = gateway.Complete(context.Background(), CompletionRequest{UserID: 1, Model: GatewayAgentModel, Messages: []*schema.Message{schema.UserMessage("hi")}})
+	assert.NoError(t, err)
+	assert.Equal(t, "researched", message.Content)
+
+	_, _, err = gateway.Complete(context.Background(), CompletionRequest{UserID: 1, Model: GatewayAgentModel, Tools: tools})
+	assert.ErrorIs(t, err, ErrAgentCustomTools)
+	_, _, err = gateway.Complete(context.Background(), CompletionRequest{UserID: 1, Model: "claude"})
+	assert.ErrorIs(t, err, ErrModelNotFound)
+}
+
+func TestGatewayStream(t *testing.T) {
+	gateway, _, _ := setupGatewayService(t, schema.AssistantMessage("Hello", nil))
+
+	var content string
+	usage, err := gateway.Stream(context.Background(), CompletionRequest{UserID: 1, Model: "gpt-4o", Messages: []*schema.Message{schema.UserMessage("hi")}}, func(chunk *schema.Message) error {
+		content += chunk.Content
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", content)
+	assert.Equal(t, 10, usage.PromptTokens)
+}
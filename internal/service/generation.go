@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/resource/redis"
+)
+
+const (
+	// generationTTL 生成记录的有效期，生成过程中会不断续期，防止实例崩溃后残留
+	generationTTL = time.Minute
+	// generationPollInterval 检查取消标记的间隔
+	generationPollInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrGenerationCancelled  = errors.New("生成已取消")
+	ErrGenerationInProgress = errors.New("该会话正在生成回复")
+	ErrNoActiveGeneration   = errors.New("该会话没有正在进行的生成")
+)
+
+// GenerationRegistry 记录各会话正在进行的生成，基于Redis实现以支持多实例部署
+type GenerationRegistry interface {
+	// Start 登记会话的生成，返回可被取消的上下文及结束时调用的done
+	Start(ctx context.Context, userID, conversationID uint) (context.Context, func(), error)
+	// Cancel 取消会话正在进行的生成，生成可以运行在任意实例上
+	Cancel(ctx context.Context, userID, conversationID uint) error
+}
+
+type generationRegistry struct {
+	redisClient redis.RedisClient
+	mu          sync.Mutex
+	local       map[uint]context.CancelCauseFunc // 本实例上运行的生成，可直接取消
+}
+
+func NewGenerationRegistry(redisClient redis.RedisClient) GenerationRegistry {
+	return &generationRegistry{
+		redisClient: redisClient,
+		local:       make(map[uint]context.CancelCauseFunc),
+	}
+}
+
+func (r *generationRegistry) Start(ctx context.Context, userID, conversationID uint) (context.Context, func(), error) {
+	token, err := generationToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	activeKey := generationActiveKey(conversationID)
+	ok, err := r.redisClient.SetNX(ctx, activeKey, fmt.Sprintf("%d:%s", userID, token), generationTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("登记生成失败: %v", err)
+	}
+	if !ok {
+		return nil, nil, ErrGenerationInProgress
+	}
+	// 清除上一次残留的取消标记
+	_ = r.redisClient.Del(ctx, generationCancelKey(conversationID))
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	r.mu.Lock()
+	r.local[conversationID] = cancel
+	r.mu.Unlock()
+
+	stop := make(chan struct{})
+	go r.watch(ctx, conversationID, cancel, stop)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			close(stop)
+			cancel(nil)
+			r.mu.Lock()
+			delete(r.local, conversationID)
+			r.mu.Unlock()
+
+			// 使用独立的上下文清理，请求上下文此时可能已被取消
+			cleanup := context.Background()
+			if value, err := r.redisClient.Get(cleanup, activeKey); err == nil && strings.HasSuffix(value, ":"+token) {
+				_ = r.redisClient.Del(cleanup, activeKey)
+			}
+			_ = r.redisClient.Del(cleanup, generationCancelKey(conversationID))
+		})
+	}
+	return ctx, done, nil
+}
+
+// watch 定期检查其他实例设置的取消标记，并为生成记录续期
+func (r *generationRegistry) watch(ctx context.Context, conversationID uint, cancel context.CancelCauseFunc, stop <-chan struct{}) {
+	ticker := time.NewTicker(generationPollInterval)
+	defer ticker.Stop()
+
+	background := context.Background()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.redisClient.Get(background, generationCancelKey(conversationID)); err == nil {
+				cancel(ErrGenerationCancelled)
+				return
+			}
+			_ = r.redisClient.Expire(background, generationActiveKey(conversationID), generationTTL)
+		}
+	}
+}
+
+func (r *generationRegistry) Cancel(ctx context.Context, userID, conversationID uint) error {
+	value, err := r.redisClient.Get(ctx, generationActiveKey(conversationID))
+	if err != nil || !strings.HasPrefix(value, fmt.Sprintf("%d:", userID)) {
+		return ErrNoActiveGeneration
+	}
+
+	r.mu.Lock()
+	cancel, ok := r.local[conversationID]
+	r.mu.Unlock()
+	if ok {
+		cancel(ErrGenerationCancelled)
+		return nil
+	}
+	return r.redisClient.Set(ctx, generationCancelKey(conversationID), "1", generationTTL)
+}
+
+func generationActiveKey(conversationID uint) string {
+	return fmt.Sprintf("generation:active:%d", conversationID)
+}
+
+func generationCancelKey(conversationID uint) string {
+	return fmt.Sprintf("generation:cancel:%d", conversationID)
+}
+
+func generationToken() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
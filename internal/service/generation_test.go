@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGenerationRegistryAcrossReplicas(t *testing.T) {
+	redisClient := newMemoryRedis()
+	replicaA := NewGenerationRegistry(redisClient)
+	replicaB := NewGenerationRegistry(redisClient)
+
+	ctx, done, err := replicaA.Start(context.Background(), 1, 10)
+	assert.NoError(t, err)
+	defer done()
+
+	// 同一会话不能同时生成
+	_, _, err = replicaB.Start(context.Background(), 1, 10)
+	assert.ErrorIs(t, err, ErrGenerationInProgress)
+
+	// 其他用户无法取消
+	assert.ErrorIs(t, replicaB.Cancel(context.Background(), 2, 10), ErrNoActiveGeneration)
+
+	// 在另一个实例上取消
+	assert.NoError(t, replicaB.Cancel(context.Background(), 1, 10))
+	select {
+	case <-ctx.Done():
+		assert.ErrorIs(t, context.Cause(ctx), ErrGenerationCancelled)
+	case <-time.After(3 * time.Second):
+		t.Fatal("生成未被取消")
+	}
+
+	// 结束后可以再次开始
+	done()
+	_, done, err = replicaB.Start(context.Background(), 1, 10)
+	assert.NoError(t, err)
+	done()
+}
+
+func TestCancelGenerationKeepsPartialAnswer(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}))
+
+	// 推送一个片段后阻塞，直到生成被取消
+	reader, writer := schema.Pipe[*schema.Message](1)
+	writer.Send(schema.AssistantMessage("partial", nil), nil)
+	defer writer.Close()
+
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(reader, nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, NewGenerationRegistry(newMemoryRedis()), nil, nil)
+
+	conversation := model.Conversation{UserID: 1}
+	db.Create(&conversation)
+
+	var deltas []string
+	cancelled := make(chan error, 1)
+	opts := SendOptions{OnEvent: func(event ChatEvent) {
+		if event.Type != "delta" {
+			return
+		}
+		deltas = append(deltas, event.Data.(string))
+		cancelled <- chatService.CancelGeneration(context.Background(), 1, conversation.ID)
+	}}
+	message := &model.ChatMessage{UserID: 1, ConversationID: conversation.ID, Content: "research"}
+	response, err := chatService.SendMessage(context.Background(), message, opts)
+	assert.NoError(t, err)
+	assert.NoError(t, <-cancelled)
+	assert.Equal(t, []string{"partial"}, deltas)
+	assert.Equal(t, model.MessageStatusCancelled, response["status"])
+
+	reply := response["reply"].(*model.ChatMessage)
+	var saved model.ChatMessage
+	assert.NoError(t, db.First(&saved, reply.ID).Error)
+	assert.Equal(t, "partial", saved.Content)
+	assert.Equal(t, model.MessageStatusCancelled, saved.Status)
+
+	// 生成结束后没有可取消的生成
+	assert.ErrorIs(t, chatService.CancelGeneration(context.Background(), 1, conversation.ID), ErrNoActiveGeneration)
+}
+
+func TestGenerationInProgressKeepsNoMessage(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}))
+	generations := NewGenerationRegistry(newMemoryRedis())
+	chatService := NewChatService(db, new(MockAgent), nil, nil, nil, generations, nil, nil)
+
+	conversation := model.Conversation{UserID: 1}
+	db.Create(&conversation)
+	question := model.ChatMessage{UserID: 1, ConversationID: conversation.ID, Role: string(schema.User), Content: "first"}
+	db.Create(&question)
+
+	_, done, err := generations.Start(context.Background(), 1, conversation.ID)
+	assert.NoError(t, err)
+	defer done()
+
+	// 会话正在生成时不保存新消息和编辑后的消息
+	_, err = chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, ConversationID: conversation.ID, Content: "second"}, SendOptions{})
+	assert.ErrorIs(t, err, ErrGenerationInProgress)
+	_, err = chatService.EditMessage(context.Background(), 1, question.ID, "edited", SendOptions{})
+	assert.ErrorIs(t, err, ErrGenerationInProgress)
+	var count int64
+	db.Model(&model.ChatMessage{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/resource/redis"
+)
+
+const (
+	// loginFailureWindow 登录失败计数的统计窗口
+	loginFailureWindow = 15 * time.Minute
+	// loginMaxFailuresPerEmail 同一账户在窗口内允许的失败次数
+	loginMaxFailuresPerEmail = 5
+	// loginMaxFailuresPerIP 同一IP在窗口内允许的失败次数
+	loginMaxFailuresPerIP = 20
+	// lockoutBase 首次锁定的时长，之后每次锁定翻倍
+	lockoutBase = time.Minute
+	// lockoutMax 单次锁定的最长时长
+	lockoutMax = time.Hour
+	// lockoutMemory 锁定次数的保留时间，超过后锁定时长重新计算
+	lockoutMemory = 24 * time.Hour
+
+	// verificationCooldown 同一邮箱两次发送验证码的最小间隔
+	verificationCooldown = time.Minute
+	// verificationSendWindow 验证码发送次数的统计窗口
+	verificationSendWindow = time.Hour
+	// verificationMaxSendsPerEmail 同一邮箱在窗口内最多发送的验证码数
+	verificationMaxSendsPerEmail = 5
+	// verificationMaxSendsPerIP 同一IP在窗口内最多发送的验证码数
+	verificationMaxSendsPerIP = 20
+)
+
+// TooManyAttemptsError 尝试过于频繁，需等待RetryAfter后重试
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("尝试次数过多，请在%d秒后重试", int(e.RetryAfter.Seconds())+1)
+}
+
+// IsTooManyAttempts 判断错误是否为尝试过于频繁
+func IsTooManyAttempts(err error) (*TooManyAttemptsError, bool) {
+	var attemptsErr *TooManyAttemptsError
+	if errors.As(err, &attemptsErr) {
+		return attemptsErr, true
+	}
+	return nil, false
+}
+
+// AttemptGuard 基于Redis计数的防暴力破解保护，ip为空时只按邮箱限制
+type AttemptGuard interface {
+	// CheckLogin 账户或IP处于锁定期时返回TooManyAttemptsError
+	CheckLogin(ctx context.Context, email, ip string) error
+	// LoginFailed 记录一次登录失败，达到阈值后锁定，锁定时长随锁定次数翻倍
+	LoginFailed(ctx context.Context, email, ip string)
+	// LoginSucceeded 清除账户的失败记录
+	LoginSucceeded(ctx context.Context, email string)
+	// AllowSend 检查验证码发送频率，允许时记录一次发送
+	AllowSend(ctx context.Context, email, ip string) error
+}
+
+type attemptGuard struct {
+	redis redis.RedisClient
+}
+
+// NewAttemptGuard 创建防暴力破解保护实例
+func NewAttemptGuard(redisClient redis.RedisClient) AttemptGuard {
+	return &attemptGuard{redis: redisClient}
+}
+
+// attemptScope 一个计数维度
+type attemptScope struct {
+	name  string
+	value string
+	max   int64
+}
+
+func loginScopes(email, ip string) []attemptScope {
+	scopes := []attemptScope{{name: "email", value: normalizeEmail(email), max: loginMaxFailuresPerEmail}}
+	if ip != "" {
+		scopes = append(scopes, attemptScope{name: "ip", value: ip, max: loginMaxFailuresPerIP})
+	}
+	return scopes
+}
+
+func (g *attemptGuard) CheckLogin(ctx context.Context, email, ip string) error {
+	for _, scope := range loginScopes(email, ip) {
+		if ttl, err := g.redis.TTL(ctx, lockKey(scope)); err == nil && ttl > 0 {
+			return &TooManyAttemptsError{RetryAfter: ttl}
+		}
+	}
+	return nil
+}
+
+func (g *attemptGuard) LoginFailed(ctx context.Context, email, ip string) {
+	for _, scope := range loginScopes(email, ip) {
+		failures, err := g.count(ctx, failuresKey(scope), loginFailureWindow)
+		if err != nil || failures < scope.max {
+			continue
+		}
+		lockouts, err := g.count(ctx, lockoutsKey(scope), lockoutMemory)
+		if err != nil {
+			continue
+		}
+		duration := lockoutMax
+		if lockouts <= 6 {
+			duration = min(lockoutBase<<(lockouts-1), lockoutMax)
+		}
+		_ = g.redis.Set(ctx, lockKey(scope), 1, duration)
+		_ = g.redis.Del(ctx, failuresKey(scope))
+	}
+}
+
+func (g *attemptGuard) LoginSucceeded(ctx context.Context, email string) {
+	scope := attemptScope{name: "email", value: normalizeEmail(email)}
+	_ = g.redis.Del(ctx, failuresKey(scope))
+	_ = g.redis.Del(ctx, lockoutsKey(scope))
+}
+
+func (g *attemptGuard) AllowSend(ctx context.Context, email, ip string) error {
+	email = normalizeEmail(email)
+	cooldownKey := fmt.Sprintf("verification_cooldown:%s", email)
+	ttl, err := g.redis.TTL(ctx, cooldownKey)
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return &TooManyAttemptsError{RetryAfter: ttl}
+	}
+
+	// 先按IP计数，被IP限制拒绝的请求不占用目标邮箱的额度
+	var scopes []attemptScope
+	if ip != "" {
+		scopes = append(scopes, attemptScope{name: "ip", value: ip, max: verificationMaxSendsPerIP})
+	}
+	scopes = append(scopes, attemptScope{name: "email", value: email, max: verificationMaxSendsPerEmail})
+	for _, scope := range scopes {
+		key := fmt.Sprintf("verification_sends:%s:%s", scope.name, scope.value)
+		sends, err := g.count(ctx, key, verificationSendWindow)
+		if err != nil {
+			return err
+		}
+		if sends > scope.max {
+			return g.retryAfter(ctx, key)
+		}
+	}
+	return g.redis.Set(ctx, cooldownKey, 1, verificationCooldown)
+}
+
+// count 计数加一，首次计数时设置过期时间
+func (g *attemptGuard) count(ctx context.Context, key string, window time.Duration) (int64, error) {
+	n, err := g.redis.IncrBy(ctx, key, 1)
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := g.redis.Expire(ctx, key, window); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// retryAfter 以计数窗口的剩余时间作为重试等待时间
+func (g *attemptGuard) retryAfter(ctx context.Context, key string) error {
+	ttl, err := g.redis.TTL(ctx, key)
+	if err != nil || ttl < 0 {
+		ttl = verificationSendWindow
+	}
+	return &TooManyAttemptsError{RetryAfter: ttl}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func failuresKey(scope attemptScope) string {
+	return fmt.Sprintf("login_failures:%s:%s", scope.name, scope.value)
+}
+
+func lockoutsKey(scope attemptScope) string {
+	return fmt.Sprintf("login_lockouts:%s:%s", scope.name, scope.value)
+}
+
+func lockKey(scope attemptScope) string {
+	return fmt.Sprintf("login_lock:%s:%s", scope.name, scope.value)
+}
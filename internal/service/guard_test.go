@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLockoutIsProgressive(t *testing.T) {
+	redisClient := newMemoryRedis()
+	guard := NewAttemptGuard(redisClient)
+	ctx := context.Background()
+
+	for i := 0; i < loginMaxFailuresPerEmail; i++ {
+		assert.NoError(t, guard.CheckLogin(ctx, "alice@example.com", "10.0.0.1"))
+		guard.LoginFailed(ctx, "Alice@Example.com ", "10.0.0.1")
+	}
+	err := guard.CheckLogin(ctx, "alice@example.com", "10.0.0.2")
+	attemptsErr, ok := IsTooManyAttempts(err)
+	assert.True(t, ok)
+	assert.InDelta(t, lockoutBase.Seconds(), attemptsErr.RetryAfter.Seconds(), 1)
+
+	// 其他账户不受影响
+	assert.NoError(t, guard.CheckLogin(ctx, "bob@example.com", "10.0.0.1"))
+
+	// 锁定结束后再次达到阈值，锁定时长翻倍
+	assert.NoError(t, redisClient.Del(ctx, "login_lock:email:alice@example.com"))
+	for i := 0; i < loginMaxFailuresPerEmail; i++ {
+		guard.LoginFailed(ctx, "alice@example.com", "10.0.0.3")
+	}
+	attemptsErr, ok = IsTooManyAttempts(guard.CheckLogin(ctx, "alice@example.com", ""))
+	assert.True(t, ok)
+	assert.InDelta(t, (2 * lockoutBase).Seconds(), attemptsErr.RetryAfter.Seconds(), 1)
+
+	// 成功登录后重新计数
+	assert.NoError(t, redisClient.Del(ctx, "login_lock:email:alice@example.com"))
+	guard.LoginFailed(ctx, "alice@example.com", "")
+	guard.LoginSucceeded(ctx, "alice@example.com")
+	for i := 0; i < loginMaxFailuresPerEmail-1; i++ {
+		guard.LoginFailed(ctx, "alice@example.com", "")
+	}
+	assert.NoError(t, guard.CheckLogin(ctx, "alice@example.com", ""))
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	guard := NewAttemptGuard(newMemoryRedis())
+	ctx := context.Background()
+
+	// 同一IP尝试大量不同账户
+	for i := 0; i < loginMaxFailuresPerIP; i++ {
+		guard.LoginFailed(ctx, fmt.Sprintf("user%d@example.com", i), "10.0.0.1")
+	}
+	_, ok := IsTooManyAttempts(guard.CheckLogin(ctx, "new@example.com", "10.0.0.1"))
+	assert.True(t, ok)
+	assert.NoError(t, guard.CheckLogin(ctx, "new@example.com", "10.0.0.2"))
+}
+
+func TestVerificationCodeLimits(t *testing.T) {
+	tm, err := template.NewTemplateManager()
+	assert.NoError(t, err)
+	redisClient := newMemoryRedis()
+	emails := make(capturedEmail, 10)
+	verification := NewVerificationService(redisClient, emails, tm, NewAttemptGuard(redisClient))
+	ctx := context.Background()
+
+	assert.NoError(t, verification.SendVerificationCode("alice@example.com", "10.0.0.1"))
+	assert.Regexp(t, regexp.MustCompile(`class="code">\d{6}<`), <-emails)
+
+	// 冷却期内不能重复发送
+	err = verification.SendVerificationCode("alice@example.com", "10.0.0.1")
+	attemptsErr, ok := IsTooManyAttempts(err)
+	assert.True(t, ok)
+	assert.True(t, attemptsErr.RetryAfter > 0 && attemptsErr.RetryAfter <= verificationCooldown)
+
+	// 输错次数达到上限后验证码作废，之后正确的验证码也无法使用
+	code, _ := redisClient.Get(ctx, "verification_code:alice@example.com")
+	for i := 0; i < verificationMaxAttempts-1; i++ {
+		assert.ErrorIs(t, verification.VerifyCode("alice@example.com", "wrong"), ErrVerificationCodeMismatch)
+	}
+	assert.ErrorIs(t, verification.VerifyCode("alice@example.com", "wrong"), ErrVerificationCodeExhausted)
+	assert.ErrorIs(t, verification.VerifyCode("alice@example.com", code), ErrVerificationCodeExpired)
+
+	// 每小时发送次数有上限
+	for i := 1; i < verificationMaxSendsPerEmail; i++ {
+		assert.NoError(t, redisClient.Del(ctx, "verification_cooldown:alice@example.com"))
+		assert.NoError(t, verification.SendVerificationCode("alice@example.com", ""))
+		<-emails
+	}
+	assert.NoError(t, redisClient.Del(ctx, "verification_cooldown:alice@example.com"))
+	attemptsErr, ok = IsTooManyAttempts(verification.SendVerificationCode("alice@example.com", ""))
+	assert.True(t, ok)
+	assert.True(t, attemptsErr.RetryAfter > verificationCooldown && attemptsErr.RetryAfter <= time.Hour)
+}
+
+func TestVerificationSendLimitPerIP(t *testing.T) {
+	tm, err := template.NewTemplateManager()
+	assert.NoError(t, err)
+	redisClient := newMemoryRedis()
+	emails := make(capturedEmail, verificationMaxSendsPerIP+1)
+	verification := NewVerificationService(redisClient, emails, tm, NewAttemptGuard(redisClient))
+
+	for i := 0; i < verificationMaxSendsPerIP; i++ {
+		assert.NoError(t, verification.SendVerificationCode(fmt.Sprintf("user%d@example.com", i), "10.0.0.1"))
+	}
+	_, ok := IsTooManyAttempts(verification.SendVerificationCode("another@example.com", "10.0.0.1"))
+	assert.True(t, ok)
+	assert.NoError(t, verification.SendVerificationCode("another@example.com", "10.0.0.2"))
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"gorm.io/gorm"
+)
+
+// 支持的导入格式
+const (
+	ImportChatGPT = "chatgpt" // ChatGPT导出的conversations.json
+	ImportJSONL   = "jsonl"   // 每行一条role/content消息
+)
+
+const (
+	// chatGPTMaxNodes 单个ChatGPT会话中最多处理的节点数
+	chatGPTMaxNodes = 100000
+	// chatGPTMaxDepth 单个ChatGPT会话消息树的最大深度
+	chatGPTMaxDepth = 10000
+)
+
+var ErrImportJobNotFound = errors.New("导入任务不存在")
+
+type ImportService interface {
+	// Start 创建导入任务并在后台执行，format为空时根据内容自动识别
+	Start(userID uint, format string, data []byte) (*model.ImportJob, error)
+	// GetJob 查询导入任务进度
+	GetJob(userID, jobID uint) (*model.ImportJob, error)
+	// FailInterrupted 将服务重启前未完成的任务标记为失败，在启动时调用，返回标记的任务数
+	FailInterrupted() (int, error)
+}
+
+type importService struct {
+	db *gorm.DB
+}
+
+// NewImportService 创建导入服务实例
+func NewImportService(db *gorm.DB) ImportService {
+	return &importService{db: db}
+}
+
+// importedConversation 解析后待导入的会话，消息按父消息在前的顺序排列
+type importedConversation struct {
+	Title     string
+	CreatedAt time.Time
+	Messages  []importedMessage
+	Current   string // 当前分支末端消息的key，为空时取最后一条
+}
+
+// importedMessage 解析后待导入的消息，key仅在单个会话内唯一
+type importedMessage struct {
+	Key       string
+	ParentKey string
+	Role      string
+	Content   string
+	CreatedAt time.Time
+}
+
+func (s *importService) Start(userID uint, format string, data []byte) (*model.ImportJob, error) {
+	if format == "" {
+		format = detectImportFormat(data)
+	}
+	if format != ImportChatGPT && format != ImportJSONL {
+		return nil, errors.New("不支持的导入格式")
+	}
+
+	job := &model.ImportJob{UserID: userID, Format: format, Status: model.ImportPending}
+	if result := s.db.Create(job); result.Error != nil {
+		return nil, result.Error
+	}
+
+	go s.run(job.ID, userID, format, data)
+	return job, nil
+}
+
+func (s *importService) GetJob(userID, jobID uint) (*model.ImportJob, error) {
+	var job model.ImportJob
+	if result := s.db.Where("id = ? AND user_id = ?", jobID, userID).First(&job); result.Error != nil {
+		return nil, ErrImportJobNotFound
+	}
+	return &job, nil
+}
+
+func (s *importService) FailInterrupted() (int, error) {
+	result := s.db.Model(&model.ImportJob{}).
+		Where("status IN ?", []string{model.ImportPending, model.ImportRunning}).
+		Updates(map[string]interface{}{"status": model.ImportFailed, "error": "服务重启导致导入中断，请重新导入"})
+	return int(result.RowsAffected), result.Error
+}
+
+// run 解析并逐个导入会话，每处理完一个会话更新一次进度
+func (s *importService) run(jobID, userID uint, format string, data []byte) {
+	job := &model.ImportJob{ID: jobID}
+	fail := func(err error) {
+		log.Printf("导入任务%d失败: %v", jobID, err)
+		s.db.Model(job).Updates(map[string]interface{}{"status": model.ImportFailed, "error": err.Error()})
+	}
+
+	var conversations []importedConversation
+	var err error
+	if format == ImportChatGPT {
+		conversations, err = parseChatGPTExport(data)
+	} else {
+		conversations, err = parseJSONL(data)
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	s.db.Model(job).Updates(map[string]interface{}{"status": model.ImportRunning, "total": len(conversations)})
+
+	var imported, messages int
+	for i, conversation := range conversations {
+		count, err := s.importConversation(userID, conversation)
+		if err != nil {
+			fail(fmt.Errorf("第%d个会话导入失败: %v", i+1, err))
+			return
+		}
+		if count > 0 {
+			imported++
+			messages += count
+		}
+		s.db.Model(job).Updates(map[string]interface{}{"processed": i + 1, "imported": imported, "messages": messages})
+	}
+	s.db.Model(job).Update("status", model.ImportCompleted)
+}
+
+// importConversation 在事务中保存会话及其消息树，返回导入的消息数
+func (s *importService) importConversation(userID uint, imported importedConversation) (int, error) {
+	if len(imported.Messages) == 0 {
+		return 0, nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		conversation := model.Conversation{
+			UserID:    userID,
+			Title:     truncate(strings.TrimSpace(imported.Title), 200),
+			CreatedAt: imported.CreatedAt,
+		}
+		if result := tx.Create(&conversation); result.Error != nil {
+			return result.Error
+		}
+
+		ids := make(map[string]uint, len(imported.Messages))
+		var lastID uint
+		for _, message := range imported.Messages {
+			record := model.ChatMessage{
+				UserID:         userID,
+				ConversationID: conversation.ID,
+				Content:        message.Content,
+				Role:           message.Role,
+				Status:         model.MessageStatusCompleted,
+				CreatedAt:      message.CreatedAt,
+			}
+			if parentID, ok := ids[message.ParentKey]; ok {
+				record.ParentID = &parentID
+			}
+			if result := tx.Create(&record); result.Error != nil {
+				return result.Error
+			}
+			ids[message.Key] = record.ID
+			lastID = record.ID
+		}
+
+		currentID, ok := ids[imported.Current]
+		if !ok {
+			currentID = lastID
+		}
+		return tx.Model(&conversation).Update("current_message_id", currentID).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(imported.Messages), nil
+}
+
+// detectImportFormat 根据首个非空字符识别格式，JSON数组为ChatGPT导出，否则按JSONL处理
+func detectImportFormat(data []byte) string {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return ImportChatGPT
+	}
+	return ImportJSONL
+}
+
+// chatGPTConversation ChatGPT导出中的会话，消息以树的形式保存在mapping中
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	ID       string          `json:"id"`
+	Message  *chatGPTMessage `json:"message"`
+	Parent   *string         `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+}
+
+// parseChatGPTExport 解析ChatGPT的conversations.json，保留分支结构。
+// 系统消息、工具消息和非文本内容被跳过，其子消息挂到最近的已导入祖先上
+func parseChatGPTExport(data []byte) ([]importedConversation, error) {
+	var exported []chatGPTConversation
+	if err := json.Unmarshal(data, &exported); err != nil {
+		return nil, fmt.Errorf("无法解析ChatGPT导出文件: %v", err)
+	}
+
+	conversations := make([]importedConversation, 0, len(exported))
+	for _, source := range exported {
+		conversation := importedConversation{
+			Title:     source.Title,
+			CreatedAt: unixTime(source.CreateTime),
+		}
+
+		messages, err := walkChatGPTMapping(source.Mapping, conversation.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("会话%q: %v", source.Title, err)
+		}
+		conversation.Messages = messages
+
+		// 当前节点可能是被跳过的消息，向上找到最近的已导入消息
+		keys := make(map[string]bool, len(conversation.Messages))
+		for _, message := range conversation.Messages {
+			keys[message.Key] = true
+		}
+		// 父节点可能成环，最多向上查找len(mapping)次
+		for id, steps := source.CurrentNode, 0; id != "" && steps <= len(source.Mapping); steps++ {
+			if keys[id] {
+				conversation.Current = id
+				break
+			}
+			node, ok := source.Mapping[id]
+			if !ok || node.Parent == nil {
+				break
+			}
+			id = *node.Parent
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, nil
+}
+
+// walkChatGPTMapping 从根节点按深度优先遍历消息树，父消息排在子消息之前。
+// 每个节点只访问一次，因此成环或被多个父节点引用的节点不会重复导入；
+// 节点数或深度超过上限时返回错误
+func walkChatGPTMapping(mapping map[string]chatGPTNode, createdAt time.Time) ([]importedMessage, error) {
+	type pending struct {
+		id        string
+		parentKey string
+		depth     int
+	}
+	var stack []pending
+	for id, node := range mapping {
+		if node.Parent == nil || *node.Parent == "" {
+			stack = append(stack, pending{id: id})
+		} else if _, ok := mapping[*node.Parent]; !ok {
+			stack = append(stack, pending{id: id})
+		}
+	}
+
+	var messages []importedMessage
+	visited := make(map[string]bool)
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node, ok := mapping[current.id]
+		if !ok || visited[current.id] {
+			continue
+		}
+		visited[current.id] = true
+		if len(visited) > chatGPTMaxNodes {
+			return nil, fmt.Errorf("节点数超过%d", chatGPTMaxNodes)
+		}
+		if current.depth > chatGPTMaxDepth {
+			return nil, fmt.Errorf("消息树深度超过%d", chatGPTMaxDepth)
+		}
+
+		parentKey := current.parentKey
+		if message, ok := chatGPTText(node.Message); ok {
+			message.Key = current.id
+			message.ParentKey = parentKey
+			if message.CreatedAt.IsZero() {
+				message.CreatedAt = createdAt
+			}
+			messages = append(messages, message)
+			parentKey = current.id
+		}
+		// 逆序入栈，保持子节点在导出文件中的顺序
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			if !visited[node.Children[i]] {
+				stack = append(stack, pending{id: node.Children[i], parentKey: parentKey, depth: current.depth + 1})
+			}
+		}
+	}
+	return messages, nil
+}
+
+// chatGPTText 提取用户和助手消息的文本内容
+func chatGPTText(message *chatGPTMessage) (importedMessage, bool) {
+	if message == nil || (message.Author.Role != "user" && message.Author.Role != "assistant") {
+		return importedMessage{}, false
+	}
+	var parts []string
+	for _, raw := range message.Content.Parts {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil && strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return importedMessage{}, false
+	}
+
+	imported := importedMessage{Role: message.Author.Role, Content: strings.Join(parts, "\n")}
+	if message.CreateTime != nil {
+		imported.CreatedAt = unixTime(*message.CreateTime)
+	}
+	return imported, true
+}
+
+// jsonlMessage JSONL中的一行，conversation相同的消息归入同一会话
+type jsonlMessage struct {
+	Conversation string     `json:"conversation"`
+	Title        string     `json:"title"`
+	Role         string     `json:"role"`
+	Content      string     `json:"content"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+// parseJSONL 解析JSONL，每个会话内的消息按出现顺序连成一条分支
+func parseJSONL(data []byte) ([]importedConversation, error) {
+	var conversations []importedConversation
+	index := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	now := time.Now()
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var message jsonlMessage
+		if err := json.Unmarshal(text, &message); err != nil {
+			return nil, fmt.Errorf("第%d行格式错误: %v", line, err)
+		}
+		if message.Role != "user" && message.Role != "assistant" {
+			continue
+		}
+
+		i, ok := index[message.Conversation]
+		if !ok {
+			i = len(conversations)
+			index[message.Conversation] = i
+			conversations = append(conversations, importedConversation{Title: message.Title, CreatedAt: now})
+		}
+		conversation := &conversations[i]
+		if conversation.Title == "" {
+			conversation.Title = message.Title
+		}
+
+		imported := importedMessage{
+			Key:       fmt.Sprint(line),
+			Role:      message.Role,
+			Content:   message.Content,
+			CreatedAt: now,
+		}
+		if message.CreatedAt != nil {
+			imported.CreatedAt = *message.CreatedAt
+		}
+		if n := len(conversation.Messages); n > 0 {
+			imported.ParentKey = conversation.Messages[n-1].Key
+		} else if message.CreatedAt != nil {
+			conversation.CreatedAt = *message.CreatedAt
+		}
+		conversation.Messages = append(conversation.Messages, imported)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// unixTime 将带小数的Unix秒数转换为时间，0时返回当前时间
+func unixTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Now()
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// chatGPTExport 包含系统消息和一次重新生成的ChatGPT导出
+const chatGPTExport = `[{
+  "title": "Go并发",
+  "create_time": 1709280000.5,
+  "current_node": "a2",
+  "mapping": {
+    "root": {"id": "root", "message": null, "parent": null, "children": ["sys"]},
+    "sys": {"id": "sys", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}}, "parent": "root", "children": ["u1"]},
+    "u1": {"id": "u1", "message": {"author": {"role": "user"}, "create_time": 1709280001, "content": {"content_type": "text", "parts": ["什么是goroutine"]}}, "parent": "sys", "children": ["a1", "a2"]},
+    "a1": {"id": "a1", "message": {"author": {"role": "assistant"}, "create_time": 1709280002, "content": {"content_type": "text", "parts": ["旧回答"]}}, "parent": "u1", "children": []},
+    "a2": {"id": "a2", "message": {"author": {"role": "assistant"}, "create_time": 1709280003, "content": {"content_type": "text", "parts": ["新回答"]}}, "parent": "u1", "children": []}
+  }
+}]`
+
+func setupImportService(t *testing.T) (*importService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}, &model.ImportJob{}))
+	return NewImportService(db).(*importService), db
+}
+
+// waitImport 等待后台导入任务结束
+func waitImport(t *testing.T, service ImportService, jobID uint) *model.ImportJob {
+	for i := 0; i < 100; i++ {
+		job, err := service.GetJob(1, jobID)
+		assert.NoError(t, err)
+		if job.Status == model.ImportCompleted || job.Status == model.ImportFailed {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("导入任务未结束")
+	return nil
+}
+
+func TestImportChatGPT(t *testing.T) {
+	importService, db := setupImportService(t)
+
+	job, err := importService.Start(1, "", []byte(chatGPTExport))
+	assert.NoError(t, err)
+	assert.Equal(t, ImportChatGPT, job.Format)
+
+	job = waitImport(t, importService, job.ID)
+	assert.Equal(t, model.ImportCompleted, job.Status)
+	assert.Equal(t, 1, job.Imported)
+	assert.Equal(t, 3, job.Messages)
+
+	// 系统消息被跳过，两个回答是同一问题下的分支，当前分支为新回答
+	var conversation model.Conversation
+	assert.NoError(t, db.Where("user_id = ?", 1).First(&conversation).Error)
+	assert.Equal(t, "Go并发", conversation.Title)
+	var messages []model.ChatMessage
+	db.Where("conversation_id = ?", conversation.ID).Order("id asc").Find(&messages)
+	assert.Len(t, messages, 3)
+	assert.Nil(t, messages[0].ParentID)
+	assert.Equal(t, messages[0].ID, *messages[1].ParentID)
+	assert.Equal(t, messages[0].ID, *messages[2].ParentID)
+	assert.Equal(t, "新回答", messages[2].Content)
+	assert.Equal(t, messages[2].ID, *conversation.CurrentMessageID)
+	assert.Equal(t, int64(1709280003), messages[2].CreatedAt.Unix())
+
+	// 其他用户看不到任务
+	_, err = importService.GetJob(2, job.ID)
+	assert.ErrorIs(t, err, ErrImportJobNotFound)
+}
+
+func TestImportJSONL(t *testing.T) {
+	importService, db := setupImportService(t)
+
+	data := `{"conversation": "a", "title": "第一个", "role": "user", "content": "你好"}
+{"conversation": "b", "role": "user", "content": "hello"}
+{"conversation": "a", "role": "assistant", "content": "你好！"}
+
+{"conversation": "a", "role": "system", "content": "忽略"}`
+	job, err := importService.Start(1, ImportJSONL, []byte(data))
+	assert.NoError(t, err)
+	job = waitImport(t, importService, job.ID)
+	assert.Equal(t, model.ImportCompleted, job.Status)
+	assert.Equal(t, 2, job.Total)
+	assert.Equal(t, 3, job.Messages)
+
+	var conversation model.Conversation
+	db.Where("title = ?", "第一个").First(&conversation)
+	var reply model.ChatMessage
+	db.Where("conversation_id = ? AND role = ?", conversation.ID, "assistant").First(&reply)
+	assert.Equal(t, reply.ID, *conversation.CurrentMessageID)
+	assert.NotNil(t, reply.ParentID)
+
+	// 格式错误时任务失败
+	job, err = importService.Start(1, ImportJSONL, []byte("not json"))
+	assert.NoError(t, err)
+	job = waitImport(t, importService, job.ID)
+	assert.Equal(t, model.ImportFailed, job.Status)
+	assert.Contains(t, job.Error, "第1行")
+}
+
+func TestParseChatGPTMalformedMapping(t *testing.T) {
+	// 节点把自己列为子节点时不会无限递归
+	conversations, err := parseChatGPTExport([]byte(`[{"current_node": "a", "mapping": {
+    "a": {"id": "a", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["hi"]}}, "parent": null, "children": ["a"]}
+  }}]`))
+	assert.NoError(t, err)
+	assert.Len(t, conversations[0].Messages, 1)
+	assert.Equal(t, "a", conversations[0].Current)
+
+	// 被两个父节点引用的子节点只导入一次，当前节点的父节点成环时仍能结束
+	conversations, err = parseChatGPTExport([]byte(`[{"current_node": "x", "mapping": {
+    "u1": {"id": "u1", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["q1"]}}, "parent": null, "children": ["a"]},
+    "u2": {"id": "u2", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["q2"]}}, "parent": null, "children": ["a"]},
+    "a": {"id": "a", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["answer"]}}, "parent": "u1", "children": []},
+    "x": {"id": "x", "message": null, "parent": "y", "children": []},
+    "y": {"id": "y", "message": null, "parent": "x", "children": []}
+  }}]`))
+	assert.NoError(t, err)
+	messages := conversations[0].Messages
+	assert.Len(t, messages, 3)
+	var answers int
+	for i, message := range messages {
+		if message.Key == "a" {
+			answers++
+			assert.True(t, i > 0 && messages[i-1].Key == message.ParentKey)
+		}
+	}
+	assert.Equal(t, 1, answers)
+	assert.Empty(t, conversations[0].Current)
+
+	// 超过深度上限时解析失败
+	var chain strings.Builder
+	chain.WriteString(`[{"mapping": {"n0": {"parent": null, "children": ["n1"]}`)
+	for i := 1; i <= chatGPTMaxDepth+1; i++ {
+		fmt.Fprintf(&chain, `, "n%d": {"parent": "n%d", "children": ["n%d"]}`, i, i-1, i+1)
+	}
+	chain.WriteString(`}}]`)
+	_, err = parseChatGPTExport([]byte(chain.String()))
+	assert.ErrorContains(t, err, "深度")
+}
+
+func TestFailInterruptedImports(t *testing.T) {
+	importService, db := setupImportService(t)
+	db.Create(&model.ImportJob{UserID: 1, Format: ImportJSONL, Status: model.ImportRunning})
+	db.Create(&model.ImportJob{UserID: 1, Format: ImportJSONL, Status: model.ImportCompleted})
+
+	count, err := importService.FailInterrupted()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	job, err := importService.GetJob(1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ImportFailed, job.Status)
+	assert.NotEmpty(t, job.Error)
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/redis"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// totpIssuer 认证器应用中显示的服务名称
+	totpIssuer = "Davlin"
+	// totpEnrollExpire 生成密钥后需在该时间内完成确认
+	totpEnrollExpire = 10 * time.Minute
+	// totpReplayWindow 已使用口令的记录时间，覆盖校验时容忍的全部时间步
+	totpReplayWindow = 2 * time.Minute
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// mfaChallengeExpire 密码校验通过后完成两步验证的时限
+	mfaChallengeExpire = 5 * time.Minute
+	// mfaChallengeMaxAttempts 同一次登录允许输错口令的次数，达到后需重新输入密码
+	mfaChallengeMaxAttempts = 5
+)
+
+var (
+	ErrMFAAlreadyEnabled    = errors.New("两步验证已开启")
+	ErrMFANotEnabled        = errors.New("两步验证未开启")
+	ErrMFAEnrollmentExpired = errors.New("两步验证设置已过期，请重新开始")
+	ErrInvalidMFACode       = errors.New("动态口令或恢复码错误")
+	ErrInvalidMFAChallenge  = errors.New("两步验证已过期，请重新登录")
+)
+
+// MFARequiredError 登录凭据正确但账户开启了两步验证，需使用Token提交动态口令完成登录
+type MFARequiredError struct {
+	Token     string
+	ExpiresIn time.Duration
+}
+
+func (e *MFARequiredError) Error() string {
+	return "需要完成两步验证"
+}
+
+// IsMFARequired 判断登录是否需要两步验证
+func IsMFARequired(err error) (*MFARequiredError, bool) {
+	var mfaErr *MFARequiredError
+	if errors.As(err, &mfaErr) {
+		return mfaErr, true
+	}
+	return nil, false
+}
+
+// TOTPEnrollment 待确认的两步验证密钥
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // 可生成二维码供认证器应用扫描
+}
+
+type MFAService interface {
+	// Enroll 生成待确认的TOTP密钥，确认前不会影响登录
+	Enroll(ctx context.Context, userID uint) (*TOTPEnrollment, error)
+	// Confirm 使用认证器生成的口令确认开启两步验证，返回只展示一次的恢复码
+	Confirm(ctx context.Context, userID uint, code string) ([]string, error)
+	// Disable 校验密码和口令后关闭两步验证并删除恢复码
+	Disable(ctx context.Context, userID uint, password, code string) error
+	// RegenerateRecoveryCodes 校验口令后重新生成恢复码，旧的恢复码全部失效
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error)
+	// Verify 校验动态口令或恢复码，口令和恢复码都只能使用一次
+	Verify(ctx context.Context, user *model.User, code string) error
+	// Challenge 密码校验通过后创建两步验证挑战，返回提交口令时使用的令牌
+	Challenge(ctx context.Context, userID uint) (*MFARequiredError, error)
+	// Redeem 使用挑战令牌和口令完成两步验证，失败次数计入登录保护
+	Redeem(ctx context.Context, token, code, ip string) (*model.User, error)
+}
+
+type mfaService struct {
+	db    *gorm.DB
+	redis redis.RedisClient
+	guard AttemptGuard
+}
+
+// NewMFAService 创建两步验证服务实例
+func NewMFAService(db *gorm.DB, redisClient redis.RedisClient, guard AttemptGuard) MFAService {
+	return &mfaService{db: db, redis: redisClient, guard: guard}
+}
+
+func (s *mfaService) Enroll(ctx context.Context, userID uint) (*TOTPEnrollment, error) {
+	user, err := s.user(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := tools.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %v", err)
+	}
+	if err := s.redis.Set(ctx, pendingTOTPKey(userID), secret, totpEnrollExpire); err != nil {
+		return nil, fmt.Errorf("保存密钥失败: %v", err)
+	}
+	return &TOTPEnrollment{Secret: secret, URI: tools.TOTPURI(totpIssuer, user.Email, secret)}, nil
+}
+
+func (s *mfaService) Confirm(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := s.user(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := s.redis.Get(ctx, pendingTOTPKey(userID))
+	if err != nil {
+		return nil, ErrMFAEnrollmentExpired
+	}
+	if err := s.verifyTOTP(ctx, userID, secret, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	_ = s.redis.Del(ctx, pendingTOTPKey(userID))
+	return codes, nil
+}
+
+func (s *mfaService) Disable(ctx context.Context, userID uint, password, code string) error {
+	user, err := s.user(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	if err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(user).Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	user, err := s.user(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if err := s.Verify(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+func (s *mfaService) Verify(ctx context.Context, user *model.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == 6 {
+		return s.verifyTOTP(ctx, user.ID, user.TOTPSecret, code)
+	}
+
+	// 恢复码通过条件更新标记使用，并发请求中只有一个能成功
+	now := time.Now()
+	result := s.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", &now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *mfaService) Challenge(ctx context.Context, userID uint) (*MFARequiredError, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("生成token失败: %v", err)
+	}
+	if err := s.redis.Set(ctx, challengeKey(hashToken(token)), userID, mfaChallengeExpire); err != nil {
+		return nil, fmt.Errorf("保存两步验证状态失败: %v", err)
+	}
+	return &MFARequiredError{Token: token, ExpiresIn: mfaChallengeExpire}, nil
+}
+
+func (s *mfaService) Redeem(ctx context.Context, token, code, ip string) (*model.User, error) {
+	hash := hashToken(token)
+	value, err := s.redis.Get(ctx, challengeKey(hash))
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	userID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	user, err := s.user(uint(userID))
+	if err != nil || !user.TOTPEnabled {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err := s.guard.CheckLogin(ctx, user.Email, ip); err != nil {
+		return nil, err
+	}
+
+	if err := s.Verify(ctx, user, code); err != nil {
+		if !errors.Is(err, ErrInvalidMFACode) {
+			return nil, err
+		}
+		s.guard.LoginFailed(ctx, user.Email, ip)
+		attemptsKey := fmt.Sprintf("mfa_challenge_attempts:%s", hash)
+		attempts, countErr := s.redis.IncrBy(ctx, attemptsKey, 1)
+		if countErr == nil && attempts == 1 {
+			_ = s.redis.Expire(ctx, attemptsKey, mfaChallengeExpire)
+		}
+		if countErr == nil && attempts >= mfaChallengeMaxAttempts {
+			_ = s.redis.Del(ctx, challengeKey(hash))
+		}
+		return nil, err
+	}
+
+	// 挑战令牌只能使用一次
+	first, err := s.redis.SetNX(ctx, fmt.Sprintf("mfa_challenge_used:%s", hash), 1, mfaChallengeExpire)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		return nil, ErrInvalidMFAChallenge
+	}
+	_ = s.redis.Del(ctx, challengeKey(hash))
+	s.guard.LoginSucceeded(ctx, user.Email)
+	return user, nil
+}
+
+func (s *mfaService) user(userID uint) (*model.User, error) {
+	var user model.User
+	if result := s.db.First(&user, userID); result.Error != nil {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// verifyTOTP 校验动态口令，同一时间步的口令只能使用一次
+func (s *mfaService) verifyTOTP(ctx context.Context, userID uint, secret, code string) error {
+	step, ok := tools.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	first, err := s.redis.SetNX(ctx, fmt.Sprintf("totp_used:%d:%d", userID, step), 1, totpReplayWindow)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes 删除用户的恢复码并生成一组新的，返回明文
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	records := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("生成恢复码失败: %v", err)
+		}
+		raw := hex.EncodeToString(buf)
+		codes[i] = raw[:5] + "-" + raw[5:]
+		records[i] = model.RecoveryCode{UserID: userID, CodeHash: hashToken(raw), CreatedAt: time.Now()}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode 忽略恢复码中的分隔符和大小写
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func pendingTOTPKey(userID uint) string {
+	return fmt.Sprintf("totp_pending:%d", userID)
+}
+
+func challengeKey(hash string) string {
+	return fmt.Sprintf("mfa_challenge:%s", hash)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/stretchr/testify/assert"
+)
+
+// enableTOTP 为用户开启两步验证，返回密钥和恢复码
+func enableTOTP(t *testing.T, users *userService, userID uint) (string, []string) {
+	ctx := context.Background()
+	enrollment, err := users.mfa.Enroll(ctx, userID)
+	assert.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+
+	_, err = users.mfa.Confirm(ctx, userID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	code, err := tools.TOTPCode(enrollment.Secret, tools.TOTPStep(time.Now()))
+	assert.NoError(t, err)
+	recoveryCodes, err := users.mfa.Confirm(ctx, userID, code)
+	assert.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+	return enrollment.Secret, recoveryCodes
+}
+
+func TestMFALogin(t *testing.T) {
+	users, _, _ := setupAccountService(t)
+	secret, recoveryCodes := enableTOTP(t, users, 1)
+
+	_, err := users.mfa.Enroll(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrMFAAlreadyEnabled)
+
+	// 密码正确时返回挑战而不是令牌
+	tokens, err := users.Login("alice@example.com", "password1", "", "")
+	assert.Nil(t, tokens)
+	challenge, ok := IsMFARequired(err)
+	assert.True(t, ok)
+
+	_, err = users.CompleteMFALogin(challenge.Token, "123456", "")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+	_, err = users.CompleteMFALogin("invalid", "123456", "")
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+
+	// 确认时已使用当前时间步的口令，换用下一个时间步
+	code, err := tools.TOTPCode(secret, tools.TOTPStep(time.Now())+1)
+	assert.NoError(t, err)
+	tokens, err = users.CompleteMFALogin(challenge.Token, code, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	// 挑战令牌和口令都只能使用一次
+	_, err = users.CompleteMFALogin(challenge.Token, code, "")
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+	_, err = users.Login("alice@example.com", "password1", "", "")
+	challenge, _ = IsMFARequired(err)
+	_, err = users.CompleteMFALogin(challenge.Token, code, "")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+
+	// 恢复码忽略大小写和分隔符，只能使用一次
+	tokens, err = users.CompleteMFALogin(challenge.Token, " "+recoveryCodes[0]+" ", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	_, err = users.Login("alice@example.com", "password1", "", "")
+	challenge, _ = IsMFARequired(err)
+	_, err = users.CompleteMFALogin(challenge.Token, recoveryCodes[0], "")
+	assert.ErrorIs(t, err, ErrInvalidMFACode)
+}
+
+func TestMFAChallengeAttempts(t *testing.T) {
+	users, _, _ := setupAccountService(t)
+	enableTOTP(t, users, 1)
+
+	_, err := users.Login("alice@example.com", "password1", "", "")
+	challenge, ok := IsMFARequired(err)
+	assert.True(t, ok)
+	for i := 0; i < mfaChallengeMaxAttempts; i++ {
+		_, err = users.CompleteMFALogin(challenge.Token, "000000", "")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	}
+
+	// 挑战作废，口令错误同样计入登录失败，账户被锁定
+	_, err = users.CompleteMFALogin(challenge.Token, "000000", "")
+	assert.ErrorIs(t, err, ErrInvalidMFAChallenge)
+	_, err = users.Login("alice@example.com", "password1", "", "")
+	_, locked := IsTooManyAttempts(err)
+	assert.True(t, locked)
+}
+
+func TestMFADisableAndRegenerate(t *testing.T) {
+	users, _, _ := setupAccountService(t)
+	ctx := context.Background()
+	_, recoveryCodes := enableTOTP(t, users, 1)
+
+	// 重新生成后旧的恢复码失效
+	newCodes, err := users.mfa.RegenerateRecoveryCodes(ctx, 1, recoveryCodes[0])
+	assert.NoError(t, err)
+	assert.NotEqual(t, recoveryCodes, newCodes)
+	assert.ErrorIs(t, users.mfa.Disable(ctx, 1, "password1", recoveryCodes[1]), ErrInvalidMFACode)
+
+	assert.ErrorIs(t, users.mfa.Disable(ctx, 1, "wrong", newCodes[0]), ErrWrongPassword)
+	assert.NoError(t, users.mfa.Disable(ctx, 1, "password1", newCodes[0]))
+	assert.ErrorIs(t, users.mfa.Disable(ctx, 1, "password1", newCodes[1]), ErrMFANotEnabled)
+
+	tokens, err := users.Login("alice@example.com", "password1", "", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
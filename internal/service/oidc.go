@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/oidc"
+	"github.com/davlin-coder/davlin/internal/resource/redis"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// oidcStateExpire 跳转到身份提供方后完成登录的时限
+const oidcStateExpire = 10 * time.Minute
+
+var (
+	ErrOIDCDisabled        = errors.New("未启用单点登录")
+	ErrInvalidOIDCState    = errors.New("单点登录请求无效或已过期，请重新登录")
+	ErrOIDCEmailMissing    = errors.New("身份提供方未返回邮箱")
+	ErrOIDCEmailUnverified = errors.New("身份提供方未验证该邮箱，无法关联已有账户")
+)
+
+// oidcState 发起登录时保存的nonce和PKCE verifier，键为state
+type oidcState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type OIDCService interface {
+	// Enabled 是否配置了身份提供方
+	Enabled() bool
+	// Begin 生成授权地址，返回的state需同时保存在浏览器中，回调时用于确认是同一浏览器发起的登录
+	Begin(ctx context.Context) (authURL, state string, err error)
+	// Complete 处理身份提供方回调，关联或创建用户后签发令牌，开启两步验证的用户返回MFARequiredError
+	Complete(ctx context.Context, state, code string) (*TokenPair, error)
+	// RedirectURL 登录结束后跳转的前端地址，结果放在URL片段中，不会发送到服务器日志
+	RedirectURL(result url.Values) string
+}
+
+type oidcService struct {
+	db       *gorm.DB
+	redis    redis.RedisClient
+	provider oidc.Provider
+	tokens   TokenService
+	mfa      MFAService
+	cfg      config.OIDCConfig
+	webURL   string
+}
+
+// NewOIDCService 创建单点登录服务实例
+func NewOIDCService(db *gorm.DB, redisClient redis.RedisClient, provider oidc.Provider, tokens TokenService, mfa MFAService, cfg *config.Config) OIDCService {
+	return &oidcService{
+		db:       db,
+		redis:    redisClient,
+		provider: provider,
+		tokens:   tokens,
+		mfa:      mfa,
+		cfg:      cfg.OIDC,
+		webURL:   strings.TrimSuffix(cfg.APP.WebURL, "/"),
+	}
+}
+
+func (s *oidcService) Enabled() bool {
+	return s.provider.Enabled()
+}
+
+func (s *oidcService) Begin(ctx context.Context) (string, string, error) {
+	if !s.Enabled() {
+		return "", "", ErrOIDCDisabled
+	}
+	var values [3]string
+	for i := range values {
+		value, err := randomToken(32)
+		if err != nil {
+			return "", "", fmt.Errorf("生成token失败: %v", err)
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	data, err := json.Marshal(oidcState{Nonce: nonce, Verifier: verifier})
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.redis.Set(ctx, oidcStateKey(state), string(data), oidcStateExpire); err != nil {
+		return "", "", fmt.Errorf("保存登录状态失败: %v", err)
+	}
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+func (s *oidcService) Complete(ctx context.Context, state, code string) (*TokenPair, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	value, err := s.redis.Get(ctx, oidcStateKey(state))
+	if err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+	// state只能使用一次
+	first, err := s.redis.SetNX(ctx, fmt.Sprintf("oidc_state_used:%s", state), 1, oidcStateExpire)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		return nil, ErrInvalidOIDCState
+	}
+	_ = s.redis.Del(ctx, oidcStateKey(state))
+	var saved oidcState
+	if err := json.Unmarshal([]byte(value), &saved); err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+
+	rawIDToken, err := s.provider.Exchange(ctx, code, saved.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.provider.VerifyIDToken(ctx, rawIDToken, saved.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.link(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	if user.TOTPEnabled {
+		challenge, err := s.mfa.Challenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, challenge
+	}
+	return startSession(ctx, s.db, s.tokens, user)
+}
+
+func (s *oidcService) RedirectURL(result url.Values) string {
+	return s.webURL + "/oidc/callback#" + result.Encode()
+}
+
+// link 按issuer和subject查找已关联的用户；未关联时按已验证的邮箱关联已有用户，否则创建新用户
+func (s *oidcService) link(claims map[string]interface{}) (*model.User, error) {
+	issuer := claimString(claims, "iss")
+	subject := claimString(claims, "sub")
+
+	var identity model.UserIdentity
+	if err := s.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err == nil {
+		var user model.User
+		if err := s.db.First(&user, identity.UserID).Error; err != nil {
+			return nil, ErrUserNotFound
+		}
+		return &user, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claimString(claims, s.cfg.EmailClaim))
+	if email == "" {
+		return nil, ErrOIDCEmailMissing
+	}
+
+	var user model.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			// 邮箱未经身份提供方验证时关联已有账户，可能导致账户被他人接管
+			if !claimBool(claims, "email_verified") {
+				return ErrOIDCEmailUnverified
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.provision(tx, &user, email, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		return tx.Create(&model.UserIdentity{
+			UserID:    user.ID,
+			Issuer:    issuer,
+			Subject:   subject,
+			Email:     email,
+			CreatedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// provision 为首次单点登录的用户创建账户，密码随机生成，之后可通过重置密码设置
+func (s *oidcService) provision(tx *gorm.DB, user *model.User, email string, claims map[string]interface{}) error {
+	password, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSpace(claimString(claims, s.cfg.UsernameClaim))
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = truncate(base, 40)
+	username := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(&model.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			break
+		}
+		if i > 20 {
+			suffix, err := randomToken(4)
+			if err != nil {
+				return err
+			}
+			username = fmt.Sprintf("%s-%s", base, suffix)
+			break
+		}
+		username = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	*user = model.User{
+		Username:    username,
+		Password:    string(hashedPassword),
+		Email:       email,
+		DisplayName: truncate(strings.TrimSpace(claimString(claims, s.cfg.NameClaim)), 100),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	return tx.Create(user).Error
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// claimBool 部分身份提供方以字符串形式返回布尔claim
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+func oidcStateKey(state string) string {
+	return fmt.Sprintf("oidc_state:%s", state)
+}
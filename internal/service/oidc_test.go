@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProvider 本地的OIDC身份提供方，按预设的claim签发ID令牌
+type fakeProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	p := &fakeProvider{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "fake",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// token 校验授权码、客户端凭据和PKCE verifier后返回ID令牌
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clientID, secret, _ := r.BasicAuth()
+	if r.FormValue("code") != "valid-code" || clientID != "davlin" || secret != "client-secret" ||
+		oidc.PKCEChallenge(r.FormValue("code_verifier")) != p.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, p.claims)
+	token.Header["kid"] = "fake"
+	signed, err := token.SignedString(p.key)
+	assert.NoError(p.t, err)
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "id_token": signed, "token_type": "Bearer"})
+}
+
+// authorize 模拟浏览器在身份提供方完成登录，记录授权请求中的PKCE challenge并准备ID令牌
+func (p *fakeProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	parsed, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+
+	full := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   "davlin",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		full[name] = value
+	}
+	p.mu.Lock()
+	p.challenge = query.Get("code_challenge")
+	p.claims = full
+	p.mu.Unlock()
+	return query.Get("state")
+}
+
+func setupOIDCService(t *testing.T) (OIDCService, *fakeProvider, *userService) {
+	users, db, _ := setupAccountService(t)
+	provider := newFakeProvider(t)
+	cfg := &config.Config{
+		APP: config.APPConfig{WebURL: "https://davlin.example"},
+		OIDC: config.OIDCConfig{
+			Issuer:        provider.server.URL,
+			ClientID:      "davlin",
+			ClientSecret:  "client-secret",
+			RedirectURL:   "https://api.davlin.example/api/v1/auth/oidc/callback",
+			Scopes:        []string{"openid", "email", "profile"},
+			UsernameClaim: "preferred_username",
+			EmailClaim:    "email",
+			NameClaim:     "name",
+		},
+	}
+	redisClient := newMemoryRedis()
+	service := NewOIDCService(db, redisClient, oidc.NewProvider(cfg), users.tokens, users.mfa, cfg)
+	return service, provider, users
+}
+
+// oidcLogin 完成一次单点登录
+func oidcLogin(t *testing.T, service OIDCService, provider *fakeProvider, claims jwt.MapClaims) (*TokenPair, error) {
+	ctx := context.Background()
+	authURL, state, err := service.Begin(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, state, provider.authorize(t, authURL, claims))
+	return service.Complete(ctx, state, "valid-code")
+}
+
+func TestOIDCProvisionAndLink(t *testing.T) {
+	service, provider, users := setupOIDCService(t)
+
+	// 首次登录创建用户，用户名与已有用户冲突时追加序号
+	tokens, err := oidcLogin(t, service, provider, jwt.MapClaims{
+		"sub": "carol-sub", "email": "carol@example.com", "preferred_username": "alice", "name": "Carol",
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	var carol model.User
+	assert.NoError(t, users.db.Where("email = ?", "carol@example.com").First(&carol).Error)
+	assert.Equal(t, "alice-2", carol.Username)
+	assert.Equal(t, "Carol", carol.DisplayName)
+
+	// 再次登录按subject找到同一用户，即使邮箱已变化
+	_, err = oidcLogin(t, service, provider, jwt.MapClaims{"sub": "carol-sub", "email": "carol@new.example"})
+	assert.NoError(t, err)
+	var count int64
+	users.db.Model(&model.User{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+
+	// 已有账户只在邮箱经过验证时关联
+	_, err = oidcLogin(t, service, provider, jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com"})
+	assert.ErrorIs(t, err, ErrOIDCEmailUnverified)
+	_, err = oidcLogin(t, service, provider, jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": true})
+	assert.NoError(t, err)
+	var identity model.UserIdentity
+	assert.NoError(t, users.db.Where("subject = ?", "alice-sub").First(&identity).Error)
+	assert.Equal(t, uint(1), identity.UserID)
+
+	_, err = oidcLogin(t, service, provider, jwt.MapClaims{"sub": "nobody"})
+	assert.ErrorIs(t, err, ErrOIDCEmailMissing)
+}
+
+func TestOIDCRejectsInvalidResponses(t *testing.T) {
+	service, provider, _ := setupOIDCService(t)
+	ctx := context.Background()
+	valid := jwt.MapClaims{"sub": "carol-sub", "email": "carol@example.com"}
+
+	// state只能使用一次
+	authURL, state, err := service.Begin(ctx)
+	assert.NoError(t, err)
+	provider.authorize(t, authURL, valid)
+	_, err = service.Complete(ctx, state, "valid-code")
+	assert.NoError(t, err)
+	_, err = service.Complete(ctx, state, "valid-code")
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+
+	// PKCE verifier与授权请求不匹配时身份提供方拒绝换取令牌
+	authURL, _, err = service.Begin(ctx)
+	assert.NoError(t, err)
+	provider.authorize(t, authURL, valid)
+	_, state, err = service.Begin(ctx)
+	assert.NoError(t, err)
+	_, err = service.Complete(ctx, state, "valid-code")
+	assert.Error(t, err)
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"nonce":    {"sub": "carol-sub", "email": "carol@example.com", "nonce": "other"},
+		"audience": {"sub": "carol-sub", "email": "carol@example.com", "aud": "other-client"},
+		"expired":  {"sub": "carol-sub", "email": "carol@example.com", "exp": time.Now().Add(-time.Hour).Unix()},
+		"issuer":   {"sub": "carol-sub", "email": "carol@example.com", "iss": "https://evil.example"},
+	} {
+		_, err := oidcLogin(t, service, provider, claims)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestOIDCRequiresMFA(t *testing.T) {
+	service, provider, users := setupOIDCService(t)
+	enableTOTP(t, users, 1)
+
+	_, err := oidcLogin(t, service, provider, jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": "true"})
+	_, ok := IsMFARequired(err)
+	assert.True(t, ok)
+}
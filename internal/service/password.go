@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/email"
+	"github.com/davlin-coder/davlin/internal/resource/redis"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// passwordResetExpire 重置链接的有效期
+	passwordResetExpire = 30 * time.Minute
+	// passwordResetCooldown 同一邮箱两次发送重置邮件的最小间隔
+	passwordResetCooldown = time.Minute
+)
+
+var ErrInvalidResetToken = errors.New("重置链接无效或已过期")
+
+type PasswordService interface {
+	// RequestReset 在后台向已注册的邮箱发送重置链接，无论邮箱是否注册都立即返回，避免泄露注册状态
+	RequestReset(email string)
+	// Reset 使用重置令牌设置新密码，并撤销用户的全部登录会话
+	Reset(ctx context.Context, token, password string) error
+}
+
+type passwordService struct {
+	db      *gorm.DB
+	redis   redis.RedisClient
+	emailer email.EmailSender
+	tm      template.TemplateManager
+	tokens  TokenService
+	webURL  string
+}
+
+// NewPasswordService 创建密码重置服务实例
+func NewPasswordService(db *gorm.DB, redisClient redis.RedisClient, emailer email.EmailSender, tm template.TemplateManager, tokens TokenService, cfg *config.Config) PasswordService {
+	return &passwordService{
+		db:      db,
+		redis:   redisClient,
+		emailer: emailer,
+		tm:      tm,
+		tokens:  tokens,
+		webURL:  strings.TrimSuffix(cfg.APP.WebURL, "/"),
+	}
+}
+
+func (s *passwordService) RequestReset(email string) {
+	go func() {
+		if err := s.sendReset(context.Background(), email); err != nil {
+			log.Printf("发送重置密码邮件失败: %v", err)
+		}
+	}()
+}
+
+// sendReset 生成重置令牌并发送邮件，邮箱未注册或处于冷却期时静默跳过
+func (s *passwordService) sendReset(ctx context.Context, address string) error {
+	var user model.User
+	if result := s.db.Where("email = ?", address).First(&user); result.Error != nil {
+		return nil
+	}
+	first, err := s.redis.SetNX(ctx, fmt.Sprintf("password_reset_cooldown:%d", user.ID), 1, passwordResetCooldown)
+	if err != nil || !first {
+		return err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	hash := hashToken(token)
+	if err := s.redis.Set(ctx, resetKey(hash), user.ID, passwordResetExpire); err != nil {
+		return fmt.Errorf("保存重置令牌失败: %v", err)
+	}
+	// 只有最近一次发送的链接有效
+	if err := s.redis.Set(ctx, resetUserKey(user.ID), hash, passwordResetExpire); err != nil {
+		return fmt.Errorf("保存重置令牌失败: %v", err)
+	}
+
+	content, err := s.tm.ExecuteTemplate("password_reset_email", template.PasswordResetEmailData{
+		Username:      user.Username,
+		Link:          s.webURL + "/reset-password?token=" + url.QueryEscape(token),
+		ExpireMinutes: int(passwordResetExpire.Minutes()),
+	})
+	if err != nil {
+		return fmt.Errorf("渲染邮件模板失败: %v", err)
+	}
+	return s.emailer.SendHTMLEmail([]string{user.Email}, "重置密码", content)
+}
+
+func (s *passwordService) Reset(ctx context.Context, token, password string) error {
+	hash := hashToken(token)
+	value, err := s.redis.Get(ctx, resetKey(hash))
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	userID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if latest, err := s.redis.Get(ctx, resetUserKey(uint(userID))); err != nil || latest != hash {
+		return ErrInvalidResetToken
+	}
+	// 令牌只能使用一次，并发请求中只有一个能成功标记
+	first, err := s.redis.SetNX(ctx, fmt.Sprintf("password_reset_used:%s", hash), 1, passwordResetExpire)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return ErrInvalidResetToken
+	}
+	_ = s.redis.Del(ctx, resetKey(hash))
+	_ = s.redis.Del(ctx, resetUserKey(uint(userID)))
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	result := s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":   string(hashedPassword),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidResetToken
+	}
+	return s.tokens.RevokeUser(ctx, uint(userID))
+}
+
+func resetKey(hash string) string {
+	return fmt.Sprintf("password_reset:%s", hash)
+}
+
+func resetUserKey(userID uint) string {
+	return fmt.Sprintf("password_reset_user:%d", userID)
+}
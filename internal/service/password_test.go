@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// capturedEmail 记录发送的邮件而不真正发送
+type capturedEmail chan string
+
+func (c capturedEmail) SendEmail(to []string, subject, body string) error {
+	c <- body
+	return nil
+}
+
+func (c capturedEmail) SendHTMLEmail(to []string, subject, htmlBody string) error {
+	c <- htmlBody
+	return nil
+}
+
+var resetLinkPattern = regexp.MustCompile(`href="([^"]+)"`)
+
+func TestPasswordReset(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.User{}))
+	assert.NoError(t, db.Create(&model.User{Username: "alice", Email: "alice@example.com", Password: "old"}).Error)
+
+	tm, err := template.NewTemplateManager()
+	assert.NoError(t, err)
+	jwt, _ := tools.NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", Expire: 1, AccessExpire: 15}})
+	tokens := NewTokenService(newMemoryRedis(), jwt)
+	emails := make(capturedEmail, 1)
+	cfg := &config.Config{APP: config.APPConfig{WebURL: "https://davlin.example/"}}
+	passwordService := NewPasswordService(db, newMemoryRedis(), emails, tm, tokens, cfg)
+	ctx := context.Background()
+
+	session, err := tokens.Issue(ctx, 1, "alice")
+	assert.NoError(t, err)
+	claims, _ := jwt.ParseToken(session.AccessToken)
+
+	// 未注册的邮箱不发送邮件
+	passwordService.RequestReset("nobody@example.com")
+	passwordService.RequestReset("alice@example.com")
+	var body string
+	select {
+	case body = <-emails:
+	case <-time.After(time.Second):
+		t.Fatal("未发送重置邮件")
+	}
+	match := resetLinkPattern.FindStringSubmatch(body)
+	assert.Len(t, match, 2)
+	link, err := url.Parse(strings.ReplaceAll(match[1], "&amp;", "&"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/reset-password", link.Path)
+	token := link.Query().Get("token")
+	assert.NotEmpty(t, token)
+
+	assert.ErrorIs(t, passwordService.Reset(ctx, "invalid", "new-password"), ErrInvalidResetToken)
+	assert.NoError(t, passwordService.Reset(ctx, token, "new-password"))
+
+	var user model.User
+	assert.NoError(t, db.First(&user, 1).Error)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new-password")))
+
+	// 链接只能使用一次
+	assert.ErrorIs(t, passwordService.Reset(ctx, token, "another-password"), ErrInvalidResetToken)
+
+	// 重置前的会话全部失效，之后的新登录不受影响
+	revoked, err := tokens.IsRevoked(ctx, claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	_, err = tokens.Refresh(ctx, session.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	fresh, err := tokens.Issue(ctx, 1, "alice")
+	assert.NoError(t, err)
+	claims, _ = jwt.ParseToken(fresh.AccessToken)
+	revoked, err = tokens.IsRevoked(ctx, claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/davlin-coder/davlin/internal/resource/agent"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"gorm.io/gorm"
+)
+
+// promptDocumentsLimit 提示词变量中列出的最大文档数
+const promptDocumentsLimit = 50
+
+// PromptVars 渲染系统提示词时可用的变量
+type PromptVars struct {
+	UserName  string   // 用户名
+	Date      string   // 当前日期
+	Locale    string   // 语言区域
+	Documents []string // 会话可检索的文档名称，工作区会话中为工作区知识库中最近更新的文档
+}
+
+// PromptDetail 提示词及其全部版本
+type PromptDetail struct {
+	model.Prompt
+	Versions []model.PromptVersion `json:"versions"`
+}
+
+type PromptService interface {
+	ListPrompts(page pagination.Page) (*pagination.Result[model.Prompt], error)
+	GetPrompt(promptID uint) (*PromptDetail, error)
+	// CreatePrompt 创建提示词及其第一个版本
+	CreatePrompt(prompt *model.Prompt, content string, createdBy uint) error
+	// AddVersion 新增版本并设为生效版本
+	AddVersion(promptID uint, content string, createdBy uint) (*model.PromptVersion, error)
+	// Rollback 将生效版本切换到指定历史版本
+	Rollback(promptID uint, version int) error
+
+	GetInstruction(userID uint) (string, error)
+	SetInstruction(userID uint, content string) error
+
+	// BuildSystemPrompt 渲染会话的系统提示词并附加用户自定义指令，返回内容和使用的版本ID
+	BuildSystemPrompt(userID uint, promptID *uint, vars PromptVars) (string, uint, error)
+}
+
+type promptService struct {
+	db *gorm.DB
+	tm template.TemplateManager
+}
+
+// NewPromptService 创建提示词服务实例
+func NewPromptService(db *gorm.DB, tm template.TemplateManager) PromptService {
+	return &promptService{db: db, tm: tm}
+}
+
+func (s *promptService) ListPrompts(page pagination.Page) (*pagination.Result[model.Prompt], error) {
+	var prompts []model.Prompt
+	result := page.Apply(s.db, "prompts").Find(&prompts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return pagination.NewResult(prompts, page, func(prompt model.Prompt) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: prompt.CreatedAt, ID: prompt.ID}
+	}), nil
+}
+
+func (s *promptService) GetPrompt(promptID uint) (*PromptDetail, error) {
+	var detail PromptDetail
+	if result := s.db.First(&detail.Prompt, promptID); result.Error != nil {
+		return nil, errors.New("提示词不存在")
+	}
+	result := s.db.Where("prompt_id = ?", promptID).Order("version desc").Find(&detail.Versions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &detail, nil
+}
+
+func (s *promptService) CreatePrompt(prompt *model.Prompt, content string, createdBy uint) error {
+	if err := s.validate(content); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		prompt.ActiveVersion = 1
+		if err := tx.Create(prompt).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.PromptVersion{
+			PromptID:  prompt.ID,
+			Version:   1,
+			Content:   content,
+			CreatedBy: createdBy,
+		}).Error
+	})
+}
+
+func (s *promptService) AddVersion(promptID uint, content string, createdBy uint) (*model.PromptVersion, error) {
+	if err := s.validate(content); err != nil {
+		return nil, err
+	}
+
+	version := &model.PromptVersion{PromptID: promptID, Content: content, CreatedBy: createdBy}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var prompt model.Prompt
+		if err := tx.First(&prompt, promptID).Error; err != nil {
+			return errors.New("提示词不存在")
+		}
+		var latest int
+		if err := tx.Model(&model.PromptVersion{}).Where("prompt_id = ?", promptID).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		version.Version = latest + 1
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		return tx.Model(&prompt).Update("active_version", version.Version).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func (s *promptService) Rollback(promptID uint, version int) error {
+	var count int64
+	s.db.Model(&model.PromptVersion{}).Where("prompt_id = ? AND version = ?", promptID, version).Count(&count)
+	if count == 0 {
+		return errors.New("提示词版本不存在")
+	}
+	return s.db.Model(&model.Prompt{}).Where("id = ?", promptID).Update("active_version", version).Error
+}
+
+func (s *promptService) GetInstruction(userID uint) (string, error) {
+	var instruction model.UserInstruction
+	result := s.db.Where("user_id = ?", userID).Limit(1).Find(&instruction)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	return instruction.Content, nil
+}
+
+func (s *promptService) SetInstruction(userID uint, content string) error {
+	if strings.TrimSpace(content) == "" {
+		return s.db.Where("user_id = ?", userID).Delete(&model.UserInstruction{}).Error
+	}
+	return s.db.Save(&model.UserInstruction{UserID: userID, Content: content}).Error
+}
+
+func (s *promptService) BuildSystemPrompt(userID uint, promptID *uint, vars PromptVars) (string, uint, error) {
+	if vars.Date == "" {
+		vars.Date = time.Now().Format("2006-01-02")
+	}
+
+	systemPrompt := agent.DefaultPersona
+	var versionID uint
+	if promptID != nil {
+		var version model.PromptVersion
+		result := s.db.Joins("JOIN prompts ON prompts.id = prompt_versions.prompt_id AND prompts.active_version = prompt_versions.version").
+			Where("prompt_versions.prompt_id = ?", *promptID).First(&version)
+		if result.Error != nil {
+			return "", 0, errors.New("提示词不存在")
+		}
+		rendered, err := s.tm.RenderText(version.Content, vars)
+		if err != nil {
+			return "", 0, fmt.Errorf("渲染提示词失败: %v", err)
+		}
+		systemPrompt = rendered
+		versionID = version.ID
+	}
+
+	instruction, err := s.GetInstruction(userID)
+	if err != nil {
+		return "", 0, err
+	}
+	if instruction != "" {
+		systemPrompt += "\n\nUser's custom instructions:\n" + instruction
+	}
+	return systemPrompt, versionID, nil
+}
+
+// validate 校验提示词模板能否以示例变量渲染
+func (s *promptService) validate(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errors.New("提示词内容不能为空")
+	}
+	if _, err := s.tm.RenderText(content, PromptVars{}); err != nil {
+		return fmt.Errorf("提示词模板无效: %v", err)
+	}
+	return nil
+}
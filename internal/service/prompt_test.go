@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/agent"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupPromptService(t *testing.T) PromptService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.Prompt{}, &model.PromptVersion{}, &model.UserInstruction{}))
+
+	tm, err := template.NewTemplateManager()
+	assert.NoError(t, err)
+	return NewPromptService(db, tm)
+}
+
+func TestPromptVersioning(t *testing.T) {
+	promptService := setupPromptService(t)
+	vars := PromptVars{UserName: "alice", Date: "2025-03-01", Locale: "zh-CN"}
+
+	prompt := &model.Prompt{Name: "researcher"}
+	assert.NoError(t, promptService.CreatePrompt(prompt, "You help {{.UserName}} on {{.Date}} in {{.Locale}}.", 1))
+
+	content, versionID, err := promptService.BuildSystemPrompt(1, &prompt.ID, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "You help alice on 2025-03-01 in zh-CN.", content)
+	assert.NotZero(t, versionID)
+
+	// 新版本立即生效
+	version, err := promptService.AddVersion(prompt.ID, "Be terse & precise.", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version.Version)
+	content, versionID, err = promptService.BuildSystemPrompt(1, &prompt.ID, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "Be terse & precise.", content)
+	assert.Equal(t, version.ID, versionID)
+
+	// 回滚到第一个版本
+	assert.NoError(t, promptService.Rollback(prompt.ID, 1))
+	content, _, err = promptService.BuildSystemPrompt(1, &prompt.ID, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "You help alice on 2025-03-01 in zh-CN.", content)
+
+	assert.Error(t, promptService.Rollback(prompt.ID, 5))
+
+	// 附加文档以列表形式传入模板
+	_, err = promptService.AddVersion(prompt.ID, "Documents:{{range .Documents}} {{.}}{{else}} none{{end}}", 1)
+	assert.NoError(t, err)
+	content, _, err = promptService.BuildSystemPrompt(1, &prompt.ID, PromptVars{Documents: []string{"a.md", "b.txt"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Documents: a.md b.txt", content)
+	content, _, err = promptService.BuildSystemPrompt(1, &prompt.ID, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "Documents: none", content)
+
+	detail, err := promptService.GetPrompt(prompt.ID)
+	assert.NoError(t, err)
+	assert.Len(t, detail.Versions, 3)
+}
+
+func TestPromptInvalidTemplate(t *testing.T) {
+	promptService := setupPromptService(t)
+
+	err := promptService.CreatePrompt(&model.Prompt{Name: "broken"}, "Hello {{.UserName", 1)
+	assert.Error(t, err)
+}
+
+func TestUserInstruction(t *testing.T) {
+	promptService := setupPromptService(t)
+
+	// 未选择提示词时使用默认人设
+	content, versionID, err := promptService.BuildSystemPrompt(1, nil, PromptVars{})
+	assert.NoError(t, err)
+	assert.Equal(t, agent.DefaultPersona, content)
+	assert.Zero(t, versionID)
+
+	assert.NoError(t, promptService.SetInstruction(1, "Answer in Chinese."))
+	content, _, err = promptService.BuildSystemPrompt(1, nil, PromptVars{})
+	assert.NoError(t, err)
+	assert.Contains(t, content, agent.DefaultPersona)
+	assert.Contains(t, content, "Answer in Chinese.")
+
+	// 清空自定义指令
+	assert.NoError(t, promptService.SetInstruction(1, ""))
+	instruction, err := promptService.GetInstruction(1)
+	assert.NoError(t, err)
+	assert.Empty(t, instruction)
+}
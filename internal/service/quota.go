@@ -0,0 +1,379 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/redis"
+	"gorm.io/gorm"
+)
+
+// concurrentKeyTTL 并发计数的兜底过期时间，防止进程异常退出后计数无法释放
+const concurrentKeyTTL = time.Hour
+
+// QuotaExceededError 配额超限错误，包含超限项和重置时间
+type QuotaExceededError struct {
+	Limit   string    // 超限的配额项
+	Max     int       // 配额上限
+	ResetAt time.Time // 配额重置时间，并发配额为零值
+}
+
+func (e *QuotaExceededError) Error() string {
+	switch e.Limit {
+	case "messages_per_day":
+		return fmt.Sprintf("已达到每日消息上限(%d)", e.Max)
+	case "tokens_per_month":
+		return fmt.Sprintf("已达到每月token上限(%d)", e.Max)
+	default:
+		return fmt.Sprintf("同时进行的任务数已达上限(%d)", e.Max)
+	}
+}
+
+type QuotaService interface {
+	// Acquire 在调用模型前检查并占用用户配额，workspaceID不为0时同时占用工作区配额，
+	// 生成结束后必须调用返回的release；任一配额超限时已占用的配额全部退回
+	Acquire(ctx context.Context, userID, workspaceID uint) (release func(), err error)
+	// AddTokens 累加用户本月已用token，须在保存用量记录之后调用
+	AddTokens(ctx context.Context, userID uint, tokens int) error
+	// GetLimits 获取用户生效的配额
+	GetLimits(userID uint) (config.QuotaLimits, error)
+	// GetOverride 获取用户级配额，未设置时返回只有UserID的记录
+	GetOverride(userID uint) (*model.UserQuota, error)
+	// SetOverride 设置用户级配额，字段全部为空时恢复默认配额
+	SetOverride(override *model.UserQuota) error
+	// ResetUsage 清零用户当天的消息数和本月的token用量，用量记录保持不变
+	ResetUsage(ctx context.Context, userID uint) error
+	// AddWorkspaceTokens 累加工作区本月已用token，须在保存用量记录之后调用
+	AddWorkspaceTokens(ctx context.Context, workspaceID uint, tokens int) error
+	// GetWorkspaceLimits 获取工作区生效的配额
+	GetWorkspaceLimits(workspaceID uint) (config.QuotaLimits, error)
+	// GetWorkspaceOverride 获取工作区级配额，未设置时返回只有WorkspaceID的记录
+	GetWorkspaceOverride(workspaceID uint) (*model.WorkspaceQuota, error)
+	// SetWorkspaceOverride 设置工作区级配额，字段全部为空时恢复默认配额
+	SetWorkspaceOverride(override *model.WorkspaceQuota) error
+}
+
+type quotaService struct {
+	db                *gorm.DB
+	redisClient       redis.RedisClient
+	defaults          config.QuotaLimits
+	roles             map[string]config.RoleQuota
+	workspaceDefaults config.QuotaLimits
+	now               func() time.Time
+}
+
+// NewQuotaService 创建配额服务实例
+func NewQuotaService(db *gorm.DB, redisClient redis.RedisClient, cfg *config.Config) QuotaService {
+	return &quotaService{
+		db:                db,
+		redisClient:       redisClient,
+		defaults:          cfg.Quota.Default,
+		roles:             cfg.Quota.Roles,
+		workspaceDefaults: cfg.Quota.Workspace,
+		now:               time.Now,
+	}
+}
+
+func (s *quotaService) GetLimits(userID uint) (config.QuotaLimits, error) {
+	limits := s.defaults
+
+	// 依次应用角色配额和用户级配额
+	if len(s.roles) > 0 {
+		var role string
+		if err := s.db.Model(&model.User{}).Where("id = ?", userID).Limit(1).Pluck("role", &role).Error; err != nil {
+			return limits, err
+		}
+		if quota, ok := s.roles[role]; ok {
+			if quota.MessagesPerDay != nil {
+				limits.MessagesPerDay = *quota.MessagesPerDay
+			}
+			if quota.TokensPerMonth != nil {
+				limits.TokensPerMonth = *quota.TokensPerMonth
+			}
+			if quota.ConcurrentJobs != nil {
+				limits.ConcurrentJobs = *quota.ConcurrentJobs
+			}
+		}
+	}
+
+	var override model.UserQuota
+	result := s.db.Where("user_id = ?", userID).Limit(1).Find(&override)
+	if result.Error != nil {
+		return limits, result.Error
+	}
+	if override.MessagesPerDay != nil {
+		limits.MessagesPerDay = *override.MessagesPerDay
+	}
+	if override.TokensPerMonth != nil {
+		limits.TokensPerMonth = *override.TokensPerMonth
+	}
+	if override.ConcurrentJobs != nil {
+		limits.ConcurrentJobs = *override.ConcurrentJobs
+	}
+	return limits, nil
+}
+
+func (s *quotaService) GetOverride(userID uint) (*model.UserQuota, error) {
+	override := &model.UserQuota{UserID: userID}
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(override).Error; err != nil {
+		return nil, err
+	}
+	return override, nil
+}
+
+func (s *quotaService) SetOverride(override *model.UserQuota) error {
+	if override.MessagesPerDay == nil && override.TokensPerMonth == nil && override.ConcurrentJobs == nil {
+		return s.db.Where("user_id = ?", override.UserID).Delete(&model.UserQuota{}).Error
+	}
+	override.UpdatedAt = s.now()
+	return s.db.Save(override).Error
+}
+
+func (s *quotaService) ResetUsage(ctx context.Context, userID uint) error {
+	now := s.now()
+	if err := s.redisClient.Del(ctx, dailyMessagesKey(userID, now)); err != nil {
+		return fmt.Errorf("重置消息计数失败: %v", err)
+	}
+	// 写入0而不是删除，否则下次检查时会从用量记录回填
+	if err := s.redisClient.Set(ctx, monthlyTokensKey(userID, now), 0, nextMonth(now).Sub(now)); err != nil {
+		return fmt.Errorf("重置token计数失败: %v", err)
+	}
+	return nil
+}
+
+func (s *quotaService) Acquire(ctx context.Context, userID, workspaceID uint) (func(), error) {
+	limits, err := s.GetLimits(userID)
+	if err != nil {
+		return nil, err
+	}
+	var workspaceLimits config.QuotaLimits
+	if workspaceID != 0 {
+		if workspaceLimits, err = s.GetWorkspaceLimits(workspaceID); err != nil {
+			return nil, err
+		}
+	}
+	now := s.now()
+
+	// 每月token配额，只能在调用前检查已用量
+	if err := s.checkTokens(ctx, limits.TokensPerMonth, now, func() (int64, bool, error) {
+		return s.monthlyTokens(ctx, userID, now)
+	}); err != nil {
+		return nil, err
+	}
+	if workspaceID != 0 {
+		if err := s.checkTokens(ctx, workspaceLimits.TokensPerMonth, now, func() (int64, bool, error) {
+			return s.workspaceMonthlyTokens(ctx, workspaceID, now)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// 先占用并发配额，之后的检查失败时依次退回已占用的计数
+	release := func() {}
+	if limits.ConcurrentJobs > 0 {
+		key := concurrentKey(userID)
+		count, err := s.redisClient.IncrBy(ctx, key, 1)
+		if err != nil {
+			return nil, fmt.Errorf("更新并发计数失败: %v", err)
+		}
+		_ = s.redisClient.Expire(ctx, key, concurrentKeyTTL)
+		release = func() {
+			_, _ = s.redisClient.IncrBy(context.Background(), key, -1)
+		}
+		if count > int64(limits.ConcurrentJobs) {
+			release()
+			return nil, &QuotaExceededError{Limit: "concurrent_jobs", Max: limits.ConcurrentJobs}
+		}
+	}
+
+	// 每日消息配额
+	messagesKey := dailyMessagesKey(userID, now)
+	if err := s.countMessage(ctx, messagesKey, limits.MessagesPerDay, now); err != nil {
+		release()
+		return nil, err
+	}
+	if workspaceID != 0 {
+		if err := s.countMessage(ctx, workspaceMessagesKey(workspaceID, now), workspaceLimits.MessagesPerDay, now); err != nil {
+			if limits.MessagesPerDay > 0 {
+				_, _ = s.redisClient.IncrBy(context.Background(), messagesKey, -1)
+			}
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// checkTokens 检查本月已用token是否达到max，max为0时不限制
+func (s *quotaService) checkTokens(ctx context.Context, max int, now time.Time, used func() (int64, bool, error)) error {
+	if max <= 0 {
+		return nil
+	}
+	tokens, _, err := used()
+	if err != nil {
+		return err
+	}
+	if tokens >= int64(max) {
+		return &QuotaExceededError{Limit: "tokens_per_month", Max: max, ResetAt: nextMonth(now)}
+	}
+	return nil
+}
+
+// countMessage 累加当天的消息计数，超过max时回退并返回配额超限错误，max为0时不限制
+func (s *quotaService) countMessage(ctx context.Context, key string, max int, now time.Time) error {
+	if max <= 0 {
+		return nil
+	}
+	count, err := s.redisClient.IncrBy(ctx, key, 1)
+	if err != nil {
+		return fmt.Errorf("更新消息计数失败: %v", err)
+	}
+	if count == 1 {
+		_ = s.redisClient.Expire(ctx, key, nextDay(now).Sub(now))
+	}
+	if count > int64(max) {
+		_, _ = s.redisClient.IncrBy(ctx, key, -1)
+		return &QuotaExceededError{Limit: "messages_per_day", Max: max, ResetAt: nextDay(now)}
+	}
+	return nil
+}
+
+func (s *quotaService) AddTokens(ctx context.Context, userID uint, tokens int) error {
+	now := s.now()
+	// 计数不存在时从用量记录回填，避免Redis数据丢失后配额被重置；
+	// 回填的汇总已包含刚保存的用量记录，不再重复累加
+	_, backfilled, err := s.monthlyTokens(ctx, userID, now)
+	if err != nil || backfilled {
+		return err
+	}
+	_, err = s.redisClient.IncrBy(ctx, monthlyTokensKey(userID, now), int64(tokens))
+	return err
+}
+
+// monthlyTokens 读取本月已用token，Redis中没有计数时从用量记录汇总
+func (s *quotaService) monthlyTokens(ctx context.Context, userID uint, now time.Time) (int64, bool, error) {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return s.cachedTokens(ctx, monthlyTokensKey(userID, now), now, s.db.Model(&model.UsageRecord{}).
+		Where("user_id = ? AND created_at >= ?", userID, monthStart))
+}
+
+// workspaceMonthlyTokens 读取工作区本月已用token，Redis中没有计数时汇总工作区会话的用量记录
+func (s *quotaService) workspaceMonthlyTokens(ctx context.Context, workspaceID uint, now time.Time) (int64, bool, error) {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return s.cachedTokens(ctx, workspaceTokensKey(workspaceID, now), now, s.db.Model(&model.UsageRecord{}).
+		Joins("JOIN conversations ON conversations.id = usage_records.conversation_id").
+		Where("conversations.workspace_id = ? AND usage_records.created_at >= ?", workspaceID, monthStart))
+}
+
+// cachedTokens 读取token计数，不存在时用records汇总total_tokens写入Redis，
+// backfilled为true表示本次调用完成了回填
+func (s *quotaService) cachedTokens(ctx context.Context, key string, now time.Time, records *gorm.DB) (int64, bool, error) {
+	if value, err := s.redisClient.Get(ctx, key); err == nil {
+		used, err := strconv.ParseInt(value, 10, 64)
+		return used, false, err
+	}
+
+	var used int64
+	if result := records.Select("COALESCE(SUM(usage_records.total_tokens), 0)").Scan(&used); result.Error != nil {
+		return 0, false, result.Error
+	}
+	// 并发回填时只有一个写入生效，其余读取已写入的计数
+	first, err := s.redisClient.SetNX(ctx, key, used, nextMonth(now).Sub(now))
+	if err != nil {
+		return 0, false, fmt.Errorf("保存token计数失败: %v", err)
+	}
+	if !first {
+		value, err := s.redisClient.Get(ctx, key)
+		if err != nil {
+			return 0, false, fmt.Errorf("读取token计数失败: %v", err)
+		}
+		used, err := strconv.ParseInt(value, 10, 64)
+		return used, false, err
+	}
+	return used, true, nil
+}
+
+func (s *quotaService) GetWorkspaceLimits(workspaceID uint) (config.QuotaLimits, error) {
+	limits := s.workspaceDefaults
+	limits.ConcurrentJobs = 0
+
+	override, err := s.GetWorkspaceOverride(workspaceID)
+	if err != nil {
+		return limits, err
+	}
+	if override.MessagesPerDay != nil {
+		limits.MessagesPerDay = *override.MessagesPerDay
+	}
+	if override.TokensPerMonth != nil {
+		limits.TokensPerMonth = *override.TokensPerMonth
+	}
+	return limits, nil
+}
+
+func (s *quotaService) GetWorkspaceOverride(workspaceID uint) (*model.WorkspaceQuota, error) {
+	override := &model.WorkspaceQuota{WorkspaceID: workspaceID}
+	if err := s.db.Where("workspace_id = ?", workspaceID).Limit(1).Find(override).Error; err != nil {
+		return nil, err
+	}
+	return override, nil
+}
+
+func (s *quotaService) SetWorkspaceOverride(override *model.WorkspaceQuota) error {
+	if override.MessagesPerDay == nil && override.TokensPerMonth == nil {
+		return s.db.Where("workspace_id = ?", override.WorkspaceID).Delete(&model.WorkspaceQuota{}).Error
+	}
+	override.UpdatedAt = s.now()
+	return s.db.Save(override).Error
+}
+
+func (s *quotaService) AddWorkspaceTokens(ctx context.Context, workspaceID uint, tokens int) error {
+	now := s.now()
+	_, backfilled, err := s.workspaceMonthlyTokens(ctx, workspaceID, now)
+	if err != nil || backfilled {
+		return err
+	}
+	_, err = s.redisClient.IncrBy(ctx, workspaceTokensKey(workspaceID, now), int64(tokens))
+	return err
+}
+
+func dailyMessagesKey(userID uint, now time.Time) string {
+	return fmt.Sprintf("quota:messages:%d:%s", userID, now.Format("20060102"))
+}
+
+func monthlyTokensKey(userID uint, now time.Time) string {
+	return fmt.Sprintf("quota:tokens:%d:%s", userID, now.Format("200601"))
+}
+
+func workspaceMessagesKey(workspaceID uint, now time.Time) string {
+	return fmt.Sprintf("quota:workspace_messages:%d:%s", workspaceID, now.Format("20060102"))
+}
+
+func workspaceTokensKey(workspaceID uint, now time.Time) string {
+	return fmt.Sprintf("quota:workspace_tokens:%d:%s", workspaceID, now.Format("200601"))
+}
+
+func concurrentKey(userID uint) string {
+	return fmt.Sprintf("quota:concurrent:%d", userID)
+}
+
+func nextDay(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+}
+
+func nextMonth(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+}
+
+// IsQuotaExceeded 判断错误是否为配额超限
+func IsQuotaExceeded(err error) (*QuotaExceededError, bool) {
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return quotaErr, true
+	}
+	return nil, false
+}
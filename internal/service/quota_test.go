@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memoryRedis 内存版Redis，用于测试
+type memoryRedis struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newMemoryRedis() *memoryRedis {
+	return &memoryRedis{values: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+// expired 清理已过期的key，调用方需持有锁
+func (m *memoryRedis) expired(key string) bool {
+	if at, ok := m.expires[key]; ok && !time.Now().Before(at) {
+		delete(m.values, key)
+		delete(m.expires, key)
+		return true
+	}
+	return false
+}
+
+func (m *memoryRedis) Set(_ context.Context, key string, value interface{}, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = fmt.Sprint(value)
+	delete(m.expires, key)
+	if expiration > 0 {
+		m.expires[key] = time.Now().Add(expiration)
+	}
+	return nil
+}
+
+func (m *memoryRedis) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.values[key]
+	if !ok || m.expired(key) {
+		return "", fmt.Errorf("key不存在")
+	}
+	return value, nil
+}
+
+func (m *memoryRedis) Del(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	delete(m.expires, key)
+	return nil
+}
+
+func (m *memoryRedis) SetNX(_ context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; ok && !m.expired(key) {
+		return false, nil
+	}
+	m.values[key] = fmt.Sprint(value)
+	delete(m.expires, key)
+	if expiration > 0 {
+		m.expires[key] = time.Now().Add(expiration)
+	}
+	return true, nil
+}
+
+func (m *memoryRedis) IncrBy(_ context.Context, key string, value int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expired(key)
+	current, _ := strconv.ParseInt(m.values[key], 10, 64)
+	current += value
+	m.values[key] = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+func (m *memoryRedis) Expire(_ context.Context, key string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; ok {
+		m.expires[key] = time.Now().Add(expiration)
+	}
+	return nil
+}
+
+func (m *memoryRedis) TTL(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; !ok || m.expired(key) {
+		return -2, nil
+	}
+	at, ok := m.expires[key]
+	if !ok {
+		return -1, nil
+	}
+	return time.Until(at), nil
+}
+
+func setupQuotaService(t *testing.T, limits config.QuotaLimits) (*quotaService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.UserQuota{}, &model.UsageRecord{}, &model.WorkspaceQuota{}, &model.Conversation{}))
+
+	cfg := &config.Config{Quota: config.QuotaConfig{Default: limits}}
+	return NewQuotaService(db, newMemoryRedis(), cfg).(*quotaService), db
+}
+
+func TestQuotaMessagesPerDay(t *testing.T) {
+	quotaService, _ := setupQuotaService(t, config.QuotaLimits{MessagesPerDay: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		release, err := quotaService.Acquire(ctx, 1, 0)
+		assert.NoError(t, err)
+		release()
+	}
+
+	_, err := quotaService.Acquire(ctx, 1, 0)
+	quotaErr, ok := IsQuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, "messages_per_day", quotaErr.Limit)
+	assert.True(t, quotaErr.ResetAt.After(time.Now()))
+
+	// 其他用户不受影响
+	_, err = quotaService.Acquire(ctx, 2, 0)
+	assert.NoError(t, err)
+}
+
+func TestQuotaConcurrentJobs(t *testing.T) {
+	quotaService, _ := setupQuotaService(t, config.QuotaLimits{ConcurrentJobs: 1})
+	ctx := context.Background()
+
+	release, err := quotaService.Acquire(ctx, 1, 0)
+	assert.NoError(t, err)
+
+	_, err = quotaService.Acquire(ctx, 1, 0)
+	quotaErr, ok := IsQuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, "concurrent_jobs", quotaErr.Limit)
+
+	// 释放后可以再次占用
+	release()
+	_, err = quotaService.Acquire(ctx, 1, 0)
+	assert.NoError(t, err)
+}
+
+func TestQuotaRejectionReturnsSlots(t *testing.T) {
+	quotaService, _ := setupQuotaService(t, config.QuotaLimits{MessagesPerDay: 2, ConcurrentJobs: 1})
+	quotaService.workspaceDefaults = config.QuotaLimits{MessagesPerDay: 1}
+	ctx := context.Background()
+	messages := func() string {
+		count, _ := quotaService.redisClient.Get(ctx, dailyMessagesKey(1, time.Now()))
+		return count
+	}
+
+	// 并发超限时不占用当天的消息数
+	release, err := quotaService.Acquire(ctx, 1, 1)
+	assert.NoError(t, err)
+	_, err = quotaService.Acquire(ctx, 1, 0)
+	quotaErr, ok := IsQuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, "concurrent_jobs", quotaErr.Limit)
+	assert.Equal(t, "1", messages())
+	release()
+
+	// 工作区配额超限时退回用户的消息数和并发数
+	_, err = quotaService.Acquire(ctx, 1, 1)
+	quotaErr, ok = IsQuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, "messages_per_day", quotaErr.Limit)
+	assert.Equal(t, "1", messages())
+	_, err = quotaService.Acquire(ctx, 1, 0)
+	assert.NoError(t, err)
+}
+
+func TestQuotaTokensPerMonth(t *testing.T) {
+	quotaService, db := setupQuotaService(t, config.QuotaLimits{TokensPerMonth: 1000})
+	ctx := context.Background()
+
+	// Redis中没有计数时从用量记录回填
+	db.Create(&model.UsageRecord{UserID: 1, Model: "m", TotalTokens: 900, CreatedAt: time.Now()})
+	_, err := quotaService.Acquire(ctx, 1, 0)
+	assert.NoError(t, err)
+
+	assert.NoError(t, quotaService.AddTokens(ctx, 1, 100))
+	_, err = quotaService.Acquire(ctx, 1, 0)
+	quotaErr, ok := IsQuotaExceeded(err)
+	assert.True(t, ok)
+	assert.Equal(t, "tokens_per_month", quotaErr.Limit)
+
+	// 计数不存在时先保存的用量记录已包含在回填中，不会重复累加
+	db.Create(&model.UsageRecord{UserID: 2, Model: "m", TotalTokens: 600, CreatedAt: time.Now()})
+	assert.NoError(t, quotaService.AddTokens(ctx, 2, 600))
+	used, _, err := quotaService.monthlyTokens(ctx, 2, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), used)
+	assert.NoError(t, quotaService.AddTokens(ctx, 2, 100))
+	used, _, err = quotaService.monthlyTokens(ctx, 2, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(700), used)
+}
+
+func TestQuotaUserOverride(t *testing.T) {
+	quotaService, db := setupQuotaService(t, config.QuotaLimits{MessagesPerDay: 1})
+	unlimited := 0
+	db.Create(&model.UserQuota{UserID: 1, MessagesPerDay: &unlimited})
+
+	limits, err := quotaService.GetLimits(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, limits.MessagesPerDay)
+
+	for i := 0; i < 3; i++ {
+		_, err := quotaService.Acquire(context.Background(), 1, 0)
+		assert.NoError(t, err)
+	}
+}
+
+func TestQuotaRoleLimits(t *testing.T) {
+	quotaService, db := setupQuotaService(t, config.QuotaLimits{MessagesPerDay: 1, TokensPerMonth: 100})
+	assert.NoError(t, db.AutoMigrate(&model.User{}))
+	db.Create(&model.User{ID: 1, Username: "alice", Email: "alice@example.com", Role: "premium"})
+	db.Create(&model.User{ID: 2, Username: "bob", Email: "bob@example.com", Role: "user"})
+	fifty := 50
+	quotaService.roles = map[string]config.RoleQuota{"premium": {MessagesPerDay: &fifty}}
+
+	// 角色配额只覆盖设置的项
+	limits, err := quotaService.GetLimits(1)
+	assert.NoError(t, err)
+	assert.Equal(t, config.QuotaLimits{MessagesPerDay: 50, TokensPerMonth: 100}, limits)
+	limits, err = quotaService.GetLimits(2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, limits.MessagesPerDay)
+
+	// 用户级配额优先于角色配额
+	two := 2
+	assert.NoError(t, quotaService.SetOverride(&model.UserQuota{UserID: 1, MessagesPerDay: &two}))
+	limits, err = quotaService.GetLimits(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, limits.MessagesPerDay)
+}
+
+func TestQuotaAdminOverrideAndReset(t *testing.T) {
+	quotaService, db := setupQuotaService(t, config.QuotaLimits{MessagesPerDay: 1, TokensPerMonth: 100})
+	ctx := context.Background()
+
+	two := 2
+	assert.NoError(t, quotaService.SetOverride(&model.UserQuota{UserID: 1, MessagesPerDay: &two}))
+	limits, err := quotaService.GetLimits(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, limits.MessagesPerDay)
+	assert.Equal(t, 100, limits.TokensPerMonth)
+
+	// 重置后当天消息数和本月token用量清零
+	db.Create(&model.UsageRecord{UserID: 1, TotalTokens: 100, CreatedAt: time.Now()})
+	_, err = quotaService.Acquire(ctx, 1, 0)
+	assert.Error(t, err)
+	assert.NoError(t, quotaService.ResetUsage(ctx, 1))
+	for i := 0; i < 2; i++ {
+		_, err := quotaService.Acquire(ctx, 1, 0)
+		assert.NoError(t, err)
+	}
+
+	// 字段全部为空时恢复默认配额
+	assert.NoError(t, quotaService.SetOverride(&model.UserQuota{UserID: 1}))
+	override, err := quotaService.GetOverride(1)
+	assert.NoError(t, err)
+	assert.Nil(t, override.MessagesPerDay)
+	limits, err = quotaService.GetLimits(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, limits.MessagesPerDay)
+}
+
+func TestQuotaWorkspace(t *testing.T) {
+	quotaService, db := setupQuotaService(t, config.QuotaLimits{})
+	quotaService.workspaceDefaults = config.QuotaLimits{MessagesPerDay: 1, TokensPerMonth: 1000, ConcurrentJobs: 1}
+	ctx := context.Background()
+
+	// 工作区配额不限制并发任务
+	limits, err := quotaService.GetWorkspaceLimits(1)
+	assert.NoError(t, err)
+	assert.Equal(t, config.QuotaLimits{MessagesPerDay: 1, TokensPerMonth: 1000}, limits)
+
+	acquire := func(workspaceID uint) error {
+		_, err := quotaService.Acquire(ctx, 1, workspaceID)
+		return err
+	}
+	assert.NoError(t, acquire(1))
+	quotaErr, ok := IsQuotaExceeded(acquire(1))
+	assert.True(t, ok)
+	assert.Equal(t, "messages_per_day", quotaErr.Limit)
+	assert.NoError(t, acquire(2))
+
+	// 本月token用量从工作区会话的用量记录回填
+	unlimited := 0
+	assert.NoError(t, quotaService.SetWorkspaceOverride(&model.WorkspaceQuota{WorkspaceID: 3, MessagesPerDay: &unlimited}))
+	workspaceID := uint(3)
+	db.Create(&model.Conversation{ID: 10, UserID: 1, WorkspaceID: &workspaceID})
+	db.Create(&model.UsageRecord{UserID: 1, ConversationID: 10, TotalTokens: 900, CreatedAt: time.Now()})
+	db.Create(&model.UsageRecord{UserID: 1, ConversationID: 11, TotalTokens: 900, CreatedAt: time.Now()})
+	assert.NoError(t, acquire(3))
+	assert.NoError(t, quotaService.AddWorkspaceTokens(ctx, 3, 100))
+	quotaErr, ok = IsQuotaExceeded(acquire(3))
+	assert.True(t, ok)
+	assert.Equal(t, "tokens_per_month", quotaErr.Limit)
+
+	// 字段全部为空时恢复默认配额
+	assert.NoError(t, quotaService.SetWorkspaceOverride(&model.WorkspaceQuota{WorkspaceID: 3}))
+	override, err := quotaService.GetWorkspaceOverride(3)
+	assert.NoError(t, err)
+	assert.Nil(t, override.MessagesPerDay)
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound = errors.New("角色不存在")
+	ErrInvalidRole  = errors.New("无效的角色参数")
+	ErrRoleInUse    = errors.New("仍有用户使用该角色，无法删除")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,49}$`)
+
+// RoleInfo 角色及其权限，内置角色不能修改和删除
+type RoleInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+}
+
+// builtinRoles 内置角色
+var builtinRoles = []RoleInfo{
+	{Name: model.RoleUser, Description: "普通用户", Permissions: []string{}, Builtin: true},
+	{Name: model.RoleAdmin, Description: "管理员，拥有全部权限", Permissions: model.Permissions, Builtin: true},
+}
+
+type RoleService interface {
+	// ListRoles 列出内置角色和自定义角色
+	ListRoles() ([]RoleInfo, error)
+	// GetRole 获取角色，角色不存在时返回ErrRoleNotFound
+	GetRole(name string) (*RoleInfo, error)
+	// CreateRole 创建自定义角色
+	CreateRole(name, description string, permissions []string) (*RoleInfo, error)
+	// UpdateRole 修改自定义角色的说明和权限
+	UpdateRole(name, description string, permissions []string) (*RoleInfo, error)
+	// DeleteRole 删除没有用户使用的自定义角色
+	DeleteRole(name string) error
+	// Permissions 获取用户拥有的权限，停用的账户没有任何权限
+	Permissions(ctx context.Context, userID uint) ([]string, error)
+	// UserPermissions 获取用户角色对应的权限，不考虑账户是否停用
+	UserPermissions(user *model.User) ([]string, error)
+	// HasPermission 判断用户是否拥有权限
+	HasPermission(ctx context.Context, userID uint, permission string) (bool, error)
+}
+
+type roleService struct {
+	db     *gorm.DB
+	admins map[string]bool
+}
+
+// NewRoleService 创建角色服务实例，配置文件中列出的管理员始终拥有全部权限
+func NewRoleService(db *gorm.DB, cfg *config.Config) RoleService {
+	admins := make(map[string]bool, len(cfg.Admin.Users))
+	for _, username := range cfg.Admin.Users {
+		admins[username] = true
+	}
+	return &roleService{db: db, admins: admins}
+}
+
+func (s *roleService) ListRoles() ([]RoleInfo, error) {
+	var custom []model.Role
+	if err := s.db.Order("name").Find(&custom).Error; err != nil {
+		return nil, err
+	}
+	roles := append([]RoleInfo{}, builtinRoles...)
+	for _, role := range custom {
+		roles = append(roles, roleInfo(&role))
+	}
+	return roles, nil
+}
+
+func (s *roleService) GetRole(name string) (*RoleInfo, error) {
+	for _, role := range builtinRoles {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	var role model.Role
+	err := s.db.Where("name = ?", name).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := roleInfo(&role)
+	return &info, nil
+}
+
+func (s *roleService) CreateRole(name, description string, permissions []string) (*RoleInfo, error) {
+	name = strings.TrimSpace(name)
+	if !roleNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: 角色名只能包含小写字母、数字、-和_，且以字母开头", ErrInvalidRole)
+	}
+	if isBuiltinRole(name) {
+		return nil, fmt.Errorf("%w: %s是内置角色", ErrInvalidRole, name)
+	}
+	role := &model.Role{Name: name, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := setRoleFields(role, description, permissions); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	s.db.Model(&model.Role{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 角色%s已存在", ErrInvalidRole, name)
+	}
+	if err := s.db.Create(role).Error; err != nil {
+		return nil, err
+	}
+	info := roleInfo(role)
+	return &info, nil
+}
+
+func (s *roleService) UpdateRole(name, description string, permissions []string) (*RoleInfo, error) {
+	if isBuiltinRole(name) {
+		return nil, fmt.Errorf("%w: 内置角色不能修改", ErrInvalidRole)
+	}
+	var role model.Role
+	err := s.db.Where("name = ?", name).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := setRoleFields(&role, description, permissions); err != nil {
+		return nil, err
+	}
+	if err := s.db.Select("description", "permissions", "updated_at").Save(&role).Error; err != nil {
+		return nil, err
+	}
+	info := roleInfo(&role)
+	return &info, nil
+}
+
+func (s *roleService) DeleteRole(name string) error {
+	if isBuiltinRole(name) {
+		return fmt.Errorf("%w: 内置角色不能删除", ErrInvalidRole)
+	}
+	var count int64
+	if err := s.db.Model(&model.User{}).Where("role = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	result := s.db.Where("name = ?", name).Delete(&model.Role{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (s *roleService) Permissions(ctx context.Context, userID uint) ([]string, error) {
+	var user model.User
+	err := s.db.WithContext(ctx).Select("id", "username", "role", "disabled_at").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return []string{}, nil
+	}
+	return s.UserPermissions(&user)
+}
+
+func (s *roleService) UserPermissions(user *model.User) ([]string, error) {
+	if s.admins[user.Username] {
+		return model.Permissions, nil
+	}
+
+	role, err := s.GetRole(user.Role)
+	if errors.Is(err, ErrRoleNotFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role.Permissions, nil
+}
+
+func (s *roleService) HasPermission(ctx context.Context, userID uint, permission string) (bool, error) {
+	permissions, err := s.Permissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range permissions {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setRoleFields 校验并设置自定义角色的说明和权限，权限去重
+func setRoleFields(role *model.Role, description string, permissions []string) error {
+	description = strings.TrimSpace(description)
+	if utf8.RuneCountInString(description) > 255 {
+		return fmt.Errorf("%w: 说明最多255个字符", ErrInvalidRole)
+	}
+	seen := make(map[string]bool, len(permissions))
+	normalized := []string{}
+	for _, permission := range permissions {
+		if !isPermission(permission) {
+			return fmt.Errorf("%w: 未知的权限%s", ErrInvalidRole, permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			normalized = append(normalized, permission)
+		}
+	}
+	role.Description = description
+	role.Permissions = normalized
+	role.UpdatedAt = time.Now()
+	return nil
+}
+
+func roleInfo(role *model.Role) RoleInfo {
+	permissions := role.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+	return RoleInfo{Name: role.Name, Description: role.Description, Permissions: permissions}
+}
+
+func isBuiltinRole(name string) bool {
+	return name == model.RoleUser || name == model.RoleAdmin
+}
+
+func isPermission(permission string) bool {
+	for _, p := range model.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"errors"
+	"html"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"gorm.io/gorm"
+)
+
+const (
+	// searchIndexName MySQL全文索引名称
+	searchIndexName = "ft_chat_messages_content"
+	// searchFTSTable SQLite FTS5虚拟表名称
+	searchFTSTable = "chat_messages_fts"
+	// snippetRadius 摘要中命中位置前后保留的字符数
+	snippetRadius = 40
+)
+
+// SearchQuery 消息搜索条件
+type SearchQuery struct {
+	UserID         uint
+	Query          string
+	ConversationID uint
+	Role           string
+	From           time.Time
+	To             time.Time
+	Page           pagination.Page
+}
+
+// SearchHit 一条命中的消息
+type SearchHit struct {
+	MessageID         uint      `json:"message_id"`
+	ConversationID    uint      `json:"conversation_id"`
+	ConversationTitle string    `json:"conversation_title"`
+	Role              string    `json:"role"`
+	Snippet           string    `json:"snippet"` // 已转义的HTML，命中部分以<mark>标记
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type SearchService interface {
+	// EnsureIndex 创建全文索引，MySQL使用ngram解析器，SQLite使用FTS5
+	EnsureIndex() error
+	// Search 在用户的全部消息中全文搜索，按时间倒序分页
+	Search(query SearchQuery) (*pagination.Result[SearchHit], error)
+}
+
+type searchService struct {
+	db     *gorm.DB
+	useFTS bool // SQLite下FTS5索引可用
+}
+
+// NewSearchService 创建搜索服务实例
+func NewSearchService(db *gorm.DB) SearchService {
+	return &searchService{db: db}
+}
+
+func (s *searchService) EnsureIndex() error {
+	switch s.db.Dialector.Name() {
+	case "mysql":
+		if s.db.Migrator().HasIndex(&model.ChatMessage{}, searchIndexName) {
+			return nil
+		}
+		return s.db.Exec("ALTER TABLE chat_messages ADD FULLTEXT INDEX " + searchIndexName + " (content) WITH PARSER ngram").Error
+	case "sqlite":
+		if err := s.ensureFTS(); err != nil {
+			// 未启用FTS5编译选项时退化为LIKE查询
+			log.Printf("创建FTS5索引失败，使用LIKE搜索: %v", err)
+			return nil
+		}
+		s.useFTS = true
+	}
+	return nil
+}
+
+// ensureFTS 创建外部内容FTS5表及同步触发器
+func (s *searchService) ensureFTS() error {
+	if s.db.Migrator().HasTable(searchFTSTable) {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"CREATE VIRTUAL TABLE " + searchFTSTable + " USING fts5(content, content='chat_messages', content_rowid='id', tokenize='trigram')",
+			"CREATE TRIGGER chat_messages_fts_ai AFTER INSERT ON chat_messages BEGIN " +
+				"INSERT INTO " + searchFTSTable + "(rowid, content) VALUES (new.id, new.content); END",
+			"CREATE TRIGGER chat_messages_fts_ad AFTER DELETE ON chat_messages BEGIN " +
+				"INSERT INTO " + searchFTSTable + "(" + searchFTSTable + ", rowid, content) VALUES ('delete', old.id, old.content); END",
+			"CREATE TRIGGER chat_messages_fts_au AFTER UPDATE ON chat_messages BEGIN " +
+				"INSERT INTO " + searchFTSTable + "(" + searchFTSTable + ", rowid, content) VALUES ('delete', old.id, old.content); " +
+				"INSERT INTO " + searchFTSTable + "(rowid, content) VALUES (new.id, new.content); END",
+			"INSERT INTO " + searchFTSTable + "(" + searchFTSTable + ") VALUES ('rebuild')",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *searchService) Search(query SearchQuery) (*pagination.Result[SearchHit], error) {
+	query.Query = strings.TrimSpace(query.Query)
+	if query.Query == "" {
+		return nil, errors.New("搜索关键词不能为空")
+	}
+
+	db := s.db.Model(&model.ChatMessage{}).Where("chat_messages.user_id = ?", query.UserID)
+	if query.ConversationID != 0 {
+		db = db.Where("chat_messages.conversation_id = ?", query.ConversationID)
+	}
+	if query.Role != "" {
+		db = db.Where("chat_messages.role = ?", query.Role)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("chat_messages.created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("chat_messages.created_at < ?", query.To)
+	}
+
+	switch {
+	case s.db.Dialector.Name() == "mysql":
+		db = db.Where("MATCH(chat_messages.content) AGAINST(? IN NATURAL LANGUAGE MODE)", query.Query)
+	case s.useFTS && utf8.RuneCountInString(query.Query) >= 3:
+		// trigram分词要求关键词至少3个字符，整体作为短语匹配
+		phrase := `"` + strings.ReplaceAll(query.Query, `"`, `""`) + `"`
+		db = db.Joins("JOIN "+searchFTSTable+" ON "+searchFTSTable+".rowid = chat_messages.id").
+			Where(searchFTSTable+" MATCH ?", phrase)
+	default:
+		// 仅在SQLite下使用，SQLite字符串中的反斜杠无需转义
+		db = db.Where("chat_messages.content LIKE ? ESCAPE '!'", "%"+escapeLikeBang(query.Query)+"%")
+	}
+
+	// 与其他列表一致按时间倒序，游标分页要求排序稳定，因此不按相关度排序
+	var messages []model.ChatMessage
+	if result := query.Page.Apply(db.Select("chat_messages.*"), "chat_messages").Find(&messages); result.Error != nil {
+		return nil, result.Error
+	}
+
+	titles, err := s.conversationTitles(messages)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]SearchHit, 0, len(messages))
+	for _, message := range messages {
+		hits = append(hits, SearchHit{
+			MessageID:         message.ID,
+			ConversationID:    message.ConversationID,
+			ConversationTitle: titles[message.ConversationID],
+			Role:              message.Role,
+			Snippet:           highlight(message.Content, query.Query),
+			CreatedAt:         message.CreatedAt,
+		})
+	}
+
+	return pagination.NewResult(hits, query.Page, func(hit SearchHit) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: hit.CreatedAt, ID: hit.MessageID}
+	}), nil
+}
+
+// conversationTitles 查询命中消息所属会话的标题
+func (s *searchService) conversationTitles(messages []model.ChatMessage) (map[uint]string, error) {
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ConversationID)
+	}
+	titles := make(map[uint]string)
+	if len(ids) == 0 {
+		return titles, nil
+	}
+
+	var conversations []model.Conversation
+	if result := s.db.Select("id", "title").Where("id IN ?", ids).Find(&conversations); result.Error != nil {
+		return nil, result.Error
+	}
+	for _, conversation := range conversations {
+		titles[conversation.ID] = conversation.Title
+	}
+	return titles, nil
+}
+
+// escapeLikeBang 以!为转义符转义LIKE中的通配符，配合ESCAPE '!'使用。
+// 不使用反斜杠，MySQL和SQLite对字符串中反斜杠的处理不同
+func escapeLikeBang(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// highlight 截取首个命中位置附近的内容作为摘要，转义HTML后用<mark>标记命中的关键词
+func highlight(content, query string) string {
+	text := []rune(content)
+	lower := []rune(strings.Map(unicode.ToLower, content))
+
+	// 整个关键词优先，其次为空格分隔的各个词
+	lowerQuery := strings.Map(unicode.ToLower, query)
+	terms := [][]rune{[]rune(lowerQuery)}
+	for _, field := range strings.Fields(lowerQuery) {
+		terms = append(terms, []rune(field))
+	}
+
+	start := -1
+	for _, term := range terms {
+		if i := indexRunes(lower, term); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	from := max(0, start-snippetRadius)
+	to := min(len(text), start+snippetRadius*2)
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	for i := from; i < to; {
+		matched := 0
+		for _, term := range terms {
+			if len(term) > 0 && i+len(term) <= to && indexRunes(lower[i:i+len(term)], term) == 0 {
+				matched = len(term)
+				break
+			}
+		}
+		if matched > 0 {
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(string(text[i : i+matched])))
+			b.WriteString("</mark>")
+			i += matched
+			continue
+		}
+		b.WriteString(html.EscapeString(string(text[i])))
+		i++
+	}
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// indexRunes 返回sub在s中首次出现的位置
+func indexRunes(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
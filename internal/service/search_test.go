@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupSearchService(t *testing.T) (*searchService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}))
+
+	searchService := NewSearchService(db).(*searchService)
+	// 未启用FTS5时退化为LIKE查询，两种方式结果应一致
+	assert.NoError(t, searchService.EnsureIndex())
+
+	db.Create(&model.Conversation{ID: 1, UserID: 1, Title: "并发研究"})
+	db.Create(&model.Conversation{ID: 2, UserID: 1, Title: "其他"})
+	lastWeek := time.Now().AddDate(0, 0, -7)
+	messages := []model.ChatMessage{
+		{UserID: 1, ConversationID: 1, Role: "user", Content: "Go语言的并发模型是什么？", CreatedAt: lastWeek},
+		{UserID: 1, ConversationID: 1, Role: "assistant", Content: "Go语言使用goroutine和channel实现并发模型，<b>CSP</b>风格。", CreatedAt: lastWeek},
+		{UserID: 1, ConversationID: 2, Role: "assistant", Content: "Rust的并发模型基于所有权。", CreatedAt: time.Now()},
+		{UserID: 2, ConversationID: 3, Role: "assistant", Content: "其他用户的并发模型消息", CreatedAt: time.Now()},
+	}
+	for i := range messages {
+		db.Create(&messages[i])
+	}
+	return searchService, db
+}
+
+func TestSearchMessages(t *testing.T) {
+	searchService, _ := setupSearchService(t)
+
+	result, err := searchService.Search(SearchQuery{UserID: 1, Query: "并发模型"})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 3)
+	assert.Empty(t, result.NextCursor)
+
+	// 按角色和会话过滤
+	result, err = searchService.Search(SearchQuery{UserID: 1, Query: "并发模型", Role: "assistant", ConversationID: 1})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 1)
+	assert.Equal(t, "并发研究", result.Items[0].ConversationTitle)
+	assert.Contains(t, result.Items[0].Snippet, "<mark>并发模型</mark>")
+	assert.Contains(t, result.Items[0].Snippet, "&lt;b&gt;CSP&lt;/b&gt;")
+
+	// 按时间过滤
+	result, err = searchService.Search(SearchQuery{UserID: 1, Query: "并发模型", From: time.Now().AddDate(0, 0, -1)})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 1)
+
+	// 游标分页，按时间倒序
+	result, err = searchService.Search(SearchQuery{UserID: 1, Query: "并发模型", Page: pagination.Page{Limit: 2}})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 2)
+	assert.Equal(t, "其他", result.Items[0].ConversationTitle)
+	page, err := pagination.NewPage(result.NextCursor, 2)
+	assert.NoError(t, err)
+	result, err = searchService.Search(SearchQuery{UserID: 1, Query: "并发模型", Page: page})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 1)
+	assert.Equal(t, "user", result.Items[0].Role)
+	assert.Empty(t, result.NextCursor)
+
+	// LIKE通配符被转义
+	result, err = searchService.Search(SearchQuery{UserID: 1, Query: "%"})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Items)
+
+	_, err = searchService.Search(SearchQuery{UserID: 1, Query: " "})
+	assert.Error(t, err)
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "Hello <mark>World</mark>", highlight("Hello World", "world"))
+
+	long := "开头这是一段很长的内容，" + "这是一段很长的内容，这是一段很长的内容，这是一段很长的内容，这是一段很长的内容，" + "关键词" + "在这里出现。"
+	snippet := highlight(long, "关键词")
+	assert.Contains(t, snippet, "<mark>关键词</mark>")
+	assert.True(t, len([]rune(snippet)) < len([]rune(long))+20)
+	assert.Contains(t, snippet, "…")
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"gorm.io/gorm"
+)
+
+// sharePrefixLength 列表中显示的令牌前缀长度
+const sharePrefixLength = 6
+
+var (
+	ErrShareNotFound = errors.New("分享不存在")
+	ErrShareExpired  = errors.New("分享已过期或已撤销")
+)
+
+// ShareOptions 创建分享的选项
+type ShareOptions struct {
+	ExpiresIn time.Duration // 为0时永不过期
+	HideTrace bool
+}
+
+// SharedConversation 公开访问时返回的会话快照，不包含用户和消息ID等内部信息
+type SharedConversation struct {
+	Title     string          `json:"title"`
+	Messages  []SharedMessage `json:"messages"`
+	SharedAt  time.Time       `json:"shared_at"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+}
+
+// SharedMessage 快照中的单条消息
+type SharedMessage struct {
+	Role      string        `json:"role"`
+	Content   string        `json:"content"`
+	Status    string        `json:"status"`
+	CreatedAt time.Time     `json:"created_at"`
+	Trace     []SharedTrace `json:"trace,omitempty"`
+}
+
+// SharedTrace 快照中的执行步骤
+type SharedTrace struct {
+	Type      string `json:"type"`
+	Content   string `json:"content,omitempty"`
+	ToolName  string `json:"tool_name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+}
+
+type ShareService interface {
+	// Create 为会话当前分支创建快照并生成分享链接，链接只在创建时返回
+	Create(userID, conversationID uint, opts ShareOptions) (*model.Share, error)
+	// List 分页列出用户创建的分享，不包含链接，通过令牌前缀辨认
+	List(userID uint, page pagination.Page) (*pagination.Result[model.Share], error)
+	// Revoke 撤销分享，撤销后链接不可访问
+	Revoke(userID, shareID uint) error
+	// Get 通过令牌获取分享的快照，无需认证
+	Get(token string) (*SharedConversation, error)
+}
+
+type shareService struct {
+	db   *gorm.DB
+	chat ChatService
+}
+
+// NewShareService 创建分享服务实例
+func NewShareService(db *gorm.DB, chat ChatService) ShareService {
+	return &shareService{db: db, chat: chat}
+}
+
+func (s *shareService) Create(userID, conversationID uint, opts ShareOptions) (*model.Share, error) {
+	var conversation model.Conversation
+	if result := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation); result.Error != nil {
+		return nil, ErrConversationNotFound
+	}
+	messages, err := s.chat.GetConversationMessages(userID, conversationID, !opts.HideTrace)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make([]SharedMessage, 0, len(messages))
+	for _, message := range messages {
+		shared := SharedMessage{
+			Role:      message.Role,
+			Content:   message.Content,
+			Status:    message.Status,
+			CreatedAt: message.CreatedAt,
+		}
+		for _, step := range message.Trace {
+			shared.Trace = append(shared.Trace, SharedTrace{
+				Type:      step.Type,
+				Content:   step.Content,
+				ToolName:  step.ToolName,
+				Arguments: step.Arguments,
+				Result:    step.Result,
+				Error:     step.Error,
+				LatencyMs: step.LatencyMs,
+			})
+		}
+		snapshot = append(snapshot, shared)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	share := &model.Share{
+		UserID:         userID,
+		ConversationID: conversationID,
+		Prefix:         token[:sharePrefixLength],
+		TokenHash:      hashToken(token),
+		Title:          conversation.Title,
+		HideTrace:      opts.HideTrace,
+		Snapshot:       string(data),
+	}
+	if opts.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(opts.ExpiresIn)
+		share.ExpiresAt = &expiresAt
+	}
+	if result := s.db.Create(share); result.Error != nil {
+		return nil, result.Error
+	}
+	share.URL = sharePath(token)
+	return share, nil
+}
+
+func (s *shareService) List(userID uint, page pagination.Page) (*pagination.Result[model.Share], error) {
+	var shares []model.Share
+	if result := page.Apply(s.db.Where("user_id = ?", userID), "shares").Find(&shares); result.Error != nil {
+		return nil, result.Error
+	}
+	return pagination.NewResult(shares, page, func(share model.Share) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: share.CreatedAt, ID: share.ID}
+	}), nil
+}
+
+func (s *shareService) Revoke(userID, shareID uint) error {
+	result := s.db.Model(&model.Share{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", shareID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+func (s *shareService) Get(token string) (*SharedConversation, error) {
+	var share model.Share
+	if result := s.db.Where("token_hash = ?", hashToken(token)).First(&share); result.Error != nil {
+		return nil, ErrShareNotFound
+	}
+	if share.RevokedAt != nil || (share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt)) {
+		return nil, ErrShareExpired
+	}
+
+	shared := &SharedConversation{Title: share.Title, SharedAt: share.CreatedAt, ExpiresAt: share.ExpiresAt}
+	if err := json.Unmarshal([]byte(share.Snapshot), &shared.Messages); err != nil {
+		return nil, err
+	}
+	return shared, nil
+}
+
+// sharePath 分享的公开访问路径
+func sharePath(token string) string {
+	return "/share/" + token
+}
+
+// randomToken 生成指定字节数、URL安全的不可猜测令牌
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
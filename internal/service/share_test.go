@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupShareService(t *testing.T) (ShareService, ChatService, *gorm.DB, uint) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}, &model.TraceStep{}, &model.Share{}))
+
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(schema.AssistantMessage("研究结论", nil), nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, nil, nil)
+
+	response, err := chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, Content: "调研结果如何"}, SendOptions{})
+	assert.NoError(t, err)
+	conversationID := response["conversation_id"].(uint)
+	reply := response["reply"].(*model.ChatMessage)
+	db.Create(&model.TraceStep{MessageID: reply.ID, Seq: 1, Type: model.TraceStepToolCall, ToolName: "duckduckgo_search", Arguments: `{"query":"调研"}`})
+
+	return NewShareService(db, chatService), chatService, db, conversationID
+}
+
+// shareToken 从创建时返回的链接中取出令牌
+func shareToken(share *model.Share) string {
+	return strings.TrimPrefix(share.URL, "/share/")
+}
+
+func TestShareSnapshot(t *testing.T) {
+	shareService, chatService, _, conversationID := setupShareService(t)
+
+	share, err := shareService.Create(1, conversationID, ShareOptions{})
+	assert.NoError(t, err)
+	token := shareToken(share)
+	assert.Len(t, token, 32)
+	assert.Equal(t, token[:6], share.Prefix)
+	assert.Equal(t, hashToken(token), share.TokenHash)
+	assert.Nil(t, share.ExpiresAt)
+
+	// 分享之后的新消息不出现在快照中
+	_, err = chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, ConversationID: conversationID, Content: "私密追问"}, SendOptions{})
+	assert.NoError(t, err)
+
+	shared, err := shareService.Get(token)
+	assert.NoError(t, err)
+	assert.Len(t, shared.Messages, 2)
+	assert.Equal(t, "调研结果如何", shared.Messages[0].Content)
+	assert.Len(t, shared.Messages[1].Trace, 1)
+	assert.Equal(t, "duckduckgo_search", shared.Messages[1].Trace[0].ToolName)
+
+	// 隐藏执行步骤
+	hidden, err := shareService.Create(1, conversationID, ShareOptions{HideTrace: true})
+	assert.NoError(t, err)
+	shared, err = shareService.Get(shareToken(hidden))
+	assert.NoError(t, err)
+	assert.Len(t, shared.Messages, 4)
+	for _, message := range shared.Messages {
+		assert.Empty(t, message.Trace)
+	}
+
+	_, err = shareService.Create(2, conversationID, ShareOptions{})
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, err = shareService.Get("unknown")
+	assert.ErrorIs(t, err, ErrShareNotFound)
+}
+
+func TestShareExpiryAndRevoke(t *testing.T) {
+	shareService, _, db, conversationID := setupShareService(t)
+
+	share, err := shareService.Create(1, conversationID, ShareOptions{ExpiresIn: time.Hour})
+	assert.NoError(t, err)
+	assert.NotNil(t, share.ExpiresAt)
+	_, err = shareService.Get(shareToken(share))
+	assert.NoError(t, err)
+
+	db.Model(&model.Share{}).Where("id = ?", share.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	_, err = shareService.Get(shareToken(share))
+	assert.ErrorIs(t, err, ErrShareExpired)
+
+	share, err = shareService.Create(1, conversationID, ShareOptions{})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, shareService.Revoke(2, share.ID), ErrShareNotFound)
+	assert.NoError(t, shareService.Revoke(1, share.ID))
+	_, err = shareService.Get(shareToken(share))
+	assert.ErrorIs(t, err, ErrShareExpired)
+	assert.ErrorIs(t, shareService.Revoke(1, share.ID), ErrShareNotFound)
+
+	shares, err := shareService.List(1, pagination.Page{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, shares.Items, 1)
+	assert.NotNil(t, shares.Items[0].RevokedAt)
+	// 列表只显示令牌前缀，不再返回链接
+	assert.Equal(t, share.Prefix, shares.Items[0].Prefix)
+	assert.Empty(t, shares.Items[0].URL)
+	page, err := pagination.NewPage(shares.NextCursor, 1)
+	assert.NoError(t, err)
+	shares, err = shareService.List(1, page)
+	assert.NoError(t, err)
+	assert.Len(t, shares.Items, 1)
+	assert.Empty(t, shares.NextCursor)
+}
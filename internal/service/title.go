@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/resource/llm"
+	"gorm.io/gorm"
+)
+
+const (
+	// titleMaxLength 标题的最大字符数
+	titleMaxLength = 50
+	// titleInputLength 生成标题时截取的问题和回复长度
+	titleInputLength = 1000
+
+	titlePrompt = "Generate a short title (no more than 8 words) for the conversation below. " +
+		"Use the same language as the user. Reply with the title only, without quotes or punctuation at the end."
+)
+
+type TitleService interface {
+	// Generate 根据首轮问答生成会话标题，会话已有标题时不覆盖
+	Generate(ctx context.Context, userID, conversationID uint, question, answer string) (string, error)
+	// Rename 修改会话标题
+	Rename(userID, conversationID uint, title string) error
+}
+
+type titleService struct {
+	db    *gorm.DB
+	model llm.TitleModel
+	usage UsageService
+}
+
+// NewTitleService 创建会话标题服务实例
+func NewTitleService(db *gorm.DB, titleModel llm.TitleModel, usage UsageService) TitleService {
+	return &titleService{db: db, model: titleModel, usage: usage}
+}
+
+func (s *titleService) Generate(ctx context.Context, userID, conversationID uint, question, answer string) (string, error) {
+	if s.usage != nil {
+		ctx = callbacks.InitCallbacks(ctx, &callbacks.RunInfo{Name: "title", Component: components.ComponentOfChatModel},
+			s.usage.CallbackHandler(userID, conversationID))
+	}
+	output, err := s.model.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(titlePrompt),
+		schema.UserMessage(truncate(question, titleInputLength)),
+		schema.AssistantMessage(truncate(answer, titleInputLength), nil),
+		schema.UserMessage("Title:"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	title := cleanTitle(output.Content)
+	if title == "" {
+		return "", errors.New("生成的标题为空")
+	}
+	result := s.db.Model(&model.Conversation{}).
+		Where("id = ? AND user_id = ? AND title = ?", conversationID, userID, "").
+		Update("title", title)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", errors.New("会话已有标题")
+	}
+	return title, nil
+}
+
+func (s *titleService) Rename(userID, conversationID uint, title string) error {
+	title = cleanTitle(title)
+	if title == "" {
+		return errors.New("标题不能为空")
+	}
+	var conversation model.Conversation
+	if result := s.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation); result.Error != nil {
+		return ErrConversationNotFound
+	}
+	return s.db.Model(&conversation).Update("title", title).Error
+}
+
+// cleanTitle 取首行并去除引号和结尾标点，超长时截断
+func cleanTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(title, " \t\"'“”‘’《》「」")
+	title = strings.TrimRight(title, "。.!！?？")
+	return truncate(title, titleMaxLength)
+}
+
+// truncate 按字符截断字符串
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// MockChatModel 模拟聊天模型
+type MockChatModel struct {
+	mock.Mock
+}
+
+func (m *MockChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...einomodel.Option) (*schema.Message, error) {
+	args := m.Called(ctx, input)
+	msg, _ := args.Get(0).(*schema.Message)
+	return msg, args.Error(1)
+}
+
+func (m *MockChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...einomodel.Option) (*schema.StreamReader[*schema.Message], error) {
+	args := m.Called(ctx, input)
+	sr, _ := args.Get(0).(*schema.StreamReader[*schema.Message])
+	return sr, args.Error(1)
+}
+
+func (m *MockChatModel) BindTools(tools []*schema.ToolInfo) error {
+	return nil
+}
+
+func TestCleanTitle(t *testing.T) {
+	assert.Equal(t, "Go并发模型", cleanTitle("“Go并发模型。”\n其他内容"))
+	assert.Equal(t, "Eino agents", cleanTitle("Title: \"Eino agents.\""))
+	assert.Equal(t, titleMaxLength, len([]rune(cleanTitle(string(make([]rune, 80))+"x"))))
+}
+
+func TestConversationTitle(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}))
+
+	titleModel := new(MockChatModel)
+	titleModel.On("Generate", mock.Anything, mock.Anything).Return(schema.AssistantMessage("\"Eino入门\"", nil), nil)
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(schema.AssistantMessage("answer", nil), nil)
+	titleService := NewTitleService(db, titleModel, nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, titleService, nil)
+
+	events := make(chan ChatEvent, 4)
+	opts := SendOptions{OnEvent: func(event ChatEvent) { events <- event }}
+	response, err := chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, Content: "什么是eino"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, true, response["title_pending"])
+	conversationID := response["conversation_id"].(uint)
+
+	// 标题异步生成并通过事件推送
+	var title ChatEvent
+	for title.Type != "title" {
+		select {
+		case title = <-events:
+		case <-time.After(3 * time.Second):
+			t.Fatal("未收到标题事件")
+		}
+	}
+	assert.Equal(t, "Eino入门", title.Data.(map[string]interface{})["title"])
+
+	// 已有标题的会话不再生成
+	response, err = chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, ConversationID: conversationID, Content: "继续"}, SendOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, response["title_pending"])
+
+	// 用户修改标题
+	assert.NoError(t, chatService.RenameConversation(1, conversationID, "我的标题"))
+	assert.ErrorIs(t, chatService.RenameConversation(2, conversationID, "x"), ErrConversationNotFound)
+	var conversation model.Conversation
+	db.First(&conversation, conversationID)
+	assert.Equal(t, "我的标题", conversation.Title)
+
+	// 用户设置的标题不会被自动生成覆盖
+	_, err = titleService.Generate(context.Background(), 1, conversationID, "q", "a")
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/resource/redis"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，登录会话已撤销")
+)
+
+// TokenPair 登录或刷新后返回的令牌
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌剩余有效秒数
+}
+
+// refreshSession 刷新令牌在Redis中保存的信息，键为令牌的SHA-256哈希
+type refreshSession struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	FamilyID  string    `json:"family_id"`
+	ExpiresAt time.Time `json:"expires_at"` // 会话的截止时间，轮换不会延长
+}
+
+type TokenService interface {
+	// Issue 登录成功后创建新的会话并签发令牌
+	Issue(ctx context.Context, userID uint, username string) (*TokenPair, error)
+	// Refresh 使用刷新令牌换取新令牌，旧的刷新令牌随即失效，重复使用会撤销整个会话
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	// Logout 注销当前访问令牌并撤销其所属会话的刷新令牌
+	Logout(ctx context.Context, claims *tools.JWTClaims) error
+	// RevokeUser 撤销用户此前的全部登录会话，用于修改密码等场景
+	RevokeUser(ctx context.Context, userID uint) error
+	// IsRevoked 检查访问令牌是否已注销或所属会话已撤销
+	IsRevoked(ctx context.Context, claims *tools.JWTClaims) (bool, error)
+}
+
+type tokenService struct {
+	redis redis.RedisClient
+	jwt   *tools.JWTManager
+}
+
+// NewTokenService 创建令牌服务实例，刷新令牌和注销记录保存在Redis中
+func NewTokenService(redisClient redis.RedisClient, jwt *tools.JWTManager) TokenService {
+	return &tokenService{redis: redisClient, jwt: jwt}
+}
+
+func (s *tokenService) Issue(ctx context.Context, userID uint, username string) (*TokenPair, error) {
+	random, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("生成token失败: %v", err)
+	}
+	// 会话ID以用户当前的会话代数开头，RevokeUser递增代数后此前的会话全部失效
+	subject := strconv.FormatUint(uint64(userID), 10)
+	familyID := fmt.Sprintf("%d.%s", s.generation(ctx, subject), random)
+	session := refreshSession{
+		UserID:    userID,
+		Username:  username,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(s.jwt.RefreshTTL()),
+	}
+	if err := s.redis.Set(ctx, familyKey(familyID), userID, s.jwt.RefreshTTL()); err != nil {
+		return nil, fmt.Errorf("保存登录会话失败: %v", err)
+	}
+	return s.issue(ctx, session)
+}
+
+func (s *tokenService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+	value, err := s.redis.Get(ctx, refreshKey(hash))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	var session refreshSession
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	active, err := s.exists(ctx, familyKey(session.FamilyID))
+	if err != nil {
+		return nil, err
+	}
+	if !active || s.superseded(ctx, strconv.FormatUint(uint64(session.UserID), 10), session.FamilyID) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// 每个刷新令牌只能使用一次，并发请求中只有一个能成功标记
+	first, err := s.redis.SetNX(ctx, usedKey(hash), 1, time.Until(session.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("刷新令牌失败: %v", err)
+	}
+	if !first {
+		// 已轮换的令牌再次出现，说明令牌可能已泄露，撤销整个会话
+		if err := s.redis.Del(ctx, familyKey(session.FamilyID)); err != nil {
+			return nil, fmt.Errorf("撤销登录会话失败: %v", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return s.issue(ctx, session)
+}
+
+func (s *tokenService) Logout(ctx context.Context, claims *tools.JWTClaims) error {
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if ttl := time.Until(claims.ExpiresAt.Time); ttl > 0 {
+			if err := s.redis.Set(ctx, denylistKey(claims.ID), 1, ttl); err != nil {
+				return fmt.Errorf("注销令牌失败: %v", err)
+			}
+		}
+	}
+	if claims.SessionID != "" {
+		if err := s.redis.Del(ctx, familyKey(claims.SessionID)); err != nil {
+			return fmt.Errorf("撤销登录会话失败: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *tokenService) RevokeUser(ctx context.Context, userID uint) error {
+	if _, err := s.redis.IncrBy(ctx, generationKey(strconv.FormatUint(uint64(userID), 10)), 1); err != nil {
+		return fmt.Errorf("撤销登录会话失败: %v", err)
+	}
+	return nil
+}
+
+func (s *tokenService) IsRevoked(ctx context.Context, claims *tools.JWTClaims) (bool, error) {
+	if claims.ID != "" {
+		denied, err := s.exists(ctx, denylistKey(claims.ID))
+		if err != nil || denied {
+			return denied, err
+		}
+	}
+	if claims.SessionID != "" {
+		active, err := s.exists(ctx, familyKey(claims.SessionID))
+		if err != nil || !active {
+			return !active, err
+		}
+		return s.superseded(ctx, claims.Subject, claims.SessionID), nil
+	}
+	return false, nil
+}
+
+// generation 返回用户当前的会话代数，从未撤销过时为0
+func (s *tokenService) generation(ctx context.Context, subject string) int64 {
+	value, err := s.redis.Get(ctx, generationKey(subject))
+	if err != nil {
+		return 0
+	}
+	generation, _ := strconv.ParseInt(value, 10, 64)
+	return generation
+}
+
+// superseded 会话是否创建于用户最近一次RevokeUser之前
+func (s *tokenService) superseded(ctx context.Context, subject, familyID string) bool {
+	prefix, _, _ := strings.Cut(familyID, ".")
+	generation, err := strconv.ParseInt(prefix, 10, 64)
+	return err != nil || generation < s.generation(ctx, subject)
+}
+
+// issue 在会话中签发访问令牌和新的刷新令牌
+func (s *tokenService) issue(ctx context.Context, session refreshSession) (*TokenPair, error) {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("生成token失败: %v", err)
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redis.Set(ctx, refreshKey(hashToken(refreshToken)), string(data), ttl); err != nil {
+		return nil, fmt.Errorf("保存刷新令牌失败: %v", err)
+	}
+
+	accessToken, err := s.jwt.GenerateToken(session.UserID, session.Username, session.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.jwt.AccessTTL().Seconds()),
+	}, nil
+}
+
+// exists 通过TTL判断key是否存在，以区分key不存在和Redis错误
+func (s *tokenService) exists(ctx context.Context, key string) (bool, error) {
+	ttl, err := s.redis.TTL(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("查询令牌状态失败: %v", err)
+	}
+	return ttl != -2, nil
+}
+
+// hashToken 刷新令牌只保存哈希，Redis泄露时无法直接使用
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func refreshKey(hash string) string {
+	return fmt.Sprintf("refresh_token:%s", hash)
+}
+
+func usedKey(hash string) string {
+	return fmt.Sprintf("refresh_token_used:%s", hash)
+}
+
+func familyKey(familyID string) string {
+	return fmt.Sprintf("refresh_family:%s", familyID)
+}
+
+func generationKey(subject string) string {
+	return fmt.Sprintf("token_generation:%s", subject)
+}
+
+func denylistKey(jti string) string {
+	return fmt.Sprintf("token_denylist:%s", jti)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTokenService() (TokenService, *tools.JWTManager) {
+	jwt, _ := tools.NewJWTManager(&config.Config{JWT: config.JWTConfig{SecretKey: "secret", Expire: 1, AccessExpire: 15}})
+	return NewTokenService(newMemoryRedis(), jwt), jwt
+}
+
+func TestTokenRefreshRotates(t *testing.T) {
+	tokenService, jwt := setupTokenService()
+	ctx := context.Background()
+
+	first, err := tokenService.Issue(ctx, 1, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(900), first.ExpiresIn)
+	claims, err := jwt.ParseToken(first.AccessToken)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claims.ID)
+	assert.NotEmpty(t, claims.SessionID)
+
+	second, err := tokenService.Refresh(ctx, first.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	next, err := jwt.ParseToken(second.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, claims.SessionID, next.SessionID)
+	assert.NotEqual(t, claims.ID, next.ID)
+
+	_, err = tokenService.Refresh(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestTokenReuseRevokesFamily(t *testing.T) {
+	tokenService, jwt := setupTokenService()
+	ctx := context.Background()
+
+	first, err := tokenService.Issue(ctx, 1, "alice")
+	assert.NoError(t, err)
+	second, err := tokenService.Refresh(ctx, first.RefreshToken)
+	assert.NoError(t, err)
+	other, err := tokenService.Issue(ctx, 1, "alice")
+	assert.NoError(t, err)
+
+	// 旧令牌再次使用，整个会话被撤销
+	_, err = tokenService.Refresh(ctx, first.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = tokenService.Refresh(ctx, second.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	claims, _ := jwt.ParseToken(second.AccessToken)
+	revoked, err := tokenService.IsRevoked(ctx, claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// 其他登录会话不受影响
+	_, err = tokenService.Refresh(ctx, other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestTokenLogout(t *testing.T) {
+	tokenService, jwt := setupTokenService()
+	ctx := context.Background()
+
+	tokens, err := tokenService.Issue(ctx, 1, "alice")
+	assert.NoError(t, err)
+	claims, _ := jwt.ParseToken(tokens.AccessToken)
+	revoked, err := tokenService.IsRevoked(ctx, claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.NoError(t, tokenService.Logout(ctx, claims))
+	revoked, err = tokenService.IsRevoked(ctx, claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// 没有会话的令牌仅通过jti注销
+	claims.SessionID = ""
+	revoked, err = tokenService.IsRevoked(ctx, claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, err = tokenService.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	ucb "github.com/cloudwego/eino/utils/callbacks"
+	"github.com/davlin-coder/davlin/internal/model"
+)
+
+type traceStepKey struct{}
+
+// traceRecorder 通过eino回调记录一次生成中的中间推理和工具调用
+type traceRecorder struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	steps   []*model.TraceStep
+	started map[*model.TraceStep]time.Time
+	model   string          // 最近一次模型调用使用的模型
+	onEvent func(ChatEvent) // 工具调用开始和结束时推送事件，为空时不推送
+}
+
+func newTraceRecorder() *traceRecorder {
+	return &traceRecorder{started: make(map[*model.TraceStep]time.Time)}
+}
+
+// Handler 返回记录执行步骤的回调
+func (r *traceRecorder) Handler() callbacks.Handler {
+	return ucb.NewHandlerHelper().
+		ChatModel(&ucb.ModelCallbackHandler{
+			OnEnd: func(ctx context.Context, runInfo *callbacks.RunInfo, output *einomodel.CallbackOutput) context.Context {
+				if output != nil {
+					r.setModel(output.Config)
+					r.reasoning(r.newStep(model.TraceStepReasoning), output.Message)
+				}
+				return ctx
+			},
+			OnEndWithStreamOutput: func(ctx context.Context, runInfo *callbacks.RunInfo, output *schema.StreamReader[*einomodel.CallbackOutput]) context.Context {
+				// 先占用序号，保证步骤顺序与执行顺序一致
+				step := r.newStep(model.TraceStepReasoning)
+				r.wg.Add(1)
+				go func() {
+					defer r.wg.Done()
+					defer output.Close()
+					var chunks []*schema.Message
+					for {
+						chunk, err := output.Recv()
+						if errors.Is(err, io.EOF) {
+							break
+						}
+						if err != nil {
+							return
+						}
+						if chunk == nil {
+							continue
+						}
+						r.setModel(chunk.Config)
+						if chunk.Message != nil {
+							chunks = append(chunks, chunk.Message)
+						}
+					}
+					if len(chunks) == 0 {
+						return
+					}
+					if msg, err := schema.ConcatMessages(chunks); err == nil {
+						r.reasoning(step, msg)
+					}
+				}()
+				return ctx
+			},
+		}).
+		Tool(&ucb.ToolCallbackHandler{
+			OnStart: func(ctx context.Context, runInfo *callbacks.RunInfo, input *tool.CallbackInput) context.Context {
+				step := r.newStep(model.TraceStepToolCall)
+				r.mu.Lock()
+				step.ToolName = runInfo.Name
+				if input != nil {
+					step.Arguments = input.ArgumentsInJSON
+				}
+				r.started[step] = time.Now()
+				r.mu.Unlock()
+				r.emit(ChatEvent{Type: "tool_start", Data: map[string]interface{}{
+					"seq":       step.Seq,
+					"name":      step.ToolName,
+					"arguments": step.Arguments,
+				}})
+				return context.WithValue(ctx, traceStepKey{}, step)
+			},
+			OnEnd: func(ctx context.Context, runInfo *callbacks.RunInfo, output *tool.CallbackOutput) context.Context {
+				r.finishTool(ctx, func(step *model.TraceStep) {
+					if output != nil {
+						step.Result = output.Response
+					}
+				})
+				return ctx
+			},
+			OnError: func(ctx context.Context, runInfo *callbacks.RunInfo, err error) context.Context {
+				r.finishTool(ctx, func(step *model.TraceStep) {
+					step.Error = err.Error()
+				})
+				return ctx
+			},
+		}).
+		Handler()
+}
+
+// newStep 按执行顺序创建一个步骤
+func (r *traceRecorder) newStep(stepType string) *model.TraceStep {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	step := &model.TraceStep{Seq: len(r.steps) + 1, Type: stepType}
+	r.steps = append(r.steps, step)
+	return step
+}
+
+// setModel 记录模型调用的模型名称
+func (r *traceRecorder) setModel(config *einomodel.Config) {
+	if config == nil || config.Model == "" {
+		return
+	}
+	r.mu.Lock()
+	r.model = config.Model
+	r.mu.Unlock()
+}
+
+// reasoning 记录发起工具调用时模型给出的推理内容，最终回复本身不记录
+func (r *traceRecorder) reasoning(step *model.TraceStep, msg *schema.Message) {
+	if msg == nil || len(msg.ToolCalls) == 0 {
+		return
+	}
+	r.mu.Lock()
+	step.Content = msg.Content
+	r.mu.Unlock()
+}
+
+func (r *traceRecorder) finishTool(ctx context.Context, update func(step *model.TraceStep)) {
+	step, ok := ctx.Value(traceStepKey{}).(*model.TraceStep)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	update(step)
+	if started, ok := r.started[step]; ok {
+		step.LatencyMs = time.Since(started).Milliseconds()
+		delete(r.started, step)
+	}
+	event := ChatEvent{Type: "tool_end", Data: map[string]interface{}{
+		"seq":        step.Seq,
+		"name":       step.ToolName,
+		"error":      step.Error,
+		"latency_ms": step.LatencyMs,
+	}}
+	r.mu.Unlock()
+	r.emit(event)
+}
+
+func (r *traceRecorder) emit(event ChatEvent) {
+	if r.onEvent != nil {
+		r.onEvent(event)
+	}
+}
+
+// Model 等待流式输出处理完成后返回生成回复的模型
+func (r *traceRecorder) Model() string {
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.model
+}
+
+// Steps 等待流式输出处理完成后返回有内容的步骤
+func (r *traceRecorder) Steps() []model.TraceStep {
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	steps := make([]model.TraceStep, 0, len(r.steps))
+	for _, step := range r.steps {
+		if step.Type == model.TraceStepReasoning && step.Content == "" {
+			continue
+		}
+		steps = append(steps, *step)
+	}
+	for i := range steps {
+		steps[i].Seq = i + 1
+	}
+	return steps
+}
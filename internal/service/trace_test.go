@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTraceRecorder(t *testing.T) {
+	recorder := newTraceRecorder()
+	var events []string
+	recorder.onEvent = func(event ChatEvent) { events = append(events, event.Type) }
+	handler := recorder.Handler()
+
+	// 模型给出推理并发起工具调用
+	ctx := callbacks.InitCallbacks(context.Background(), &callbacks.RunInfo{Name: "chat", Component: components.ComponentOfChatModel}, handler)
+	callbacks.OnEnd(ctx, &einomodel.CallbackOutput{Message: schema.AssistantMessage("先搜索一下", []schema.ToolCall{
+		{ID: "call_1", Function: schema.FunctionCall{Name: "duckduckgo_search", Arguments: `{"query":"eino"}`}},
+	})})
+
+	ctx = callbacks.InitCallbacks(context.Background(), &callbacks.RunInfo{Name: "duckduckgo_search", Component: components.ComponentOfTool}, handler)
+	ctx = callbacks.OnStart(ctx, &tool.CallbackInput{ArgumentsInJSON: `{"query":"eino"}`})
+	callbacks.OnEnd(ctx, &tool.CallbackOutput{Response: "results"})
+
+	ctx = callbacks.InitCallbacks(context.Background(), &callbacks.RunInfo{Name: "str_replace_editor", Component: components.ComponentOfTool}, handler)
+	ctx = callbacks.OnStart(ctx, &tool.CallbackInput{ArgumentsInJSON: `{}`})
+	callbacks.OnError(ctx, errors.New("文件不存在"))
+
+	// 最终回复不计入步骤
+	ctx = callbacks.InitCallbacks(context.Background(), &callbacks.RunInfo{Name: "chat", Component: components.ComponentOfChatModel}, handler)
+	callbacks.OnEnd(ctx, &einomodel.CallbackOutput{Message: schema.AssistantMessage("answer", nil), Config: &einomodel.Config{Model: "gpt-4o"}})
+
+	assert.Equal(t, "gpt-4o", recorder.Model())
+	steps := recorder.Steps()
+	assert.Len(t, steps, 3)
+	assert.Equal(t, model.TraceStepReasoning, steps[0].Type)
+	assert.Equal(t, "先搜索一下", steps[0].Content)
+	assert.Equal(t, model.TraceStepToolCall, steps[1].Type)
+	assert.Equal(t, "duckduckgo_search", steps[1].ToolName)
+	assert.Equal(t, `{"query":"eino"}`, steps[1].Arguments)
+	assert.Equal(t, "results", steps[1].Result)
+	assert.Equal(t, "文件不存在", steps[2].Error)
+	assert.Equal(t, 3, steps[2].Seq)
+	assert.Equal(t, []string{"tool_start", "tool_end", "tool_start", "tool_end"}, events)
+}
+
+func TestConversationMessagesIncludeTrace(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.ChatMessage{}, &model.Conversation{}, &model.TraceStep{}))
+
+	agent := new(MockAgent)
+	agent.On("Stream", mock.Anything, mock.Anything).Return(schema.AssistantMessage("answer", nil), nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, nil, nil)
+
+	response, err := chatService.SendMessage(context.Background(), &model.ChatMessage{UserID: 1, Content: "q"}, SendOptions{})
+	assert.NoError(t, err)
+	conversationID := response["conversation_id"].(uint)
+	reply := response["reply"].(*model.ChatMessage)
+	db.Create(&model.TraceStep{MessageID: reply.ID, Seq: 1, Type: model.TraceStepToolCall, ToolName: "duckduckgo_search"})
+
+	messages, err := chatService.GetConversationMessages(1, conversationID, false)
+	assert.NoError(t, err)
+	assert.Empty(t, messages[1].Trace)
+
+	messages, err = chatService.GetConversationMessages(1, conversationID, true)
+	assert.NoError(t, err)
+	assert.Len(t, messages[1].Trace, 1)
+	assert.Equal(t, "duckduckgo_search", messages[1].Trace[0].ToolName)
+
+	history, err := chatService.GetHistory(1, true, pagination.Page{})
+	assert.NoError(t, err)
+	assert.Len(t, history.Items, 2)
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	einomodel "github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	ucb "github.com/cloudwego/eino/utils/callbacks"
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"gorm.io/gorm"
+)
+
+// UsageQuery 用量查询条件，UserID为0时不限制用户
+type UsageQuery struct {
+	UserID         uint
+	ConversationID uint
+	Model          string
+	From           time.Time
+	To             time.Time
+}
+
+// DailyUsage 按天和模型聚合的用量
+type DailyUsage struct {
+	Date             string  `json:"date"`
+	Model            string  `json:"model"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	ToolTokens       int64   `json:"tool_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+type UsageService interface {
+	// CallbackHandler 返回记录每次模型调用用量的eino回调
+	CallbackHandler(userID, conversationID uint) callbacks.Handler
+	// Record 计算费用并保存用量记录
+	Record(record *model.UsageRecord) error
+	// GetDailyUsage 按天聚合用量
+	GetDailyUsage(query UsageQuery) ([]DailyUsage, error)
+	// Currency 返回计价货币
+	Currency() string
+}
+
+type usageService struct {
+	db           *gorm.DB
+	quota        QuotaService
+	defaultModel string
+	currency     string
+	prices       map[string]config.ModelPrice
+}
+
+// NewUsageService 创建用量统计服务实例
+func NewUsageService(db *gorm.DB, quota QuotaService, cfg *config.Config) UsageService {
+	prices := make(map[string]config.ModelPrice, len(cfg.Usage.Prices))
+	for _, price := range cfg.Usage.Prices {
+		prices[price.Model] = price
+	}
+	return &usageService{
+		db:           db,
+		quota:        quota,
+		defaultModel: cfg.LLM.Model,
+		currency:     cfg.Usage.Currency,
+		prices:       prices,
+	}
+}
+
+func (s *usageService) CallbackHandler(userID, conversationID uint) callbacks.Handler {
+	// 工作区会话的用量同时计入工作区配额
+	var conversation model.Conversation
+	if s.quota != nil {
+		s.db.Select("workspace_id").Where("id = ?", conversationID).Limit(1).Find(&conversation)
+	}
+
+	record := func(output *einomodel.CallbackOutput) {
+		if output == nil || output.TokenUsage == nil {
+			return
+		}
+		usage := &model.UsageRecord{
+			UserID:           userID,
+			ConversationID:   conversationID,
+			Model:            s.defaultModel,
+			PromptTokens:     output.TokenUsage.PromptTokens,
+			CompletionTokens: output.TokenUsage.CompletionTokens,
+			TotalTokens:      output.TokenUsage.TotalTokens,
+		}
+		if output.Config != nil && output.Config.Model != "" {
+			usage.Model = output.Config.Model
+		}
+		// 输出中包含工具调用时，这部分输出token计为工具token
+		if output.Message != nil && len(output.Message.ToolCalls) > 0 {
+			usage.ToolTokens = usage.CompletionTokens
+		}
+		if err := s.Record(usage); err != nil {
+			log.Printf("保存用量记录失败: %v", err)
+		}
+		if s.quota != nil {
+			if err := s.quota.AddTokens(context.Background(), userID, usage.TotalTokens); err != nil {
+				log.Printf("更新token配额失败: %v", err)
+			}
+			if conversation.WorkspaceID != nil {
+				if err := s.quota.AddWorkspaceTokens(context.Background(), *conversation.WorkspaceID, usage.TotalTokens); err != nil {
+					log.Printf("更新工作区token配额失败: %v", err)
+				}
+			}
+		}
+	}
+
+	return ucb.NewHandlerHelper().ChatModel(&ucb.ModelCallbackHandler{
+		OnEnd: func(ctx context.Context, runInfo *callbacks.RunInfo, output *einomodel.CallbackOutput) context.Context {
+			record(output)
+			return ctx
+		},
+		OnEndWithStreamOutput: func(ctx context.Context, runInfo *callbacks.RunInfo, output *schema.StreamReader[*einomodel.CallbackOutput]) context.Context {
+			go func() {
+				defer output.Close()
+				var chunks []*schema.Message
+				var last *einomodel.CallbackOutput
+				for {
+					chunk, err := output.Recv()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						return
+					}
+					if chunk == nil {
+						continue
+					}
+					if chunk.Message != nil {
+						chunks = append(chunks, chunk.Message)
+					}
+					if chunk.TokenUsage != nil {
+						last = chunk
+					}
+				}
+				if last == nil {
+					return
+				}
+				if len(chunks) > 0 {
+					if msg, err := schema.ConcatMessages(chunks); err == nil {
+						last = &einomodel.CallbackOutput{Message: msg, Config: last.Config, TokenUsage: last.TokenUsage}
+					}
+				}
+				record(last)
+			}()
+			return ctx
+		},
+	}).Handler()
+}
+
+func (s *usageService) Record(record *model.UsageRecord) error {
+	if record.TotalTokens == 0 {
+		record.TotalTokens = record.PromptTokens + record.CompletionTokens
+	}
+	record.Cost = s.cost(record.Model, record.PromptTokens, record.CompletionTokens)
+	return s.db.Create(record).Error
+}
+
+// cost 按价格表计算费用，未配置价格的模型记为0
+func (s *usageService) cost(modelName string, promptTokens, completionTokens int) float64 {
+	price, ok := s.prices[modelName]
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+}
+
+func (s *usageService) GetDailyUsage(query UsageQuery) ([]DailyUsage, error) {
+	dateExpr := "DATE_FORMAT(created_at, '%Y-%m-%d')"
+	if s.db.Dialector.Name() == "sqlite" {
+		dateExpr = "strftime('%Y-%m-%d', created_at)"
+	}
+
+	tx := s.db.Model(&model.UsageRecord{}).Select(dateExpr + " AS date, model, COUNT(*) AS calls, " +
+		"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, " +
+		"SUM(tool_tokens) AS tool_tokens, SUM(total_tokens) AS total_tokens, SUM(cost) AS cost")
+	if query.UserID != 0 {
+		tx = tx.Where("user_id = ?", query.UserID)
+	}
+	if query.ConversationID != 0 {
+		tx = tx.Where("conversation_id = ?", query.ConversationID)
+	}
+	if query.Model != "" {
+		tx = tx.Where("model = ?", query.Model)
+	}
+	if !query.From.IsZero() {
+		tx = tx.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		tx = tx.Where("created_at < ?", query.To)
+	}
+
+	var usage []DailyUsage
+	result := tx.Group("date, model").Order("date asc, model asc").Scan(&usage)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return usage, nil
+}
+
+func (s *usageService) Currency() string {
+	return s.currency
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupUsageService(t *testing.T) (UsageService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.UsageRecord{}))
+
+	cfg := &config.Config{
+		LLM: config.LLMConfig{Model: "gpt-3.5-turbo"},
+		Usage: config.UsageConfig{
+			Currency: "USD",
+			Prices: []config.ModelPrice{
+				{Model: "gpt-3.5-turbo", Prompt: 0.5, Completion: 1.5},
+			},
+		},
+	}
+	return NewUsageService(db, nil, cfg), db
+}
+
+func TestUsageRecordCost(t *testing.T) {
+	usageService, _ := setupUsageService(t)
+
+	// 已配置价格的模型按价格表计费
+	record := &model.UsageRecord{UserID: 1, Model: "gpt-3.5-turbo", PromptTokens: 1000000, CompletionTokens: 2000000}
+	assert.NoError(t, usageService.Record(record))
+	assert.Equal(t, 3000000, record.TotalTokens)
+	assert.InDelta(t, 3.5, record.Cost, 1e-9)
+
+	// 未配置价格的模型费用为0
+	record = &model.UsageRecord{UserID: 1, Model: "unknown", PromptTokens: 100, CompletionTokens: 100}
+	assert.NoError(t, usageService.Record(record))
+	assert.Zero(t, record.Cost)
+}
+
+func TestGetDailyUsage(t *testing.T) {
+	usageService, _ := setupUsageService(t)
+
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	records := []*model.UsageRecord{
+		{UserID: 1, ConversationID: 1, Model: "gpt-3.5-turbo", PromptTokens: 100, CompletionTokens: 50, ToolTokens: 50, CreatedAt: day1},
+		{UserID: 1, ConversationID: 2, Model: "gpt-3.5-turbo", PromptTokens: 200, CompletionTokens: 100, CreatedAt: day1},
+		{UserID: 1, ConversationID: 1, Model: "gpt-3.5-turbo", PromptTokens: 10, CompletionTokens: 10, CreatedAt: day2},
+		{UserID: 2, ConversationID: 3, Model: "gpt-3.5-turbo", PromptTokens: 999, CompletionTokens: 999, CreatedAt: day1},
+	}
+	for _, record := range records {
+		assert.NoError(t, usageService.Record(record))
+	}
+
+	usage, err := usageService.GetDailyUsage(UsageQuery{UserID: 1})
+	assert.NoError(t, err)
+	assert.Len(t, usage, 2)
+	assert.Equal(t, "2025-03-01", usage[0].Date)
+	assert.Equal(t, int64(2), usage[0].Calls)
+	assert.Equal(t, int64(300), usage[0].PromptTokens)
+	assert.Equal(t, int64(150), usage[0].CompletionTokens)
+	assert.Equal(t, int64(50), usage[0].ToolTokens)
+	assert.Equal(t, int64(450), usage[0].TotalTokens)
+
+	// 按会话和时间范围过滤
+	usage, err = usageService.GetDailyUsage(UsageQuery{UserID: 1, ConversationID: 1, From: day2.Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Len(t, usage, 1)
+	assert.Equal(t, "2025-03-02", usage[0].Date)
+	assert.Equal(t, int64(20), usage[0].TotalTokens)
+}
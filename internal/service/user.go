@@ -2,37 +2,61 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"errors"
 	"fmt"
-	"math/rand"
+	"math/big"
 	"time"
 
 	"github.com/davlin-coder/davlin/internal/model"
 	"github.com/davlin-coder/davlin/internal/resource/email"
 	"github.com/davlin-coder/davlin/internal/resource/redis"
 	"github.com/davlin-coder/davlin/internal/resource/template"
-	"github.com/davlin-coder/davlin/internal/resource/tools"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type UserService interface {
 	Register(user *model.User) error
-	Login(username, password, code string) (string, error)
+	// Login 使用密码或验证码登录，失败次数过多时按邮箱和IP锁定
+	// 账户开启两步验证时返回MFARequiredError，需调用CompleteMFALogin完成登录
+	Login(email, password, code, ip string) (*TokenPair, error)
+	// CompleteMFALogin 使用登录返回的挑战令牌和动态口令或恢复码完成登录
+	CompleteMFALogin(mfaToken, code, ip string) (*TokenPair, error)
+	// GetProfile 获取用户资料
+	GetProfile(userID uint) (*model.User, error)
+	// UpdateProfile 更新用户资料，只修改非空字段
+	UpdateProfile(userID uint, update ProfileUpdate) (*model.User, error)
+	// ChangePassword 校验当前密码后修改密码，撤销其他会话并返回新的令牌
+	ChangePassword(userID uint, currentPassword, newPassword string) (*TokenPair, error)
+	// RequestEmailChange 向新邮箱发送验证码
+	RequestEmailChange(userID uint, newEmail, ip string) error
+	// ConfirmEmailChange 校验密码和新邮箱收到的验证码后修改邮箱
+	ConfirmEmailChange(userID uint, newEmail, code, password string) (*model.User, error)
+	// ScheduleDeletion 校验密码后安排删除账户，宽限期内重新登录可撤销
+	ScheduleDeletion(userID uint, password string) (time.Time, error)
+	// PurgeDeletedAccounts 删除宽限期已过的账户及其全部数据，返回删除的账户数。
+	// 用户创建的工作区会话转给工作区所有者，工作区会话中的消息保留给其他成员，只解除与该用户的关联
+	PurgeDeletedAccounts() (int, error)
 }
 
 type userService struct {
 	db                  *gorm.DB
-	jwt                 *tools.JWTManager
+	tokens              TokenService
 	verificationService VerificationService
+	guard               AttemptGuard
+	mfa                 MFAService
 }
 
 // NewUserService creates a new user service instance
-func NewUserService(db *gorm.DB, jwt *tools.JWTManager, verificationService VerificationService) UserService {
+func NewUserService(db *gorm.DB, tokens TokenService, verificationService VerificationService, guard AttemptGuard, mfa MFAService) UserService {
 	return &userService{
 		db:                  db,
-		jwt:                 jwt,
+		tokens:              tokens,
 		verificationService: verificationService,
+		guard:               guard,
+		mfa:                 mfa,
 	}
 }
 
@@ -55,37 +79,93 @@ func (s *userService) Register(user *model.User) error {
 }
 
 // Login handles user login service
-func (s *userService) Login(email, password, code string) (string, error) {
+func (s *userService) Login(email, password, code, ip string) (*TokenPair, error) {
+	ctx := context.Background()
+	// 锁定期间即使凭据正确也拒绝登录
+	if err := s.guard.CheckLogin(ctx, email, ip); err != nil {
+		return nil, err
+	}
+
 	var user model.User
 	// Find user by email
 	result := s.db.Where("email = ?", email).First(&user)
 	if result.Error != nil {
-		return "", errors.New("用户不存在")
+		s.guard.LoginFailed(ctx, email, ip)
+		return nil, errors.New("用户不存在")
 	}
 
 	// 如果提供了验证码，先验证验证码
 	if code != "" {
 		if err := s.verificationService.VerifyCode(email, code); err != nil {
-			return "", errors.New("密码错误")
+			s.guard.LoginFailed(ctx, email, ip)
+			return nil, errors.New("密码错误")
 		}
 	} else {
 		err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 		if err != nil {
-			return "", errors.New("密码错误")
+			s.guard.LoginFailed(ctx, email, ip)
+			return nil, errors.New("密码错误")
 		}
 	}
 
-	// Generate JWT token
-	token, err := s.jwt.GenerateToken(user.ID, user.Username)
+	// 凭据正确后才提示账户已停用，避免泄露账户状态
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	// 两步验证通过后才清除失败记录
+	if user.TOTPEnabled {
+		challenge, err := s.mfa.Challenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, challenge
+	}
+	s.guard.LoginSucceeded(ctx, email)
+	return startSession(ctx, s.db, s.tokens, &user)
+}
+
+// CompleteMFALogin handles the second step of a two-factor login
+func (s *userService) CompleteMFALogin(mfaToken, code, ip string) (*TokenPair, error) {
+	ctx := context.Background()
+	user, err := s.mfa.Redeem(ctx, mfaToken, code, ip)
 	if err != nil {
-		return "", fmt.Errorf("生成token失败: %v", err)
+		return nil, err
+	}
+	return startSession(ctx, s.db, s.tokens, user)
+}
+
+// startSession issues tokens once every login factor has been verified
+func startSession(ctx context.Context, db *gorm.DB, tokens TokenService, user *model.User) (*TokenPair, error) {
+	// Disabled accounts cannot sign in by any method
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	// Logging in during the grace period cancels a scheduled deletion
+	if user.DeletionScheduledAt != nil {
+		if err := db.Model(user).Update("deletion_scheduled_at", nil).Error; err != nil {
+			return nil, err
+		}
 	}
-	return token, nil
+
+	// Start a new session with an access token and a refresh token
+	return tokens.Issue(ctx, user.ID, user.Username)
 }
 
+// verificationMaxAttempts 验证码允许输错的次数，达到后验证码作废
+const verificationMaxAttempts = 5
+
+var (
+	ErrVerificationCodeExpired   = errors.New("验证码无效或已过期")
+	ErrVerificationCodeMismatch  = errors.New("验证码错误")
+	ErrVerificationCodeExhausted = errors.New("验证码错误次数过多，请重新获取")
+)
+
 // VerificationService 定义验证码服务接口
 type VerificationService interface {
-	SendVerificationCode(email string) error
+	// SendVerificationCode 发送验证码，按邮箱和IP限制发送频率，ip为空时只按邮箱限制
+	SendVerificationCode(email, ip string) error
 	VerifyCode(email, code string) error
 }
 
@@ -94,27 +174,39 @@ type verificationService struct {
 	redisClient redis.RedisClient
 	emailer     email.EmailSender
 	tm          template.TemplateManager
+	guard       AttemptGuard
 }
 
 // NewVerificationService 创建验证码服务实例
-func NewVerificationService(redisClient redis.RedisClient, emailer email.EmailSender, tm template.TemplateManager) VerificationService {
+func NewVerificationService(redisClient redis.RedisClient, emailer email.EmailSender, tm template.TemplateManager, guard AttemptGuard) VerificationService {
 	return &verificationService{
 		redisClient: redisClient,
 		emailer:     emailer,
 		tm:          tm,
+		guard:       guard,
 	}
 }
 
 // SendVerificationCode 生成并发送验证码
-func (s *verificationService) SendVerificationCode(email string) error {
-	// 生成6位随机验证码
-	code := fmt.Sprintf("%06d", rand.Intn(1000000))
+func (s *verificationService) SendVerificationCode(email, ip string) error {
+	ctx := context.Background()
+	if err := s.guard.AllowSend(ctx, email, ip); err != nil {
+		return err
+	}
+
+	// 使用crypto/rand生成6位随机验证码
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return fmt.Errorf("生成验证码失败: %v", err)
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
 
-	// 设置验证码有效期为15分钟
-	err := s.redisClient.Set(context.Background(), fmt.Sprintf("verification_code:%s", email), code, 15*time.Minute)
+	// 设置验证码有效期为15分钟，新验证码重新计算错误次数
+	err = s.redisClient.Set(ctx, fmt.Sprintf("verification_code:%s", email), code, 15*time.Minute)
 	if err != nil {
 		return fmt.Errorf("保存验证码失败: %v", err)
 	}
+	_ = s.redisClient.Del(ctx, fmt.Sprintf("verification_attempts:%s", email))
 
 	// 使用模板渲染邮件内容
 	emailContent, err := s.tm.ExecuteTemplate("verification_email", map[string]interface{}{
@@ -134,19 +226,32 @@ func (s *verificationService) SendVerificationCode(email string) error {
 	return nil
 }
 
-// VerifyCode 验证验证码
+// VerifyCode 验证验证码，输错次数达到上限后验证码作废
 func (s *verificationService) VerifyCode(email, code string) error {
-	savedCode, err := s.redisClient.Get(context.Background(), fmt.Sprintf("verification_code:%s", email))
+	ctx := context.Background()
+	codeKey := fmt.Sprintf("verification_code:%s", email)
+	attemptsKey := fmt.Sprintf("verification_attempts:%s", email)
+	savedCode, err := s.redisClient.Get(ctx, codeKey)
 	if err != nil {
-		return fmt.Errorf("验证码无效或已过期")
+		return ErrVerificationCodeExpired
 	}
 
-	if savedCode != code {
-		return fmt.Errorf("验证码错误")
+	if subtle.ConstantTimeCompare([]byte(savedCode), []byte(code)) != 1 {
+		attempts, err := s.redisClient.IncrBy(ctx, attemptsKey, 1)
+		if err == nil && attempts == 1 {
+			_ = s.redisClient.Expire(ctx, attemptsKey, 15*time.Minute)
+		}
+		if err == nil && attempts >= verificationMaxAttempts {
+			_ = s.redisClient.Del(ctx, codeKey)
+			_ = s.redisClient.Del(ctx, attemptsKey)
+			return ErrVerificationCodeExhausted
+		}
+		return ErrVerificationCodeMismatch
 	}
 
 	// 删除已使用的验证码
-	_ = s.redisClient.Del(context.Background(), fmt.Sprintf("verification_code:%s", email))
+	_ = s.redisClient.Del(ctx, codeKey)
+	_ = s.redisClient.Del(ctx, attemptsKey)
 
 	return nil
 }
@@ -0,0 +1,528 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/davlin-coder/davlin/internal/resource/email"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"gorm.io/gorm"
+)
+
+// workspaceInvitationExpire 邀请链接的有效期
+const workspaceInvitationExpire = 7 * 24 * time.Hour
+
+var (
+	ErrWorkspaceNotFound  = errors.New("工作区不存在")
+	ErrWorkspaceForbidden = errors.New("没有权限执行该操作")
+	ErrInvalidWorkspace   = errors.New("无效的工作区参数")
+	ErrMemberNotFound     = errors.New("成员不存在")
+	ErrLastOwner          = errors.New("工作区至少需要保留一名所有者")
+	ErrAlreadyMember      = errors.New("该用户已是工作区成员")
+	ErrInvitationNotFound = errors.New("邀请不存在")
+	ErrInvalidInvitation  = errors.New("邀请无效或已过期")
+)
+
+// workspaceRoleRank 成员角色的权限等级，数值越大权限越高
+var workspaceRoleRank = map[string]int{
+	model.WorkspaceRoleViewer: 1,
+	model.WorkspaceRoleEditor: 2,
+	model.WorkspaceRoleOwner:  3,
+}
+
+// workspaceRoleNames 邀请邮件中显示的角色名称
+var workspaceRoleNames = map[string]string{
+	model.WorkspaceRoleOwner:  "所有者",
+	model.WorkspaceRoleEditor: "编辑者",
+	model.WorkspaceRoleViewer: "查看者",
+}
+
+// WorkspaceInfo 工作区及当前用户在其中的角色
+type WorkspaceInfo struct {
+	model.Workspace
+	Role string `json:"role"`
+}
+
+type WorkspaceService interface {
+	// Create 创建工作区，创建者成为所有者
+	Create(userID uint, name string) (*WorkspaceInfo, error)
+	// List 分页列出用户加入的工作区
+	List(userID uint, page pagination.Page) (*pagination.Result[WorkspaceInfo], error)
+	// Get 获取用户加入的工作区
+	Get(userID, workspaceID uint) (*WorkspaceInfo, error)
+	// Rename 修改工作区名称，仅所有者可操作
+	Rename(userID, workspaceID uint, name string) (*WorkspaceInfo, error)
+	// Delete 删除工作区及其文档、成员和邀请，工作区会话转为创建者的个人会话，创建者已不存在的会话一并删除，仅所有者可操作
+	Delete(userID, workspaceID uint) error
+	// ListMembers 分页列出工作区成员
+	ListMembers(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.WorkspaceMember], error)
+	// UpdateMember 修改成员角色，仅所有者可操作，不能修改自己的角色
+	UpdateMember(userID, workspaceID, memberID uint, role string) (*model.WorkspaceMember, error)
+	// RemoveMember 移除成员，所有者可以移除任何成员，其他成员只能退出，最后一名所有者不能退出
+	RemoveMember(userID, workspaceID, memberID uint) error
+	// Invite 向邮箱发送加入工作区的邀请，同一邮箱只有最近一次邀请有效，仅所有者可操作
+	Invite(userID, workspaceID uint, email, role string) (*model.WorkspaceInvitation, error)
+	// ListInvitations 分页列出尚未接受的邀请，仅所有者可操作
+	ListInvitations(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.WorkspaceInvitation], error)
+	// RevokeInvitation 撤销尚未接受的邀请，仅所有者可操作
+	RevokeInvitation(userID, workspaceID, invitationID uint) error
+	// AcceptInvitation 使用邀请令牌加入工作区，账户邮箱必须与受邀邮箱一致
+	AcceptInvitation(userID uint, token string) (*WorkspaceInfo, error)
+	// MemberRole 返回用户在工作区中的角色，不是成员时返回ErrWorkspaceNotFound
+	MemberRole(userID, workspaceID uint) (string, error)
+}
+
+type workspaceService struct {
+	db      *gorm.DB
+	emailer email.EmailSender
+	tm      template.TemplateManager
+	webURL  string
+	now     func() time.Time
+}
+
+// NewWorkspaceService 创建工作区服务实例
+func NewWorkspaceService(db *gorm.DB, emailer email.EmailSender, tm template.TemplateManager, cfg *config.Config) WorkspaceService {
+	return &workspaceService{
+		db:      db,
+		emailer: emailer,
+		tm:      tm,
+		webURL:  strings.TrimSuffix(cfg.APP.WebURL, "/"),
+		now:     time.Now,
+	}
+}
+
+func (s *workspaceService) Create(userID uint, name string) (*WorkspaceInfo, error) {
+	name, err := workspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	workspace := model.Workspace{Name: name, CreatedBy: userID}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.WorkspaceMember{WorkspaceID: workspace.ID, UserID: userID, Role: model.WorkspaceRoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WorkspaceInfo{Workspace: workspace, Role: model.WorkspaceRoleOwner}, nil
+}
+
+func (s *workspaceService) List(userID uint, page pagination.Page) (*pagination.Result[WorkspaceInfo], error) {
+	var workspaces []WorkspaceInfo
+	query := s.db.Model(&model.Workspace{}).
+		Select("workspaces.*, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID)
+	if result := page.Apply(query, "workspaces").Scan(&workspaces); result.Error != nil {
+		return nil, result.Error
+	}
+	return pagination.NewResult(workspaces, page, func(workspace WorkspaceInfo) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: workspace.CreatedAt, ID: workspace.ID}
+	}), nil
+}
+
+func (s *workspaceService) Get(userID, workspaceID uint) (*WorkspaceInfo, error) {
+	role, err := s.MemberRole(userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	var workspace model.Workspace
+	if err := s.db.First(&workspace, workspaceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+	return &WorkspaceInfo{Workspace: workspace, Role: role}, nil
+}
+
+func (s *workspaceService) Rename(userID, workspaceID uint, name string) (*WorkspaceInfo, error) {
+	name, err := workspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.requireRole(userID, workspaceID, model.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+	result := s.db.Model(&model.Workspace{}).Where("id = ?", workspaceID).
+		Updates(map[string]interface{}{"name": name, "updated_at": s.now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return s.Get(userID, workspaceID)
+}
+
+func (s *workspaceService) Delete(userID, workspaceID uint) error {
+	if _, err := s.requireRole(userID, workspaceID, model.WorkspaceRoleOwner); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return purgeWorkspace(tx, workspaceID)
+	})
+}
+
+func (s *workspaceService) ListMembers(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.WorkspaceMember], error) {
+	if _, err := s.MemberRole(userID, workspaceID); err != nil {
+		return nil, err
+	}
+	var members []model.WorkspaceMember
+	query := s.db.Preload("User").Where("workspace_id = ?", workspaceID)
+	if result := page.Apply(query, "workspace_members").Find(&members); result.Error != nil {
+		return nil, result.Error
+	}
+	return pagination.NewResult(members, page, func(member model.WorkspaceMember) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: member.CreatedAt, ID: member.ID}
+	}), nil
+}
+
+func (s *workspaceService) UpdateMember(userID, workspaceID, memberID uint, role string) (*model.WorkspaceMember, error) {
+	if _, ok := workspaceRoleRank[role]; !ok {
+		return nil, fmt.Errorf("%w: 角色只能是owner、editor或viewer", ErrInvalidWorkspace)
+	}
+	if _, err := s.requireRole(userID, workspaceID, model.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+	if memberID == userID {
+		return nil, ErrModifySelf
+	}
+
+	member, err := s.member(workspaceID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(member).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *workspaceService) RemoveMember(userID, workspaceID, memberID uint) error {
+	role, err := s.MemberRole(userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if memberID != userID && role != model.WorkspaceRoleOwner {
+		return ErrWorkspaceForbidden
+	}
+
+	member, err := s.member(workspaceID, memberID)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if member.Role == model.WorkspaceRoleOwner {
+			var owners int64
+			if err := tx.Model(&model.WorkspaceMember{}).
+				Where("workspace_id = ? AND role = ?", workspaceID, model.WorkspaceRoleOwner).Count(&owners).Error; err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrLastOwner
+			}
+		}
+		return tx.Delete(member).Error
+	})
+}
+
+func (s *workspaceService) Invite(userID, workspaceID uint, address, role string) (*model.WorkspaceInvitation, error) {
+	address = normalizeEmail(address)
+	if _, ok := workspaceRoleRank[role]; !ok {
+		return nil, fmt.Errorf("%w: 角色只能是owner、editor或viewer", ErrInvalidWorkspace)
+	}
+	if address == "" || !strings.Contains(address, "@") {
+		return nil, fmt.Errorf("%w: 无效的邮箱地址", ErrInvalidWorkspace)
+	}
+	workspace, err := s.Get(userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if workspace.Role != model.WorkspaceRoleOwner {
+		return nil, ErrWorkspaceForbidden
+	}
+
+	var members int64
+	if err := s.db.Model(&model.WorkspaceMember{}).
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ? AND LOWER(users.email) = ?", workspaceID, address).
+		Count(&members).Error; err != nil {
+		return nil, err
+	}
+	if members > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	var inviter model.User
+	if err := s.db.First(&inviter, userID).Error; err != nil {
+		return nil, err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	invitation := &model.WorkspaceInvitation{
+		WorkspaceID: workspaceID,
+		Email:       address,
+		Role:        role,
+		TokenHash:   hashToken(token),
+		InvitedBy:   userID,
+		ExpiresAt:   now.Add(workspaceInvitationExpire),
+		CreatedAt:   now,
+	}
+	// 同一邮箱只保留最近一次邀请
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ? AND email = ? AND accepted_at IS NULL", workspaceID, address).
+			Delete(&model.WorkspaceInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sendInvitation(invitation, token, &inviter, &workspace.Workspace); err != nil {
+		s.db.Delete(invitation)
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// sendInvitation 渲染并发送邀请邮件
+func (s *workspaceService) sendInvitation(invitation *model.WorkspaceInvitation, token string, inviter *model.User, workspace *model.Workspace) error {
+	inviterName := inviter.DisplayName
+	if inviterName == "" {
+		inviterName = inviter.Username
+	}
+	content, err := s.tm.ExecuteTemplate("workspace_invitation_email", template.WorkspaceInvitationEmailData{
+		Inviter:    inviterName,
+		Workspace:  workspace.Name,
+		Role:       workspaceRoleNames[invitation.Role],
+		Link:       s.webURL + "/workspaces/join?token=" + url.QueryEscape(token),
+		ExpireDays: int(workspaceInvitationExpire.Hours() / 24),
+	})
+	if err != nil {
+		return fmt.Errorf("渲染邮件模板失败: %v", err)
+	}
+	if err := s.emailer.SendHTMLEmail([]string{invitation.Email}, "邀请您加入工作区 "+workspace.Name, content); err != nil {
+		return fmt.Errorf("发送邀请邮件失败: %v", err)
+	}
+	return nil
+}
+
+func (s *workspaceService) ListInvitations(userID, workspaceID uint, page pagination.Page) (*pagination.Result[model.WorkspaceInvitation], error) {
+	if _, err := s.requireRole(userID, workspaceID, model.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+	var invitations []model.WorkspaceInvitation
+	query := s.db.Where("workspace_id = ? AND accepted_at IS NULL", workspaceID)
+	if result := page.Apply(query, "workspace_invitations").Find(&invitations); result.Error != nil {
+		return nil, result.Error
+	}
+	return pagination.NewResult(invitations, page, func(invitation model.WorkspaceInvitation) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: invitation.CreatedAt, ID: invitation.ID}
+	}), nil
+}
+
+func (s *workspaceService) RevokeInvitation(userID, workspaceID, invitationID uint) error {
+	if _, err := s.requireRole(userID, workspaceID, model.WorkspaceRoleOwner); err != nil {
+		return err
+	}
+	result := s.db.Where("id = ? AND workspace_id = ? AND accepted_at IS NULL", invitationID, workspaceID).
+		Delete(&model.WorkspaceInvitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+func (s *workspaceService) AcceptInvitation(userID uint, token string) (*WorkspaceInfo, error) {
+	var invitation model.WorkspaceInvitation
+	result := s.db.Where("token_hash = ? AND accepted_at IS NULL", hashToken(token)).Limit(1).Find(&invitation)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	now := s.now()
+	if result.RowsAffected == 0 || now.After(invitation.ExpiresAt) {
+		return nil, ErrInvalidInvitation
+	}
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if normalizeEmail(user.Email) != invitation.Email {
+		return nil, fmt.Errorf("%w: 请使用受邀邮箱对应的账户接受邀请", ErrInvalidInvitation)
+	}
+	if _, err := s.MemberRole(userID, invitation.WorkspaceID); err == nil {
+		return nil, ErrAlreadyMember
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 邀请只能使用一次，并发请求中只有一个能成功标记
+		result := tx.Model(&model.WorkspaceInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+		return tx.Create(&model.WorkspaceMember{WorkspaceID: invitation.WorkspaceID, UserID: userID, Role: invitation.Role}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(userID, invitation.WorkspaceID)
+}
+
+func (s *workspaceService) MemberRole(userID, workspaceID uint) (string, error) {
+	var member model.WorkspaceMember
+	result := s.db.Select("role").Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Limit(1).Find(&member)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrWorkspaceNotFound
+	}
+	return member.Role, nil
+}
+
+// requireRole 要求用户在工作区中的角色不低于minRole
+func (s *workspaceService) requireRole(userID, workspaceID uint, minRole string) (string, error) {
+	role, err := s.MemberRole(userID, workspaceID)
+	if err != nil {
+		return "", err
+	}
+	if !hasWorkspaceRole(role, minRole) {
+		return "", ErrWorkspaceForbidden
+	}
+	return role, nil
+}
+
+func (s *workspaceService) member(workspaceID, userID uint) (*model.WorkspaceMember, error) {
+	var member model.WorkspaceMember
+	result := s.db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Limit(1).Find(&member)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrMemberNotFound
+	}
+	return &member, nil
+}
+
+// hasWorkspaceRole 判断角色的权限是否不低于minRole
+func hasWorkspaceRole(role, minRole string) bool {
+	return workspaceRoleRank[role] >= workspaceRoleRank[minRole]
+}
+
+// workspaceName 校验并规范化工作区名称
+func workspaceName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return "", fmt.Errorf("%w: 名称长度应为1到100个字符", ErrInvalidWorkspace)
+	}
+	return name, nil
+}
+
+// purgeWorkspace 删除工作区及其成员、邀请、文档和配额，工作区会话转为创建者的个人会话，
+// 创建者已不存在的会话一并删除
+func purgeWorkspace(tx *gorm.DB, workspaceID uint) error {
+	var orphaned []uint
+	if err := tx.Model(&model.Conversation{}).
+		Where("workspace_id = ? AND user_id NOT IN (?)", workspaceID, tx.Model(&model.User{}).Select("id")).
+		Pluck("id", &orphaned).Error; err != nil {
+		return err
+	}
+	if err := deleteConversations(tx, orphaned); err != nil {
+		return err
+	}
+	if err := tx.Model(&model.Conversation{}).Where("workspace_id = ?", workspaceID).
+		Update("workspace_id", nil).Error; err != nil {
+		return err
+	}
+	steps := []interface{}{&model.WorkspaceMember{}, &model.WorkspaceInvitation{}, &model.Document{}, &model.WorkspaceQuota{}}
+	for _, step := range steps {
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(step).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&model.Workspace{}, workspaceID).Error
+}
+
+// deleteConversations 删除会话及其消息、执行步骤、反馈和分享
+func deleteConversations(tx *gorm.DB, conversationIDs []uint) error {
+	if len(conversationIDs) == 0 {
+		return nil
+	}
+	messageIDs := tx.Model(&model.ChatMessage{}).Select("id").Where("conversation_id IN ?", conversationIDs)
+	if err := tx.Where("message_id IN (?)", messageIDs).Delete(&model.TraceStep{}).Error; err != nil {
+		return err
+	}
+	steps := []interface{}{&model.MessageFeedback{}, &model.Share{}, &model.ChatMessage{}}
+	for _, step := range steps {
+		if err := tx.Where("conversation_id IN ?", conversationIDs).Delete(step).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&model.Conversation{}, conversationIDs).Error
+}
+
+// leaveWorkspaces 在删除账户时退出全部工作区，没有成员的工作区被删除，失去全部所有者的工作区由最早加入的成员接任。
+// 用户创建的工作区会话转给工作区最早的所有者
+func leaveWorkspaces(tx *gorm.DB, userID uint) error {
+	var workspaceIDs []uint
+	if err := tx.Model(&model.WorkspaceMember{}).Where("user_id = ?", userID).Pluck("workspace_id", &workspaceIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&model.WorkspaceMember{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("invited_by = ?", userID).Delete(&model.WorkspaceInvitation{}).Error; err != nil {
+		return err
+	}
+
+	for _, workspaceID := range workspaceIDs {
+		var members []model.WorkspaceMember
+		if err := tx.Where("workspace_id = ?", workspaceID).Order("id").Find(&members).Error; err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			if err := purgeWorkspace(tx, workspaceID); err != nil {
+				return err
+			}
+			continue
+		}
+		var owner *model.WorkspaceMember
+		for i := range members {
+			if members[i].Role == model.WorkspaceRoleOwner {
+				owner = &members[i]
+				break
+			}
+		}
+		if owner == nil {
+			owner = &members[0]
+			if err := tx.Model(owner).Update("role", model.WorkspaceRoleOwner).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&model.Conversation{}).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+			Update("user_id", owner.UserID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/davlin-coder/davlin/internal/config"
+	"github.com/davlin-coder/davlin/internal/model"
+	"github.com/davlin-coder/davlin/internal/pagination"
+	"github.com/davlin-coder/davlin/internal/resource/template"
+	"github.com/davlin-coder/davlin/internal/resource/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+// setupWorkspaceService 创建alice为所有者、bob为查看者的工作区
+func setupWorkspaceService(t *testing.T) (*workspaceService, *userService, *gorm.DB, capturedEmail) {
+	users, db, emails := setupAccountService(t)
+	tm, err := template.NewTemplateManager()
+	assert.NoError(t, err)
+	cfg := &config.Config{APP: config.APPConfig{WebURL: "https://davlin.example/"}}
+	workspaces := NewWorkspaceService(db, emails, tm, cfg).(*workspaceService)
+
+	workspace, err := workspaces.Create(1, " Team ")
+	assert.NoError(t, err)
+	assert.Equal(t, "Team", workspace.Name)
+	assert.NoError(t, db.Create(&model.WorkspaceMember{WorkspaceID: workspace.ID, UserID: 2, Role: model.WorkspaceRoleViewer}).Error)
+	return workspaces, users, db, emails
+}
+
+// invitationToken 从邀请邮件中取出令牌
+func invitationToken(t *testing.T, body string) string {
+	match := resetLinkPattern.FindStringSubmatch(body)
+	assert.Len(t, match, 2)
+	link, err := url.Parse(strings.ReplaceAll(match[1], "&amp;", "&"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/workspaces/join", link.Path)
+	return link.Query().Get("token")
+}
+
+func TestWorkspaceInvitation(t *testing.T) {
+	workspaces, users, _, emails := setupWorkspaceService(t)
+	assert.NoError(t, users.Register(&model.User{Username: "carol", Email: "carol@example.com", Password: "password3"}))
+	assert.NoError(t, users.Register(&model.User{Username: "dave", Email: "dave@example.com", Password: "password4"}))
+
+	// 只有所有者可以邀请，已是成员的邮箱不能再邀请
+	_, err := workspaces.Invite(2, 1, "carol@example.com", model.WorkspaceRoleEditor)
+	assert.ErrorIs(t, err, ErrWorkspaceForbidden)
+	_, err = workspaces.Invite(1, 1, "Bob@Example.com", model.WorkspaceRoleEditor)
+	assert.ErrorIs(t, err, ErrAlreadyMember)
+	_, err = workspaces.Invite(1, 1, "carol@example.com", "admin")
+	assert.ErrorIs(t, err, ErrInvalidWorkspace)
+
+	// 重新邀请后只有最近一次的链接有效
+	_, err = workspaces.Invite(1, 1, "Carol@Example.com", model.WorkspaceRoleViewer)
+	assert.NoError(t, err)
+	stale := invitationToken(t, <-emails)
+	invitation, err := workspaces.Invite(1, 1, "carol@example.com", model.WorkspaceRoleEditor)
+	assert.NoError(t, err)
+	assert.Equal(t, "carol@example.com", invitation.Email)
+	token := invitationToken(t, <-emails)
+	page := pagination.Page{Limit: 10}
+	invitations, err := workspaces.ListInvitations(1, 1, page)
+	assert.NoError(t, err)
+	assert.Len(t, invitations.Items, 1)
+
+	_, err = workspaces.AcceptInvitation(3, stale)
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+	// 必须使用受邀邮箱对应的账户接受
+	_, err = workspaces.AcceptInvitation(4, token)
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+	workspace, err := workspaces.AcceptInvitation(3, token)
+	assert.NoError(t, err)
+	assert.Equal(t, model.WorkspaceRoleEditor, workspace.Role)
+	_, err = workspaces.AcceptInvitation(3, token)
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+
+	list, err := workspaces.List(3, page)
+	assert.NoError(t, err)
+	assert.Len(t, list.Items, 1)
+	assert.Equal(t, "Team", list.Items[0].Name)
+	assert.Equal(t, model.WorkspaceRoleEditor, list.Items[0].Role)
+
+	// 过期和撤销的邀请不能使用
+	_, err = workspaces.Invite(1, 1, "dave@example.com", model.WorkspaceRoleViewer)
+	assert.NoError(t, err)
+	token = invitationToken(t, <-emails)
+	workspaces.now = func() time.Time { return time.Now().Add(workspaceInvitationExpire + time.Minute) }
+	_, err = workspaces.AcceptInvitation(4, token)
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+	workspaces.now = time.Now
+	invitations, err = workspaces.ListInvitations(1, 1, page)
+	assert.NoError(t, err)
+	assert.NoError(t, workspaces.RevokeInvitation(1, 1, invitations.Items[0].ID))
+	_, err = workspaces.AcceptInvitation(4, token)
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+}
+
+func TestWorkspaceMembers(t *testing.T) {
+	workspaces, _, db, _ := setupWorkspaceService(t)
+
+	// 非成员看不到工作区
+	_, err := workspaces.Get(3, 1)
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+	_, err = workspaces.Rename(2, 1, "Renamed")
+	assert.ErrorIs(t, err, ErrWorkspaceForbidden)
+
+	// 成员按加入时间倒序分页
+	members, err := workspaces.ListMembers(2, 1, pagination.Page{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, members.Items, 1)
+	assert.Equal(t, "bob", members.Items[0].User.Username)
+	page, err := pagination.NewPage(members.NextCursor, 1)
+	assert.NoError(t, err)
+	members, err = workspaces.ListMembers(2, 1, page)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", members.Items[0].User.Username)
+	assert.Empty(t, members.NextCursor)
+
+	// 所有者不能修改自己的角色，最后一名所有者不能退出
+	_, err = workspaces.UpdateMember(1, 1, 1, model.WorkspaceRoleViewer)
+	assert.ErrorIs(t, err, ErrModifySelf)
+	assert.ErrorIs(t, workspaces.RemoveMember(1, 1, 1), ErrLastOwner)
+	assert.ErrorIs(t, workspaces.RemoveMember(2, 1, 1), ErrWorkspaceForbidden)
+	member, err := workspaces.UpdateMember(1, 1, 2, model.WorkspaceRoleOwner)
+	assert.NoError(t, err)
+	assert.Equal(t, model.WorkspaceRoleOwner, member.Role)
+	assert.NoError(t, workspaces.RemoveMember(1, 1, 1))
+	_, err = workspaces.Get(1, 1)
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+
+	// 删除工作区后会话转为个人会话
+	workspaceID := uint(1)
+	db.Create(&model.Conversation{UserID: 2, WorkspaceID: &workspaceID})
+	db.Create(&model.Document{WorkspaceID: 1, UploadedBy: 2, Name: "a.txt", Content: "a"})
+	assert.NoError(t, workspaces.Delete(2, 1))
+	var conversation model.Conversation
+	assert.NoError(t, db.First(&conversation).Error)
+	assert.Nil(t, conversation.WorkspaceID)
+	var count int64
+	db.Model(&model.Document{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+	db.Model(&model.WorkspaceMember{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestWorkspaceConversations(t *testing.T) {
+	workspaces, _, db, _ := setupWorkspaceService(t)
+	assert.NoError(t, db.AutoMigrate(&model.TraceStep{}))
+	ctx := context.Background()
+
+	// 工作区会话中智能体可以检索该工作区的知识库
+	agent := new(MockAgent)
+	agent.On("Stream", mock.MatchedBy(func(ctx context.Context) bool {
+		return tools.WorkspaceFromContext(ctx) == 1
+	}), mock.Anything).Return(schema.AssistantMessage("Hi", nil), nil)
+	chatService := NewChatService(db, agent, nil, nil, nil, nil, nil, workspaces)
+
+	// 查看者不能在工作区中发送消息
+	_, err := chatService.SendMessage(ctx, &model.ChatMessage{UserID: 2, Content: "Hello"}, SendOptions{WorkspaceID: 1})
+	assert.ErrorIs(t, err, ErrWorkspaceForbidden)
+	response, err := chatService.SendMessage(ctx, &model.ChatMessage{UserID: 1, Content: "Hello"}, SendOptions{WorkspaceID: 1})
+	assert.NoError(t, err)
+	conversationID := response["conversation_id"].(uint)
+	agent.AssertExpectations(t)
+
+	// 成员可以查看工作区会话，工作区会话不出现在个人会话列表中
+	messages, err := chatService.GetConversationMessages(2, conversationID, false)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	_, err = chatService.SendMessage(ctx, &model.ChatMessage{UserID: 2, ConversationID: conversationID, Content: "Hi"}, SendOptions{})
+	assert.ErrorIs(t, err, ErrWorkspaceForbidden)
+	_, err = chatService.GetConversationMessages(3, conversationID, false)
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+
+	page := pagination.Page{Limit: 10}
+	personal, err := chatService.ListConversations(1, 0, page)
+	assert.NoError(t, err)
+	assert.Empty(t, personal.Items)
+	shared, err := chatService.ListConversations(2, 1, page)
+	assert.NoError(t, err)
+	assert.Len(t, shared.Items, 1)
+	_, err = chatService.ListConversations(3, 1, page)
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+}
+
+func TestPurgeAccountLeavesWorkspaces(t *testing.T) {
+	workspaces, users, db, _ := setupWorkspaceService(t)
+	_, err := workspaces.Create(1, "Solo")
+	assert.NoError(t, err)
+	workspaceID := uint(1)
+	shared := model.Conversation{UserID: 1, WorkspaceID: &workspaceID}
+	db.Create(&shared)
+	db.Create(&model.ChatMessage{UserID: 1, ConversationID: shared.ID, Role: "user", Content: "团队问题"})
+	db.Create(&model.ChatMessage{UserID: 2, ConversationID: shared.ID, Role: "user", Content: "成员回复"})
+	personal := model.Conversation{UserID: 1}
+	db.Create(&personal)
+	db.Create(&model.ChatMessage{UserID: 1, ConversationID: personal.ID, Role: "user", Content: "个人问题"})
+
+	db.Model(&model.User{}).Where("id = ?", 1).Update("deletion_scheduled_at", time.Now().Add(-time.Minute))
+	purged, err := users.PurgeDeletedAccounts()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	// 剩余成员接任所有者，没有成员的工作区被删除，工作区会话保留
+	workspace, err := workspaces.Get(2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, model.WorkspaceRoleOwner, workspace.Role)
+	var count int64
+	db.Model(&model.Workspace{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	db.Model(&model.Conversation{}).Where("workspace_id = ? AND user_id = ?", 1, 2).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// 工作区会话中的消息保留并解除与已删除用户的关联，个人会话的消息被删除
+	var messages []model.ChatMessage
+	db.Order("id").Find(&messages)
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, "团队问题", messages[0].Content)
+		assert.Equal(t, uint(0), messages[0].UserID)
+		assert.Equal(t, uint(2), messages[1].UserID)
+	}
+
+	// 删除工作区后会话转为接任所有者的个人会话，创建者已不存在的会话被删除
+	orphaned := model.Conversation{UserID: 1, WorkspaceID: &workspaceID}
+	db.Create(&orphaned)
+	db.Create(&model.ChatMessage{UserID: 1, ConversationID: orphaned.ID, Role: "user", Content: "遗留消息"})
+	assert.NoError(t, workspaces.Delete(2, 1))
+	db.Model(&model.Conversation{}).Where("user_id = ?", 1).Count(&count)
+	assert.Equal(t, int64(0), count)
+	db.Model(&model.ChatMessage{}).Where("user_id = ? OR conversation_id = ?", 1, orphaned.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	var conversation model.Conversation
+	assert.NoError(t, db.First(&conversation, shared.ID).Error)
+	assert.Equal(t, uint(2), conversation.UserID)
+	assert.Nil(t, conversation.WorkspaceID)
+}